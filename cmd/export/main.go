@@ -0,0 +1,80 @@
+// Command export renders a stored document, the json file kept under the
+// assets directory, in one of the export formats of the api:
+//
+//	go run ./cmd/export -format html -name "Notes" assets/<id>.json > notes.html
+//	go run ./cmd/export -format pdf -page letter -o notes.pdf assets/<id>.json
+//
+// The document is read from stdin when no file is given.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ahmedjebari022/go-docs/internal/api"
+)
+
+func main() {
+	format := flag.String("format", "html", "output format: html, markdown, pdf, docx, odt or text")
+	name := flag.String("name", "", "name of the document, defaults to the file name")
+	output := flag.String("o", "", "file to write, defaults to stdout")
+	page := flag.String("page", "", "pdf page size: a3, a4, a5, letter or legal")
+	landscape := flag.Bool("landscape", false, "pdf pages in landscape")
+	margin := flag.String("margin", "", "pdf margin in millimetres")
+	flag.Parse()
+	options := url.Values{}
+	if *page != "" {
+		options.Set("page", *page)
+	}
+	if *landscape {
+		options.Set("orientation", "landscape")
+	}
+	if *margin != "" {
+		options.Set("margin", *margin)
+	}
+	if flag.NArg() > 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err := run(flag.Arg(0), *format, *name, *output, options); err != nil {
+		fmt.Fprintf(os.Stderr, "export: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(input, format, name, output string, options url.Values) error {
+	var doc api.Document
+	var err error
+	if input == "" {
+		err = json.NewDecoder(os.Stdin).Decode(&doc)
+	} else {
+		var data []byte
+		data, err = os.ReadFile(input)
+		if err == nil {
+			err = json.Unmarshal(data, &doc)
+		}
+		if name == "" {
+			name = strings.TrimSuffix(filepath.Base(input), filepath.Ext(input))
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		name = "Document"
+	}
+	data, err := api.RenderDocument(doc, name, format, options)
+	if err != nil {
+		return err
+	}
+	if output == "" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(output, data, 0644)
+}
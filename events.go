@@ -0,0 +1,360 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/ahmedjebari022/go-docs/internal/api"
+	"github.com/google/uuid"
+)
+
+// Kinds of events rooms exchange through the broker. Every server applies op
+// events in the order the broker delivers them, which keeps revisions the
+// same everywhere. A server opening a room sends sync and takes the state
+// another server answers with. Reset replaces the document after it was
+// changed outside of the rooms. Saved tells the other servers a room flushed
+// the document, so that they save on top of it.
+const (
+	opEvent    = "op"
+	joinEvent  = "join"
+	leaveEvent = "leave"
+	moveEvent  = "move"
+	syncEvent  = "sync"
+	stateEvent = "state"
+	resetEvent = "reset"
+	savedEvent = "saved"
+)
+
+const (
+	// maxHistory is how many revisions a client can miss and still catch up
+	// with operations rather than a snapshot.
+	maxHistory     = 500
+	sessionHistory = 10 * maxHistory
+	publishTimeout = 5 * time.Second
+	// syncTimeout is how long a room waits for another server to share the
+	// state of the document before reading it from the assets.
+	syncTimeout = time.Second
+)
+
+type event struct {
+	Kind         string             `json:"kind"`
+	Node         string             `json:"node"`
+	Session      string             `json:"session,omitempty"`
+	Seq          int                `json:"seq,omitempty"`
+	Revision     int                `json:"revision"`
+	Ops          []api.Operation    `json:"ops,omitempty"`
+	UserId       uuid.UUID          `json:"user_id"`
+	Collaborator *Collaborator      `json:"collaborator,omitempty"`
+	Nonce        string             `json:"nonce,omitempty"`
+	Document     *api.Document      `json:"document,omitempty"`
+	Epoch        string             `json:"epoch,omitempty"`
+	History      []revision         `json:"history,omitempty"`
+	Sessions     map[string]applied `json:"sessions,omitempty"`
+	Presence     []presence         `json:"presence,omitempty"`
+	// Stored is the revision of the document in the database
+	Stored int64 `json:"stored,omitempty"`
+}
+
+// revision is an entry of the operation log: what moved the document to the
+// next revision and where it came from.
+type revision struct {
+	Ops     []api.Operation `json:"ops"`
+	UserId  uuid.UUID       `json:"user_id"`
+	Session string          `json:"session"`
+	Seq     int             `json:"seq"`
+}
+
+// applied remembers the last operation applied for a session, so that
+// operations replayed by a reconnecting client are not applied twice.
+type applied struct {
+	Seq      int `json:"seq"`
+	Revision int `json:"revision"`
+}
+
+func (r *Room) publish(ev event) error {
+	ev.Node = r.hub.node
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+	defer cancel()
+	return r.hub.broker.Publish(ctx, r.documentId, payload)
+}
+
+// resync asks the other servers for the state of the document. Events
+// published after our own sync event are kept to be replayed on top of it.
+func (r *Room) resync() {
+	if !r.hub.broker.Shared() {
+		r.finishSync()
+		return
+	}
+	r.syncNonce = uuid.NewString()
+	r.syncSeen = false
+	r.buffered = nil
+	r.syncTimer = time.After(syncTimeout)
+	if err := r.publish(event{Kind: syncEvent, Nonce: r.syncNonce}); err != nil {
+		r.finishSync()
+	}
+}
+
+// finishSync replays what happened since the sync point, reading the document
+// from the assets if nobody shared it, and lets waiting clients in.
+func (r *Room) finishSync() {
+	if !r.ready && r.loadErr == nil {
+		r.load()
+	}
+	buffered := r.buffered
+	r.syncNonce = ""
+	r.syncTimer = nil
+	r.buffered = nil
+	for _, ev := range buffered {
+		r.process(ev)
+	}
+	resynced := r.ready
+	r.ready = true
+	if resynced {
+		for c := range r.clients {
+			r.sendSnapshot(c)
+		}
+	}
+	for c := range r.pending {
+		delete(r.pending, c)
+		r.admit(c)
+	}
+}
+
+func (r *Room) receive(payload []byte) {
+	if payload == nil {
+		// the broker lost messages, our copy may have diverged
+		r.resync()
+		return
+	}
+	var ev event
+	if err := json.Unmarshal(payload, &ev); err != nil {
+		return
+	}
+	if r.syncNonce == "" {
+		r.process(ev)
+		return
+	}
+	switch {
+	case ev.Kind == syncEvent && ev.Nonce == r.syncNonce:
+		r.syncSeen = true
+	case ev.Kind == stateEvent && ev.Nonce == r.syncNonce:
+		r.adopt(ev)
+	case r.syncSeen:
+		r.buffered = append(r.buffered, ev)
+	}
+}
+
+func (r *Room) adopt(ev event) {
+	if ev.Document == nil {
+		return
+	}
+	r.document = *ev.Document
+	r.revision = ev.Revision
+	r.history = ev.History
+	r.epoch = ev.Epoch
+	r.stored = ev.Stored
+	r.sessions = ev.Sessions
+	if r.sessions == nil {
+		r.sessions = make(map[string]applied)
+	}
+	r.loadErr = nil
+	// dirty is kept, the state holds the edits made through this server
+	// before the sync and they are still ours to save
+	r.presence = make(map[uuid.UUID]*presence)
+	for _, p := range ev.Presence {
+		r.presence[p.UserId] = &p
+	}
+	r.ready = true
+	r.finishSync()
+}
+
+func (r *Room) process(ev event) {
+	switch ev.Kind {
+	case opEvent:
+		r.applyEvent(ev)
+	case joinEvent:
+		if ev.Collaborator == nil {
+			return
+		}
+		p, ok := r.presence[ev.UserId]
+		if !ok {
+			p = &presence{Collaborator: *ev.Collaborator}
+			r.presence[ev.UserId] = p
+			joined := p.Collaborator
+			r.sendOthers(ev.UserId, r.envelope(PresenceMessage, PresencePayload{Event: JoinEvent, Collaborator: &joined}))
+		}
+		p.Conns++
+	case leaveEvent:
+		p, ok := r.presence[ev.UserId]
+		if !ok {
+			return
+		}
+		p.Conns--
+		if p.Conns <= 0 {
+			delete(r.presence, ev.UserId)
+			left := p.Collaborator
+			r.sendOthers(ev.UserId, r.envelope(PresenceMessage, PresencePayload{Event: LeaveEvent, Collaborator: &left}))
+		}
+	case moveEvent:
+		p, ok := r.presence[ev.UserId]
+		if !ok || ev.Collaborator == nil {
+			return
+		}
+		p.Selection = ev.Collaborator.Selection
+		moved := p.Collaborator
+		r.sendOthers(ev.UserId, r.envelope(PresenceMessage, PresencePayload{Event: MoveEvent, Collaborator: &moved}))
+	case syncEvent:
+		if !r.ready || r.loadErr != nil || ev.Node == r.hub.node {
+			return
+		}
+		doc := r.document
+		state := event{
+			Kind:     stateEvent,
+			Nonce:    ev.Nonce,
+			Revision: r.revision,
+			Document: &doc,
+			Epoch:    r.epoch,
+			History:  r.history,
+			Sessions: r.sessions,
+			Stored:   r.stored,
+		}
+		for _, p := range r.presence {
+			state.Presence = append(state.Presence, *p)
+		}
+		r.publish(state)
+	case resetEvent:
+		r.reset(ev)
+	case savedEvent:
+		// events come in order, this room holds what was saved already
+		if ev.Stored > r.stored {
+			r.stored = ev.Stored
+			r.staleSince = time.Time{}
+		}
+	}
+}
+
+// reset takes a document saved or restored through the api. It starts a new
+// epoch with an empty history, clients still editing the previous content
+// get a snapshot and their pending operations are refused.
+func (r *Room) reset(ev event) {
+	if !r.ready || ev.Document == nil {
+		return
+	}
+	r.document = *ev.Document
+	r.revision++
+	r.history = nil
+	r.epoch = ev.Epoch
+	r.stored = ev.Stored
+	r.staleSince = time.Time{}
+	r.loadErr = nil
+	r.dirty = false
+	r.unversioned = false
+	for c := range r.clients {
+		r.sendSnapshot(c)
+	}
+}
+
+// applyEvent transforms the operations of ev against everything that was
+// applied since the revision its author saw, so that every client converges
+// on the same document, then hands them out to the local clients.
+func (r *Room) applyEvent(ev event) {
+	origin := r.localClient(ev)
+	key := sessionKey(ev.UserId, ev.Session)
+	if last, ok := r.sessions[key]; ok && ev.Seq > 0 && ev.Seq <= last.Seq {
+		// replayed after a reconnection, it is already in the document
+		if origin != nil {
+			ack := r.envelope(AckMessage, nil)
+			ack.Seq = ev.Seq
+			if ev.Seq == last.Seq {
+				ack.Revision = last.Revision
+			}
+			r.send(origin, ack)
+		}
+		return
+	}
+	if ev.Revision < r.base() || ev.Revision > r.revision {
+		if origin != nil {
+			r.sendError(origin, ev.Seq, ErrorPayload{Code: InvalidRevisionError, Message: "unknown revision"})
+		}
+		return
+	}
+	ops := ev.Ops
+	for _, rev := range r.history[ev.Revision-r.base():] {
+		ops, _ = api.Transform(ops, rev.Ops)
+	}
+	doc := r.document
+	if err := doc.Apply(ops); err != nil {
+		if origin != nil {
+			r.sendError(origin, ev.Seq, ErrorPayload{Code: InvalidOperationsError, Message: err.Error()})
+		}
+		return
+	}
+	if err := doc.CheckSize(); err != nil {
+		if origin != nil {
+			r.sendError(origin, ev.Seq, ErrorPayload{Code: TooLargeError, Message: err.Error()})
+		}
+		return
+	}
+	r.document = doc
+	// the server the edit came from saves and records it, the others would
+	// only save the same content again
+	if ev.Node == r.hub.node {
+		r.unversioned = true
+		r.lastAuthor = ev.UserId
+		r.dirty = true
+		r.lastEdit = time.Now()
+	}
+	r.history = append(r.history, revision{Ops: ops, UserId: ev.UserId, Session: ev.Session, Seq: ev.Seq})
+	r.revision++
+	r.sessions[key] = applied{Seq: ev.Seq, Revision: r.revision}
+	r.trimHistory()
+	ack := r.envelope(AckMessage, nil)
+	ack.Seq = ev.Seq
+	update := r.envelope(OpMessage, OpPayload{Ops: ops, UserId: ev.UserId, Session: ev.Session})
+	update.Seq = ev.Seq
+	for c := range r.clients {
+		if c == origin {
+			r.send(c, ack)
+		} else {
+			r.send(c, update)
+		}
+	}
+}
+
+// sessionKey scopes sessions to their user, a session id taken from someone
+// else does not give access to their operations.
+func sessionKey(userId uuid.UUID, session string) string {
+	return userId.String() + "/" + session
+}
+
+// trimHistory keeps the operation log bounded. It only depends on the
+// revision so every server trims the same way. Sessions are forgotten once
+// they have been quiet for much longer than the log covers.
+func (r *Room) trimHistory() {
+	if len(r.history) > maxHistory {
+		r.history = r.history[len(r.history)-maxHistory:]
+	}
+	for session, last := range r.sessions {
+		if last.Revision < r.revision-sessionHistory {
+			delete(r.sessions, session)
+		}
+	}
+}
+
+// localClient finds the connection an event comes from if it is ours.
+func (r *Room) localClient(ev event) *Client {
+	if ev.Node != r.hub.node {
+		return nil
+	}
+	for c := range r.clients {
+		if c.userId == ev.UserId && c.session == ev.Session {
+			return c
+		}
+	}
+	return nil
+}
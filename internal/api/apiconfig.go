@@ -4,6 +4,8 @@ import (
 	"database/sql"
 
 	"github.com/ahmedjebari022/go-docs/internal/database"
+	"github.com/ahmedjebari022/go-docs/internal/storage"
+	"github.com/google/uuid"
 )
 
 
@@ -12,6 +14,11 @@ type ApiConfig struct{
 	Db 		*database.Queries
 	SecretKey string
 	CookieKey []byte
-	AssetsPath string
+	// Store keeps the content of the documents and of their versions
+	Store storage.DocumentStore
 	Port string
+	// DocumentChanged is called when the content of a document is replaced
+	// outside of the collaboration sessions, by a save or a restore, with the
+	// revision it was saved as
+	DocumentChanged func(documentId uuid.UUID, revision int64, doc Document)
 }
\ No newline at end of file
@@ -0,0 +1,176 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Types of blocs. Documents written before blocs had a type only hold
+// paragraphs, a bloc without type is read as one.
+const (
+	ParagraphBloc    = "paragraph"
+	HeadingBloc      = "heading"
+	BulletedListBloc = "bulleted_list"
+	NumberedListBloc = "numbered_list"
+	ChecklistBloc    = "checklist"
+	QuoteBloc        = "quote"
+	CodeBloc         = "code"
+	TableBloc        = "table"
+	RuleBloc         = "rule"
+	ImageBloc        = "image"
+)
+
+const (
+	maxHeadingLevel = 6
+	maxListLevel    = 8
+	maxTableCells   = 10000
+	maxImageSrc     = MaxDocumentSize / 2
+)
+
+// BlocAttrs holds the attributes of every type of bloc, only those of the
+// type of the bloc may be set:
+//   - heading: Level from 1 to 6
+//   - bulleted_list, numbered_list, checklist: Level is the nesting from 0 to
+//     8, Checked only for checklists
+//   - code: Language
+//   - table: Rows of cells, every row with the same number of cells
+//   - image: Src, an http(s) or data:image url, and Alt, Width, Height
+type BlocAttrs struct {
+	Level    int        `json:"level,omitempty"`
+	Checked  bool       `json:"checked,omitempty"`
+	Language string     `json:"language,omitempty"`
+	Rows     [][]string `json:"rows,omitempty"`
+	Src      string     `json:"src,omitempty"`
+	Alt      string     `json:"alt,omitempty"`
+	Width    int        `json:"width,omitempty"`
+	Height   int        `json:"height,omitempty"`
+}
+
+// imageDataFormats are the images accepted inline, svg is left out since it
+// can carry scripts.
+var imageDataFormats = []string{"png", "jpeg", "gif", "webp"}
+
+var codeLanguage = regexp.MustCompile(`^[a-z0-9+#-]{0,32}$`)
+
+func (b *Bloc) UnmarshalJSON(data []byte) error {
+	type bloc Bloc
+	v := bloc{Type: ParagraphBloc}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	v.Marks = normalizeMarks(v.Marks)
+	*b = Bloc(v)
+	return nil
+}
+
+// Kind is the type of the bloc, paragraph when it has none.
+func (b Bloc) Kind() string {
+	if b.Type == "" {
+		return ParagraphBloc
+	}
+	return b.Type
+}
+
+// HasText reports whether blocs of this type show their text, rules, tables
+// and images only have attributes. Their text is kept though, so that
+// changing the type back brings it back.
+func HasText(blocType string) bool {
+	switch blocType {
+	case TableBloc, RuleBloc, ImageBloc:
+		return false
+	}
+	return true
+}
+
+func (b Bloc) Equal(o Bloc) bool {
+	return b.Kind() == o.Kind() && b.Text == o.Text && b.Style == o.Style &&
+		slices.Equal(b.Marks, o.Marks) && reflect.DeepEqual(b.Attrs, o.Attrs)
+}
+
+// Validate checks every bloc of the document, the error names the first
+// invalid one.
+func (d Document) Validate() error {
+	for i, b := range d.Blocs {
+		if err := b.Validate(); err != nil {
+			return fmt.Errorf("bloc %d: %s", i, err.Error())
+		}
+	}
+	return nil
+}
+
+func (b Bloc) Validate() error {
+	a := b.Attrs
+	// allowed has the attributes the type accepts set, the others must stay
+	// empty
+	var allowed BlocAttrs
+	switch b.Kind() {
+	case ParagraphBloc, QuoteBloc:
+	case HeadingBloc:
+		if a.Level < 1 || a.Level > maxHeadingLevel {
+			return fmt.Errorf("heading level must be between 1 and %d", maxHeadingLevel)
+		}
+		allowed.Level = a.Level
+	case BulletedListBloc, NumberedListBloc, ChecklistBloc:
+		if a.Level < 0 || a.Level > maxListLevel {
+			return fmt.Errorf("list level must be between 0 and %d", maxListLevel)
+		}
+		allowed.Level = a.Level
+		if b.Kind() == ChecklistBloc {
+			allowed.Checked = a.Checked
+		}
+	case CodeBloc:
+		if !codeLanguage.MatchString(a.Language) {
+			return fmt.Errorf("invalid code language")
+		}
+		allowed.Language = a.Language
+	case TableBloc:
+		if len(a.Rows) == 0 || len(a.Rows[0]) == 0 {
+			return fmt.Errorf("table must have cells")
+		}
+		for _, row := range a.Rows {
+			if len(row) != len(a.Rows[0]) {
+				return fmt.Errorf("table rows must have the same number of cells")
+			}
+		}
+		if len(a.Rows)*len(a.Rows[0]) > maxTableCells {
+			return fmt.Errorf("table has more than %d cells", maxTableCells)
+		}
+		allowed.Rows = a.Rows
+	case RuleBloc:
+	case ImageBloc:
+		if err := validateImageSrc(a.Src); err != nil {
+			return err
+		}
+		if a.Width < 0 || a.Height < 0 {
+			return fmt.Errorf("invalid image size")
+		}
+		allowed.Src, allowed.Alt, allowed.Width, allowed.Height = a.Src, a.Alt, a.Width, a.Height
+	default:
+		return fmt.Errorf("unknown bloc type %q", b.Type)
+	}
+	if !reflect.DeepEqual(a, allowed) {
+		return fmt.Errorf("attributes not supported by %s", b.Kind())
+	}
+	return validateMarks(b.Marks, runeLen(b.Text))
+}
+
+func validateImageSrc(src string) error {
+	if src == "" || len(src) > maxImageSrc {
+		return fmt.Errorf("invalid image source")
+	}
+	for _, format := range imageDataFormats {
+		if strings.HasPrefix(src, "data:image/"+format+";") {
+			return nil
+		}
+	}
+	u, err := url.Parse(src)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid image source")
+	}
+	return nil
+}
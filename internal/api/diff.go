@@ -0,0 +1,395 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"reflect"
+	"slices"
+
+	"github.com/ahmedjebari022/go-docs/internal/database"
+	"github.com/google/uuid"
+)
+
+// Kinds of changes in a diff.
+const (
+	EqualChange  = "equal"
+	InsertChange = "insert"
+	DeleteChange = "delete"
+	ModifyChange = "modify"
+)
+
+const (
+	// maxDiffEdits bounds the work spent looking for the smallest diff, past
+	// it the remaining middle part is reported as deleted then inserted.
+	maxDiffEdits = 1000
+	// modifySimilarity is how much of the text a deleted and an inserted bloc
+	// must share to be reported as one modified bloc.
+	modifySimilarity = 0.5
+	currentVersion   = "current"
+)
+
+type DocumentDiff struct {
+	Blocs    []BlocDiff `json:"blocs"`
+	Inserted int        `json:"inserted"`
+	Deleted  int        `json:"deleted"`
+	Modified int        `json:"modified"`
+}
+
+// BlocDiff is a change of a bloc. From and To are its positions in the old
+// and new documents, Bloc is its content in the new document, or in the old
+// one when it was deleted. Text, Style, Marks and Type are only set on
+// modified blocs.
+type BlocDiff struct {
+	Change string      `json:"change"`
+	From   *int        `json:"from,omitempty"`
+	To     *int        `json:"to,omitempty"`
+	Bloc   *Bloc       `json:"bloc,omitempty"`
+	Text   []TextDiff  `json:"text,omitempty"`
+	Style  []StyleDiff `json:"style,omitempty"`
+	Marks  *MarksDiff  `json:"marks,omitempty"`
+	Type   *TypeDiff   `json:"type,omitempty"`
+}
+
+// MarksDiff is set when the inline formatting of a bloc changed.
+type MarksDiff struct {
+	Before []Mark `json:"before"`
+	After  []Mark `json:"after"`
+}
+
+type TextDiff struct {
+	Change string `json:"change"`
+	Text   string `json:"text"`
+}
+
+// TypeDiff is set when the type or the attributes of a bloc changed.
+type TypeDiff struct {
+	Before      string    `json:"before"`
+	After       string    `json:"after"`
+	BeforeAttrs BlocAttrs `json:"before_attrs,omitzero"`
+	AfterAttrs  BlocAttrs `json:"after_attrs,omitzero"`
+}
+
+// StyleDiff is a styling property that changed, Field is its json name.
+type StyleDiff struct {
+	Field  string `json:"field"`
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+// edit is a step of a sequence diff: a[i] kept as b[j], a[i] deleted or b[j]
+// inserted.
+type edit struct {
+	change string
+	i, j   int
+}
+
+// Diff compares two documents bloc by bloc. Blocs deleted and inserted at the
+// same place are reported as modified when their texts are close enough, with
+// the changes of the text character by character.
+func Diff(from, to Document) DocumentDiff {
+	edits := diffSequences(len(from.Blocs), len(to.Blocs), func(i, j int) bool {
+		return from.Blocs[i].Equal(to.Blocs[j])
+	})
+	diff := DocumentDiff{Blocs: []BlocDiff{}}
+	var deleted, inserted []int
+	// flush pairs the deleted and inserted blocs of a hunk
+	flush := func() {
+		for k := 0; k < max(len(deleted), len(inserted)); k++ {
+			if k < len(deleted) && k < len(inserted) {
+				i, j := deleted[k], inserted[k]
+				text, similarity := diffText(from.Blocs[i].Text, to.Blocs[j].Text)
+				if similarity >= modifySimilarity {
+					change := BlocDiff{Change: ModifyChange, From: &i, To: &j, Bloc: &to.Blocs[j], Text: text}
+					change.Style = diffStyle(from.Blocs[i].Style, to.Blocs[j].Style)
+					if before, after := from.Blocs[i], to.Blocs[j]; !slices.Equal(before.Marks, after.Marks) {
+						change.Marks = &MarksDiff{Before: before.Marks, After: after.Marks}
+					}
+					if before, after := from.Blocs[i], to.Blocs[j]; before.Kind() != after.Kind() || !reflect.DeepEqual(before.Attrs, after.Attrs) {
+						change.Type = &TypeDiff{Before: before.Kind(), After: after.Kind(), BeforeAttrs: before.Attrs, AfterAttrs: after.Attrs}
+					}
+					diff.Blocs = append(diff.Blocs, change)
+					diff.Modified++
+					continue
+				}
+			}
+			if k < len(deleted) {
+				i := deleted[k]
+				diff.Blocs = append(diff.Blocs, BlocDiff{Change: DeleteChange, From: &i, Bloc: &from.Blocs[i]})
+				diff.Deleted++
+			}
+			if k < len(inserted) {
+				j := inserted[k]
+				diff.Blocs = append(diff.Blocs, BlocDiff{Change: InsertChange, To: &j, Bloc: &to.Blocs[j]})
+				diff.Inserted++
+			}
+		}
+		deleted, inserted = nil, nil
+	}
+	for _, e := range edits {
+		switch e.change {
+		case DeleteChange:
+			deleted = append(deleted, e.i)
+		case InsertChange:
+			inserted = append(inserted, e.j)
+		default:
+			flush()
+			i, j := e.i, e.j
+			diff.Blocs = append(diff.Blocs, BlocDiff{Change: EqualChange, From: &i, To: &j, Bloc: &to.Blocs[j]})
+		}
+	}
+	flush()
+	return diff
+}
+
+func diffStyle(from, to Styling) []StyleDiff {
+	var style []StyleDiff
+	for _, field := range []struct{ name, before, after string }{
+		{"font", from.Font, to.Font},
+		{"weight", from.Weight, to.Weight},
+		{"color", from.Color, to.Color},
+	} {
+		if field.before != field.after {
+			style = append(style, StyleDiff{Field: field.name, Before: field.before, After: field.after})
+		}
+	}
+	return style
+}
+
+// diffText compares two texts rune by rune, and reports how similar they are
+// between 0 and 1.
+func diffText(from, to string) ([]TextDiff, float64) {
+	a, b := []rune(from), []rune(to)
+	if len(a)+len(b) == 0 {
+		return nil, 1
+	}
+	edits := diffSequences(len(a), len(b), func(i, j int) bool {
+		return a[i] == b[j]
+	})
+	var text []TextDiff
+	kept := 0
+	for _, e := range edits {
+		var r rune
+		switch e.change {
+		case DeleteChange:
+			r = a[e.i]
+		case InsertChange:
+			r = b[e.j]
+		default:
+			r = a[e.i]
+			kept++
+		}
+		if n := len(text); n > 0 && text[n-1].Change == e.change {
+			text[n-1].Text += string(r)
+		} else {
+			text = append(text, TextDiff{Change: e.change, Text: string(r)})
+		}
+	}
+	return text, float64(2*kept) / float64(len(a)+len(b))
+}
+
+// diffSequences finds the shortest edit script between two sequences of
+// length n and m with the algorithm of Myers, once their common prefix and
+// suffix are set aside.
+func diffSequences(n, m int, equal func(i, j int) bool) []edit {
+	prefix := 0
+	for prefix < n && prefix < m && equal(prefix, prefix) {
+		prefix++
+	}
+	suffix := 0
+	for suffix < n-prefix && suffix < m-prefix && equal(n-1-suffix, m-1-suffix) {
+		suffix++
+	}
+	edits := make([]edit, 0, max(n, m))
+	for k := 0; k < prefix; k++ {
+		edits = append(edits, edit{EqualChange, k, k})
+	}
+	edits = append(edits, myers(prefix, n-suffix, prefix, m-suffix, equal)...)
+	for k := suffix; k > 0; k-- {
+		edits = append(edits, edit{EqualChange, n - k, m - k})
+	}
+	return edits
+}
+
+// myers diffs a[a0:a1] against b[b0:b1]. trace[d] holds the furthest x
+// reached on every diagonal k in [-d, d] after d edits.
+func myers(a0, a1, b0, b1 int, equal func(i, j int) bool) []edit {
+	n, m := a1-a0, b1-b0
+	limit := min(n+m, maxDiffEdits)
+	offset := limit + 1
+	v := make([]int, 2*limit+3)
+	var trace [][]int
+	found := -1
+	for d := 0; d <= limit && found < 0; d++ {
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && equal(a0+x, b0+y) {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				found = d
+				break
+			}
+		}
+		trace = append(trace, slices.Clone(v[offset-d:offset+d+1]))
+	}
+	if found < 0 {
+		edits := make([]edit, 0, n+m)
+		for i := a0; i < a1; i++ {
+			edits = append(edits, edit{change: DeleteChange, i: i})
+		}
+		for j := b0; j < b1; j++ {
+			edits = append(edits, edit{change: InsertChange, j: j})
+		}
+		return edits
+	}
+	var edits []edit
+	x, y := n, m
+	for d := found; d > 0; d-- {
+		previous := trace[d-1]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && previous[k-1+d-1] < previous[k+1+d-1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := previous[prevK+d-1]
+		prevY := prevX - prevK
+		startX, startY := prevX, prevY+1
+		if prevK == k-1 {
+			startX, startY = prevX+1, prevY
+		}
+		for x > startX && y > startY {
+			x--
+			y--
+			edits = append(edits, edit{EqualChange, a0 + x, b0 + y})
+		}
+		if prevK == k+1 {
+			edits = append(edits, edit{change: InsertChange, j: b0 + prevY})
+		} else {
+			edits = append(edits, edit{change: DeleteChange, i: a0 + prevX})
+		}
+		x, y = prevX, prevY
+	}
+	for x > 0 && y > 0 {
+		x--
+		y--
+		edits = append(edits, edit{EqualChange, a0 + x, b0 + y})
+	}
+	slices.Reverse(edits)
+	return edits
+}
+
+var diffTemplate = template.Must(template.New("diff").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Changes</title>
+<style>
+body { font-family: sans-serif; max-width: 50em; margin: 2em auto; }
+.bloc { padding: 0.2em 0.5em; margin: 0.2em 0; white-space: pre-wrap; }
+.insert { background: #e6ffec; }
+.delete { background: #ffebe9; text-decoration: line-through; }
+.modify { background: #fff8c5; }
+ins { background: #abf2bc; text-decoration: none; }
+del { background: #ffc0c0; }
+.style { font-size: 0.8em; color: #57606a; }
+</style>
+</head>
+<body>
+<p>{{.Inserted}} inserted, {{.Deleted}} deleted, {{.Modified}} modified</p>
+{{range .Blocs}}<div class="bloc {{.Change}}">
+{{- if eq .Change "modify"}}{{range .Text}}{{if eq .Change "insert"}}<ins>{{.Text}}</ins>{{else if eq .Change "delete"}}<del>{{.Text}}</del>{{else}}{{.Text}}{{end}}{{end}}
+{{- with .Marks}}<div class="style">formatting changed</div>{{end}}
+{{- with .Type}}<div class="style">type: {{.Before}} &rarr; {{.After}}</div>{{end}}
+{{- range .Style}}<div class="style">{{.Field}}: {{or .Before "none"}} &rarr; {{or .After "none"}}</div>{{end}}
+{{- else}}{{.Bloc.Text}}{{end -}}
+</div>
+{{end}}</body>
+</html>
+`))
+
+// DiffHandler compares two versions of a document, or a version with the
+// current content when to is missing or "current". It answers in json, or
+// in html with format=html.
+func (cfg *ApiConfig) DiffHandler(w http.ResponseWriter, r *http.Request) {
+	userId, documentId, err := getDocumentAndUserFromUrl(r)
+	if err != nil {
+		RespondWithError(w, ParseStatusFromError(err), err.Error())
+		return
+	}
+	if _, err := cfg.GetUserRole(r.Context(), userId, documentId); err != nil {
+		RespondWithError(w, ParseStatusFromError(err), err.Error())
+		return
+	}
+	query := r.URL.Query()
+	if query.Get("from") == "" {
+		RespondWithError(w, 400, "missing from version")
+		return
+	}
+	from, err := cfg.resolveVersion(r, documentId, query.Get("from"))
+	if err != nil {
+		RespondWithError(w, ParseStatusFromError(err), err.Error())
+		return
+	}
+	to, err := cfg.resolveVersion(r, documentId, query.Get("to"))
+	if err != nil {
+		RespondWithError(w, ParseStatusFromError(err), err.Error())
+		return
+	}
+	diff := Diff(from, to)
+	switch query.Get("format") {
+	case "", "json":
+		RespondWithJson(w, 200, diff)
+	case "html":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(200)
+		if err := diffTemplate.Execute(w, diff); err != nil {
+			fmt.Printf("error while rendering the diff :%s\n", err.Error())
+		}
+	default:
+		RespondWithError(w, 400, "unsupported format")
+	}
+}
+
+// resolveVersion loads the content of a version of the document, the current
+// content for "current" or an empty name.
+func (cfg *ApiConfig) resolveVersion(r *http.Request, documentId uuid.UUID, name string) (Document, error) {
+	if name == "" || name == currentVersion {
+		doc, err := cfg.LoadDocument(r.Context(), documentId)
+		if err != nil {
+			return Document{}, fmt.Errorf("500: %s", err.Error())
+		}
+		return doc, nil
+	}
+	versionId, err := uuid.Parse(name)
+	if err != nil {
+		return Document{}, fmt.Errorf("400: version error")
+	}
+	version, err := cfg.Db.GetDocumentVersion(r.Context(), database.GetDocumentVersionParams{
+		ID:         versionId,
+		DocumentID: documentId,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return Document{}, fmt.Errorf("404: version not found")
+	}
+	if err != nil {
+		return Document{}, fmt.Errorf("500: %s", err.Error())
+	}
+	doc, err := cfg.loadVersion(r.Context(), version)
+	if err != nil {
+		return Document{}, fmt.Errorf("500: %s", err.Error())
+	}
+	return doc, nil
+}
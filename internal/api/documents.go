@@ -1,12 +1,14 @@
 package api
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
 
 	"io"
 	"net/http"
-	"os"
-	"path/filepath"
 
 	"github.com/ahmedjebari022/go-docs/internal/database"
 	"github.com/go-playground/validator/v10"
@@ -16,9 +18,15 @@ import (
 type Document struct {
 	Blocs []Bloc `json:"blocs"`
 }
+
+// Bloc is a paragraph, heading or other element of a document. Style applies
+// to the whole text, Marks to parts of it.
 type Bloc struct {
-	Text  string  `json:"text"`
-	Style Styling `json:"style"`
+	Type  string    `json:"type"`
+	Text  string    `json:"text"`
+	Style Styling   `json:"style"`
+	Marks []Mark    `json:"marks,omitempty"`
+	Attrs BlocAttrs `json:"attrs,omitzero"`
 }
 type Styling struct {
 	Font   string `json:"font"`
@@ -26,6 +34,12 @@ type Styling struct {
 	Color  string `json:"color"`
 }
 
+const (
+	// MaxDocumentSize caps the size in bytes of a document sent by a client
+	MaxDocumentSize = 1 << 20
+	MaxBlocs        = 50000
+)
+
 func (cfg *ApiConfig) CreateDocumentHandler(w http.ResponseWriter, r *http.Request) {
 	userId, err := GetUserIdFromContext(r.Context())
 	if err != nil {
@@ -35,6 +49,9 @@ func (cfg *ApiConfig) CreateDocumentHandler(w http.ResponseWriter, r *http.Reque
 
 	type requestBody struct {
 		Name string `json:"name" validate:"required"`
+		// WorkspaceId creates the document in a workspace rather than for
+		// the user alone
+		WorkspaceId *uuid.UUID `json:"workspace_id"`
 	}
 	type responseBody struct {
 		Id      uuid.UUID `json:"id"`
@@ -61,42 +78,56 @@ func (cfg *ApiConfig) CreateDocumentHandler(w http.ResponseWriter, r *http.Reque
 		RespondWithError(w, 400, err.Error())
 		return
 	}
-	documentID := uuid.New()
-	err = EnsureDirExists(cfg.AssetsPath)
-	if err != nil {
-		RespondWithError(w, 500, err.Error())
-		return
-	}
-	documentPath := generatePathFromId(documentID.String(), cfg.AssetsPath)
-	file, err := os.Create(documentPath)
-	if err != nil {
-		RespondWithError(w, 500, err.Error())
-		return
-	}
-	defer file.Close()
-	err = WriteToFile(file, Document{})
-	if err != nil {
-		RespondWithError(w, 500, err.Error())
-		return
+	var workspaceId uuid.NullUUID
+	if params.WorkspaceId != nil {
+		role, err := cfg.Db.GetWorkspaceRole(r.Context(), database.GetWorkspaceRoleParams{
+			WorkspaceID: *params.WorkspaceId,
+			UserID:      userId,
+		})
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			RespondWithError(w, 500, err.Error())
+			return
+		}
+		if err != nil || role == WorkspaceGuestRole {
+			RespondWithError(w, 403, "not allowed to create documents in this workspace")
+			return
+		}
+		workspaceId = uuid.NullUUID{UUID: *params.WorkspaceId, Valid: true}
 	}
-	document, err := cfg.Db.CreateDocument(r.Context(), database.CreateDocumentParams{
-		ID:      documentID,
-		Name:    params.Name,
-		OwnerID: userId,
-	})
+	document, err := cfg.createDocument(r.Context(), userId, workspaceId, params.Name, Document{})
 	if err != nil {
-		os.Remove(documentPath)
 		RespondWithError(w, 500, err.Error())
 		return
 	}
 	RespondWithJson(w, 201, responseBody{
 		Id:      document.ID,
 		Name:    document.Name,
-		OwnerId: document.OwnerID.String(),
+		OwnerId: document.OwnerID.UUID.String(),
 	})
 
 }
 
+// createDocument stores the content of a new document and registers it in
+// the database, in a workspace when workspaceId is set.
+func (cfg *ApiConfig) createDocument(ctx context.Context, ownerId uuid.UUID, workspaceId uuid.NullUUID, name string, doc Document) (database.Document, error) {
+	documentID := uuid.New()
+	var document database.Document
+	err := cfg.writeContent(ctx, createIntent, documentID, documentKey(documentID), doc, func(qtx *database.Queries) error {
+		var err error
+		document, err = qtx.CreateDocument(ctx, database.CreateDocumentParams{
+			ID:          documentID,
+			Name:        name,
+			OwnerID:     uuid.NullUUID{UUID: ownerId, Valid: true},
+			WorkspaceID: workspaceId,
+		})
+		return err
+	})
+	if err != nil {
+		return database.Document{}, err
+	}
+	return document, nil
+}
+
 func (cfg *ApiConfig) GetDocumentsByUserHandler(w http.ResponseWriter, r *http.Request) {
 
 	type responseDocument struct {
@@ -147,29 +178,24 @@ func (cfg *ApiConfig) GetDocumentHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	documentOwner, err := cfg.Db.GetDocumentOwnerId(r.Context(), id)
+	if _, err := cfg.GetUserRole(r.Context(), userId, id); err != nil {
+		RespondWithError(w, ParseStatusFromError(err), err.Error())
+		return
+	}
+	document, err := cfg.Db.GetDocument(r.Context(), id)
 	if err != nil {
 		RespondWithError(w, 500, err.Error())
 		return
 	}
-
-	if documentOwner != userId {
-		_, err = cfg.Db.GetUserPermission(r.Context(), database.GetUserPermissionParams{
-			UserID:     userId,
-			DocumentID: id,
-		})
-		if err != nil {
-			RespondWithError(w, 403, "Not Authorized to view this Document")
-			return
-		}
-	}
-	documentPath := generatePathFromId(documentId, cfg.AssetsPath)
-	documentContent, err := ReadFromFile(documentPath)
+	// the revision is read before the content, a write landing in between
+	// makes the ETag stale rather than too recent
+	documentContent, err := cfg.LoadDocument(r.Context(), id)
 	if err != nil {
 		RespondWithError(w, 500, err.Error())
 		return
 	}
 
+	w.Header().Set("ETag", revisionETag(document.Revision))
 	RespondWithJson(w, 200, documentContent)
 }
 
@@ -190,23 +216,21 @@ func (cfg *ApiConfig) UpdateDocumentHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	ownerId, err := cfg.Db.GetDocumentOwnerId(r.Context(), id)
+	role, err := cfg.GetUserRole(r.Context(), userId, id)
 	if err != nil {
-		RespondWithError(w, 500, err.Error())
+		RespondWithError(w, ParseStatusFromError(err), err.Error())
 		return
 	}
-	if ownerId != userId {
-		role, err := cfg.Db.GetUserPermission(r.Context(), database.GetUserPermissionParams{
-			UserID:     userId,
-			DocumentID: id,
-		})
-		if err != nil || role != EditorRole {
-			RespondWithError(w, 403, "user not authorized")
-			return
-		}
+	if role == ViewerRole {
+		RespondWithError(w, 403, "user not authorized")
+		return
+	}
+	revision, err := ifMatchRevision(r)
+	if err != nil {
+		RespondWithError(w, ParseStatusFromError(err), err.Error())
+		return
 	}
-	sizeLimit := 1 << 20
-	r.Body = http.MaxBytesReader(w, r.Body, int64(sizeLimit))
+	r.Body = http.MaxBytesReader(w, r.Body, MaxDocumentSize)
 	decoder := json.NewDecoder(r.Body)
 	defer r.Body.Close()
 	var params Document
@@ -214,50 +238,61 @@ func (cfg *ApiConfig) UpdateDocumentHandler(w http.ResponseWriter, r *http.Reque
 		RespondWithError(w, 400, err.Error())
 		return
 	}
-	if len(params.Blocs) > 50000 {
+	if len(params.Blocs) > MaxBlocs {
 		RespondWithError(w, 413, "document too large")
 		return
 	}
-	ctx, err := cfg.DbC.Begin()
-	if err != nil {
-		RespondWithError(w, 500, err.Error())
-		return
-	}
-	defer ctx.Rollback()
-	qtx := cfg.Db.WithTx(ctx)
-	err = qtx.UpdateDocument(r.Context(), id)
-	if err != nil {
-		RespondWithError(w, 500, err.Error())
-		return
-	}
-	path := generatePathFromId(documentId, cfg.AssetsPath)
-	tmp, err := os.CreateTemp(cfg.AssetsPath, "tmp.json")
-	if err != nil {
-		RespondWithError(w, 500, err.Error())
+	if err := params.Validate(); err != nil {
+		RespondWithError(w, 400, err.Error())
 		return
 	}
-	defer tmp.Close()
-	err = WriteToFile(tmp, params)
-	if err != nil {
-		os.Remove(tmp.Name())
-		RespondWithError(w, 500, err.Error())
+	saved, err := cfg.SaveDocument(r.Context(), id, revision, params)
+	if errors.Is(err, ErrStaleRevision) {
+		current, err := cfg.Db.GetDocumentRevision(r.Context(), id)
+		if err != nil {
+			RespondWithError(w, 404, "document not found")
+			return
+		}
+		respondStale(w, current)
 		return
 	}
-	err = ctx.Commit()
 	if err != nil {
-		os.Remove(tmp.Name())
 		RespondWithError(w, 500, err.Error())
 		return
 	}
-	err = os.Rename(tmp.Name(), path)
-	if err != nil {
-		os.Remove(tmp.Name())
-		RespondWithError(w, 500, err.Error())
-		return
+	cfg.documentChanged(id, saved, params)
+	// the content is saved already, failing here would have the client retry
+	// a write that went through with a stale revision
+	if _, err := cfg.CreateVersion(r.Context(), id, userId, SaveVersion, "", params); err != nil {
+		fmt.Printf("error while recording a version of %s :%s\n", id, err.Error())
 	}
+	w.Header().Set("ETag", revisionETag(saved))
 	RespondWithJson(w, 204, struct{}{})
 }
 
+// SaveDocument replaces the content of a document if it is still at
+// revision, or whatever its revision with AnyRevision, and returns the
+// revision the content was saved as.
+func (cfg *ApiConfig) SaveDocument(ctx context.Context, id uuid.UUID, revision int64, doc Document) (int64, error) {
+	var saved int64
+	err := cfg.writeContent(ctx, updateIntent, id, documentKey(id), doc, func(qtx *database.Queries) error {
+		var err error
+		if revision == AnyRevision {
+			saved, err = qtx.UpdateDocument(ctx, id)
+			return err
+		}
+		saved, err = qtx.UpdateDocumentIfRevision(ctx, database.UpdateDocumentIfRevisionParams{
+			ID:       id,
+			Revision: revision,
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrStaleRevision
+		}
+		return err
+	})
+	return saved, err
+}
+
 func (cfg *ApiConfig) DeleteDocumentHandler(w http.ResponseWriter, r *http.Request) {
 	userId, err := GetUserIdFromContext(r.Context())
 	if err != nil {
@@ -271,12 +306,12 @@ func (cfg *ApiConfig) DeleteDocumentHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	ownerId, err := cfg.Db.GetDocumentOwnerId(r.Context(), documentId)
+	role, err := cfg.GetUserRole(r.Context(), userId, documentId)
 	if err != nil {
-		RespondWithError(w, 500, err.Error())
+		RespondWithError(w, ParseStatusFromError(err), err.Error())
 		return
 	}
-	if ownerId != userId {
+	if role != OwnerRole {
 		RespondWithError(w, 403, "unauthorized")
 		return
 	}
@@ -293,53 +328,69 @@ func (cfg *ApiConfig) DeleteDocumentHandler(w http.ResponseWriter, r *http.Reque
 		RespondWithError(w, 500, err.Error())
 		return
 	}
-	err = ctx.Commit()
+	// the content goes after the row, the intent makes sure it does
+	intent, err := tx.CreateStoreIntent(r.Context(), database.CreateStoreIntentParams{
+		Action:     deleteIntent,
+		DocumentID: documentId,
+		Key:        documentKey(documentId),
+	})
 	if err != nil {
 		RespondWithError(w, 500, err.Error())
 		return
 	}
-	path := generatePathFromId(documentIdString, cfg.AssetsPath)
-	err = os.Remove(path)
+	err = ctx.Commit()
 	if err != nil {
 		RespondWithError(w, 500, err.Error())
 		return
 	}
+	err = cfg.removeContent(r.Context(), documentId)
+	if err == nil {
+		err = cfg.Db.DeleteStoreIntent(r.Context(), intent)
+	}
+	if err != nil {
+		fmt.Printf("error while removing the content of %s, left to reconciliation :%s\n", documentId, err.Error())
+	}
 	RespondWithJson(w, 204, struct{}{})
 }
 
-func generatePathFromId(id, assets string) string {
-	path := filepath.Join(assets, id)
-	return path + ".json"
+// LoadDocument reads the current content of a document from the store.
+func (cfg *ApiConfig) LoadDocument(ctx context.Context, documentId uuid.UUID) (Document, error) {
+	return cfg.getContent(ctx, documentKey(documentId))
 }
 
-func EnsureDirExists(pathdir string) error {
-	_, err := os.Stat(pathdir)
-	if os.IsNotExist(err) {
-		err = os.MkdirAll(pathdir, 0755)
-		if err != nil {
-			return err
-		}
+// LoadRevision reads the content of a document along with its revision. The
+// revision is read first, a save landing in between leaves it older than the
+// content and saving at it then fails rather than overwriting the save.
+func (cfg *ApiConfig) LoadRevision(ctx context.Context, documentId uuid.UUID) (Document, int64, error) {
+	revision, err := cfg.Db.GetDocumentRevision(ctx, documentId)
+	if err != nil {
+		return Document{}, 0, err
 	}
-	return nil
+	doc, err := cfg.LoadDocument(ctx, documentId)
+	return doc, revision, err
 }
 
-func WriteToFile(file *os.File, documentContent Document) error {
-	encoder := json.NewEncoder(file)
-	if err := encoder.Encode(documentContent); err != nil {
+// documentKey is the key of the content of a document in the store, the
+// name its file always had under the assets.
+func documentKey(documentId uuid.UUID) string {
+	return documentId.String() + ".json"
+}
+
+func (cfg *ApiConfig) putContent(ctx context.Context, key string, doc Document) error {
+	data, err := json.Marshal(doc)
+	if err != nil {
 		return err
 	}
-	return nil
+	return cfg.Store.Put(ctx, key, data)
 }
 
-func ReadFromFile(filepath string) (Document, error) {
-	file, err := os.Open(filepath)
+func (cfg *ApiConfig) getContent(ctx context.Context, key string) (Document, error) {
+	data, err := cfg.Store.Get(ctx, key)
 	if err != nil {
 		return Document{}, err
 	}
-	defer file.Close()
-	decoder := json.NewDecoder(file)
 	var document Document
-	if err := decoder.Decode(&document); err != nil {
+	if err := json.Unmarshal(data, &document); err != nil {
 		return Document{}, err
 	}
 	return document, nil
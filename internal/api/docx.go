@@ -0,0 +1,420 @@
+package api
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"image"
+	"strings"
+)
+
+// Namespaces and types of the parts of a docx package.
+const (
+	docxMainNamespace   = "http://schemas.openxmlformats.org/wordprocessingml/2006/main"
+	docxRelsNamespace   = "http://schemas.openxmlformats.org/officeDocument/2006/relationships"
+	docxPackageRels     = "http://schemas.openxmlformats.org/package/2006/relationships"
+	docxOfficeDocument  = docxRelsNamespace + "/officeDocument"
+	docxStylesRel       = docxRelsNamespace + "/styles"
+	docxNumberingRel    = docxRelsNamespace + "/numbering"
+	docxHyperlinkRel    = docxRelsNamespace + "/hyperlink"
+	docxImageRel        = docxRelsNamespace + "/image"
+	docxCorePropsRel    = docxPackageRels + "/metadata/core-properties"
+	docxPictureGraphic  = "http://schemas.openxmlformats.org/drawingml/2006/picture"
+	docxContentType     = "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+	docxCodeFont        = "Courier New"
+	emuPerPixel         = 9525
+	docxMaxImageWidth   = 6 * 914400
+	docxListIndent      = 720
+	docxListHanging     = 360
+	docxBulletNumbering = 1
+)
+
+// docxCheckboxes prefix the text of checklist items, docx has no checklists
+// outside of content controls which also show as these characters.
+var docxCheckboxes = map[bool]string{false: "☐", true: "☒"}
+
+// docxHeadingSizes are the sizes of the headings in half points.
+var docxHeadingSizes = [maxHeadingLevel]int{40, 32, 28, 26, 24, 22}
+
+var docxImageTypes = map[string]string{"png": "image/png", "jpeg": "image/jpeg", "gif": "image/gif"}
+
+type docxRel struct {
+	id, kind, target string
+	external         bool
+}
+
+type docxMedia struct {
+	name string
+	data []byte
+}
+
+// docxWriter builds the parts of a docx package while the document is
+// written.
+type docxWriter struct {
+	body  bytes.Buffer
+	rels  []docxRel
+	links map[string]string
+	media []docxMedia
+	// numbered lists restart at one, each gets its own numbering
+	numberedLists int
+}
+
+// RenderDOCX writes the document as a Word document. Paragraph types map
+// to the built-in Word styles, lists to numbering and checklists to list
+// paragraphs starting with a checkbox character.
+func RenderDOCX(doc Document, name string) ([]byte, error) {
+	w := &docxWriter{links: map[string]string{}}
+	w.rels = append(w.rels,
+		docxRel{id: "rId1", kind: docxStylesRel, target: "styles.xml"},
+		docxRel{id: "rId2", kind: docxNumberingRel, target: "numbering.xml"},
+	)
+	numbering := 0
+	previous := ""
+	for _, b := range doc.Blocs {
+		kind := b.Kind()
+		if kind == NumberedListBloc && previous != NumberedListBloc {
+			w.numberedLists++
+			numbering = docxBulletNumbering + w.numberedLists
+		}
+		previous = kind
+		switch kind {
+		case HeadingBloc:
+			w.paragraph(fmt.Sprintf("<w:pStyle w:val=\"Heading%d\"/>", min(max(b.Attrs.Level, 1), maxHeadingLevel)), b)
+		case BulletedListBloc, NumberedListBloc:
+			id := docxBulletNumbering
+			if kind == NumberedListBloc {
+				id = numbering
+			}
+			w.paragraph(fmt.Sprintf("<w:pStyle w:val=\"ListParagraph\"/><w:numPr><w:ilvl w:val=\"%d\"/><w:numId w:val=\"%d\"/></w:numPr>", b.Attrs.Level, id), b)
+		case ChecklistBloc:
+			prefix := docxCheckboxes[b.Attrs.Checked] + " "
+			b.Text = prefix + b.Text
+			b.Marks = insertMarks(b.Marks, 0, runeLen(prefix), nil)
+			w.paragraph(fmt.Sprintf("<w:pStyle w:val=\"ListParagraph\"/><w:ind w:left=\"%d\"/>", docxListIndent*(b.Attrs.Level+1)), b)
+		case QuoteBloc:
+			w.paragraph("<w:pStyle w:val=\"Quote\"/>", b)
+		case CodeBloc:
+			w.paragraph("<w:pStyle w:val=\"Code\"/>", Bloc{Text: b.Text})
+		case TableBloc:
+			w.table(b.Attrs.Rows)
+		case RuleBloc:
+			w.body.WriteString("<w:p><w:pPr><w:pBdr><w:bottom w:val=\"single\" w:sz=\"6\" w:space=\"1\" w:color=\"auto\"/></w:pBdr></w:pPr></w:p>")
+		case ImageBloc:
+			w.image(b.Attrs)
+		default:
+			w.paragraph("", b)
+		}
+	}
+
+	var out bytes.Buffer
+	z := zip.NewWriter(&out)
+	parts := []struct {
+		name    string
+		content []byte
+	}{
+		{"[Content_Types].xml", w.contentTypes()},
+		{"_rels/.rels", docxRelationships([]docxRel{
+			{id: "rId1", kind: docxOfficeDocument, target: "word/document.xml"},
+			{id: "rId2", kind: docxCorePropsRel, target: "docProps/core.xml"},
+		})},
+		{"docProps/core.xml", fmt.Appendf(nil, `%s<cp:coreProperties xmlns:cp="http://schemas.openxmlformats.org/package/2006/metadata/core-properties" xmlns:dc="http://purl.org/dc/elements/1.1/"><dc:title>%s</dc:title></cp:coreProperties>`, xml.Header, docxEscape(name))},
+		{"word/document.xml", w.document()},
+		{"word/_rels/document.xml.rels", docxRelationships(w.rels)},
+		{"word/styles.xml", docxStyles()},
+		{"word/numbering.xml", w.numbering()},
+	}
+	for _, m := range w.media {
+		parts = append(parts, struct {
+			name    string
+			content []byte
+		}{"word/media/" + m.name, m.data})
+	}
+	for _, part := range parts {
+		f, err := z.Create(part.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := f.Write(part.content); err != nil {
+			return nil, err
+		}
+	}
+	if err := z.Close(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+func (w *docxWriter) rel(kind, target string, external bool) string {
+	id := fmt.Sprintf("rId%d", len(w.rels)+1)
+	w.rels = append(w.rels, docxRel{id: id, kind: kind, target: target, external: external})
+	return id
+}
+
+// paragraph writes a paragraph with the properties in pPr and the text of
+// the bloc in runs, links grouped in hyperlinks.
+func (w *docxWriter) paragraph(pPr string, b Bloc) {
+	w.body.WriteString("<w:p>")
+	if pPr != "" {
+		w.body.WriteString("<w:pPr>" + pPr + "</w:pPr>")
+	}
+	link := ""
+	for _, run := range b.Runs() {
+		value, _ := run.HasMark(LinkMark)
+		if !validLink(value) {
+			value = ""
+		}
+		if value != link {
+			if link != "" {
+				w.body.WriteString("</w:hyperlink>")
+			}
+			if value != "" {
+				id, ok := w.links[value]
+				if !ok {
+					id = w.rel(docxHyperlinkRel, value, true)
+					w.links[value] = id
+				}
+				fmt.Fprintf(&w.body, "<w:hyperlink r:id=\"%s\">", id)
+			}
+			link = value
+		}
+		w.run(run)
+	}
+	if link != "" {
+		w.body.WriteString("</w:hyperlink>")
+	}
+	w.body.WriteString("</w:p>")
+}
+
+// run writes the text of a run, run properties have to follow the order of
+// the schema.
+func (w *docxWriter) run(run Run) {
+	var rPr strings.Builder
+	if _, ok := run.HasMark(LinkMark); ok {
+		rPr.WriteString("<w:rStyle w:val=\"Hyperlink\"/>")
+	}
+	_, code := run.HasMark(CodeMark)
+	if font, ok := run.HasMark(FontMark); code || (ok && fontValue.MatchString(font)) {
+		if code {
+			font = docxCodeFont
+		}
+		fmt.Fprintf(&rPr, "<w:rFonts w:ascii=\"%[1]s\" w:hAnsi=\"%[1]s\" w:cs=\"%[1]s\"/>", docxEscape(font))
+	}
+	if _, ok := run.HasMark(BoldMark); ok {
+		rPr.WriteString("<w:b/>")
+	}
+	if _, ok := run.HasMark(ItalicMark); ok {
+		rPr.WriteString("<w:i/>")
+	}
+	if _, ok := run.HasMark(StrikeMark); ok {
+		rPr.WriteString("<w:strike/>")
+	}
+	if value, ok := run.HasMark(ColorMark); ok {
+		if c, ok := colorRGB(value); ok {
+			fmt.Fprintf(&rPr, "<w:color w:val=\"%02X%02X%02X\"/>", c[0], c[1], c[2])
+		}
+	}
+	if _, ok := run.HasMark(UnderlineMark); ok {
+		rPr.WriteString("<w:u w:val=\"single\"/>")
+	}
+	if code {
+		rPr.WriteString("<w:shd w:val=\"clear\" w:color=\"auto\" w:fill=\"F6F8FA\"/>")
+	}
+	w.body.WriteString("<w:r>")
+	if rPr.Len() > 0 {
+		w.body.WriteString("<w:rPr>" + rPr.String() + "</w:rPr>")
+	}
+	for i, line := range strings.Split(run.Text, "\n") {
+		if i > 0 {
+			w.body.WriteString("<w:br/>")
+		}
+		for j, text := range strings.Split(line, "\t") {
+			if j > 0 {
+				w.body.WriteString("<w:tab/>")
+			}
+			if text != "" {
+				fmt.Fprintf(&w.body, "<w:t xml:space=\"preserve\">%s</w:t>", docxEscape(text))
+			}
+		}
+	}
+	w.body.WriteString("</w:r>")
+}
+
+// table writes the rows with the first one as header, repeated on every
+// page and made bold by the table style.
+func (w *docxWriter) table(rows [][]string) {
+	if len(rows) == 0 || len(rows[0]) == 0 {
+		return
+	}
+	width := 9000 / len(rows[0])
+	w.body.WriteString("<w:tbl><w:tblPr><w:tblStyle w:val=\"TableGrid\"/><w:tblW w:w=\"0\" w:type=\"auto\"/><w:tblLook w:val=\"0020\" w:firstRow=\"1\" w:lastRow=\"0\" w:firstColumn=\"0\" w:lastColumn=\"0\" w:noHBand=\"1\" w:noVBand=\"1\"/></w:tblPr><w:tblGrid>")
+	for range rows[0] {
+		fmt.Fprintf(&w.body, "<w:gridCol w:w=\"%d\"/>", width)
+	}
+	w.body.WriteString("</w:tblGrid>")
+	for i, row := range rows {
+		w.body.WriteString("<w:tr>")
+		if i == 0 {
+			w.body.WriteString("<w:trPr><w:tblHeader/></w:trPr>")
+		}
+		for _, cell := range row {
+			fmt.Fprintf(&w.body, "<w:tc><w:tcPr><w:tcW w:w=\"%d\" w:type=\"dxa\"/></w:tcPr>", width)
+			w.paragraph("", Bloc{Text: cell})
+			w.body.WriteString("</w:tc>")
+		}
+		w.body.WriteString("</w:tr>")
+	}
+	w.body.WriteString("</w:tbl>")
+}
+
+// image embeds an image given as a data url, images from other sites are
+// written as a link to them.
+func (w *docxWriter) image(attrs BlocAttrs) {
+	alt := attrs.Alt
+	if alt == "" {
+		alt = attrs.Src
+	}
+	data, format, ok := decodeImageData(attrs.Src)
+	if !ok {
+		if validLink(attrs.Src) {
+			w.paragraph("", Bloc{Text: alt, Marks: []Mark{{Type: LinkMark, Value: attrs.Src, End: runeLen(alt)}}})
+		} else if attrs.Alt != "" {
+			w.paragraph("", Bloc{Text: attrs.Alt})
+		}
+		return
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || config.Width == 0 || config.Height == 0 {
+		return
+	}
+	width, height := config.Width*emuPerPixel, config.Height*emuPerPixel
+	switch {
+	case attrs.Width > 0 && attrs.Height > 0:
+		width, height = attrs.Width*emuPerPixel, attrs.Height*emuPerPixel
+	case attrs.Width > 0:
+		width, height = attrs.Width*emuPerPixel, height*attrs.Width*emuPerPixel/width
+	case attrs.Height > 0:
+		width, height = width*attrs.Height*emuPerPixel/height, attrs.Height*emuPerPixel
+	}
+	if width > docxMaxImageWidth {
+		width, height = docxMaxImageWidth, height*docxMaxImageWidth/width
+	}
+	n := len(w.media) + 1
+	file := fmt.Sprintf("image%d.%s", n, format)
+	w.media = append(w.media, docxMedia{name: file, data: data})
+	id := w.rel(docxImageRel, "media/"+file, false)
+	fmt.Fprintf(&w.body, `<w:p><w:r><w:drawing><wp:inline distT="0" distB="0" distL="0" distR="0"><wp:extent cx="%[1]d" cy="%[2]d"/><wp:docPr id="%[3]d" name="Picture %[3]d" descr="%[4]s"/><a:graphic><a:graphicData uri="%[5]s"><pic:pic><pic:nvPicPr><pic:cNvPr id="%[3]d" name="%[6]s" descr="%[4]s"/><pic:cNvPicPr/></pic:nvPicPr><pic:blipFill><a:blip r:embed="%[7]s"/><a:stretch><a:fillRect/></a:stretch></pic:blipFill><pic:spPr><a:xfrm><a:off x="0" y="0"/><a:ext cx="%[1]d" cy="%[2]d"/></a:xfrm><a:prstGeom prst="rect"><a:avLst/></a:prstGeom></pic:spPr></pic:pic></a:graphicData></a:graphic></wp:inline></w:drawing></w:r></w:p>`,
+		width, height, n, docxEscape(attrs.Alt), docxPictureGraphic, file, id)
+}
+
+// decodeImageData reads the image of a data url, if it is in a format docx
+// takes.
+func decodeImageData(src string) ([]byte, string, bool) {
+	header, encoded, ok := strings.Cut(src, ";base64,")
+	if !ok {
+		return nil, "", false
+	}
+	format, ok := strings.CutPrefix(header, "data:image/")
+	if _, known := docxImageTypes[format]; !ok || !known {
+		return nil, "", false
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, "", false
+	}
+	return data, format, true
+}
+
+func (w *docxWriter) document() []byte {
+	var out bytes.Buffer
+	out.WriteString(xml.Header)
+	fmt.Fprintf(&out, `<w:document xmlns:w="%s" xmlns:r="%s" xmlns:wp="http://schemas.openxmlformats.org/drawingml/2006/wordprocessingDrawing" xmlns:a="http://schemas.openxmlformats.org/drawingml/2006/main" xmlns:pic="%s"><w:body>`,
+		docxMainNamespace, docxRelsNamespace, docxPictureGraphic)
+	out.Write(w.body.Bytes())
+	out.WriteString(`<w:sectPr><w:pgSz w:w="11906" w:h="16838"/><w:pgMar w:top="1440" w:right="1440" w:bottom="1440" w:left="1440" w:header="708" w:footer="708" w:gutter="0"/></w:sectPr></w:body></w:document>`)
+	return out.Bytes()
+}
+
+func (w *docxWriter) contentTypes() []byte {
+	var out bytes.Buffer
+	out.WriteString(xml.Header)
+	out.WriteString(`<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">`)
+	out.WriteString(`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/>`)
+	for _, format := range []string{"png", "jpeg", "gif"} {
+		fmt.Fprintf(&out, `<Default Extension="%s" ContentType="%s"/>`, format, docxImageTypes[format])
+	}
+	out.WriteString(`<Override PartName="/word/document.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.document.main+xml"/>`)
+	out.WriteString(`<Override PartName="/word/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.styles+xml"/>`)
+	out.WriteString(`<Override PartName="/word/numbering.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.numbering+xml"/>`)
+	out.WriteString(`<Override PartName="/docProps/core.xml" ContentType="application/vnd.openxmlformats-package.core-properties+xml"/>`)
+	out.WriteString(`</Types>`)
+	return out.Bytes()
+}
+
+func docxRelationships(rels []docxRel) []byte {
+	var out bytes.Buffer
+	out.WriteString(xml.Header)
+	fmt.Fprintf(&out, `<Relationships xmlns="%s">`, docxPackageRels)
+	for _, rel := range rels {
+		fmt.Fprintf(&out, `<Relationship Id="%s" Type="%s" Target="%s"`, rel.id, rel.kind, docxEscape(rel.target))
+		if rel.external {
+			out.WriteString(` TargetMode="External"`)
+		}
+		out.WriteString(`/>`)
+	}
+	out.WriteString(`</Relationships>`)
+	return out.Bytes()
+}
+
+func docxStyles() []byte {
+	var out bytes.Buffer
+	out.WriteString(xml.Header)
+	fmt.Fprintf(&out, `<w:styles xmlns:w="%s">`, docxMainNamespace)
+	out.WriteString(`<w:docDefaults><w:rPrDefault><w:rPr><w:rFonts w:ascii="Calibri" w:hAnsi="Calibri" w:cs="Calibri"/><w:sz w:val="22"/><w:szCs w:val="22"/></w:rPr></w:rPrDefault><w:pPrDefault><w:pPr><w:spacing w:after="120" w:line="276" w:lineRule="auto"/></w:pPr></w:pPrDefault></w:docDefaults>`)
+	out.WriteString(`<w:style w:type="paragraph" w:default="1" w:styleId="Normal"><w:name w:val="Normal"/><w:qFormat/></w:style>`)
+	for i, size := range docxHeadingSizes {
+		fmt.Fprintf(&out, `<w:style w:type="paragraph" w:styleId="Heading%[1]d"><w:name w:val="heading %[1]d"/><w:basedOn w:val="Normal"/><w:next w:val="Normal"/><w:qFormat/><w:pPr><w:keepNext/><w:spacing w:before="240" w:after="80"/><w:outlineLvl w:val="%[2]d"/></w:pPr><w:rPr><w:b/><w:sz w:val="%[3]d"/><w:szCs w:val="%[3]d"/></w:rPr></w:style>`, i+1, i, size)
+	}
+	out.WriteString(`<w:style w:type="paragraph" w:styleId="Quote"><w:name w:val="Quote"/><w:basedOn w:val="Normal"/><w:next w:val="Normal"/><w:qFormat/><w:pPr><w:pBdr><w:left w:val="single" w:sz="18" w:space="8" w:color="D0D7DE"/></w:pBdr><w:ind w:left="360"/></w:pPr><w:rPr><w:i/><w:color w:val="59636E"/></w:rPr></w:style>`)
+	fmt.Fprintf(&out, `<w:style w:type="paragraph" w:styleId="Code"><w:name w:val="Code"/><w:basedOn w:val="Normal"/><w:pPr><w:shd w:val="clear" w:color="auto" w:fill="F6F8FA"/><w:spacing w:after="0" w:line="240" w:lineRule="auto"/></w:pPr><w:rPr><w:rFonts w:ascii="%[1]s" w:hAnsi="%[1]s" w:cs="%[1]s"/><w:sz w:val="19"/></w:rPr></w:style>`, docxCodeFont)
+	out.WriteString(`<w:style w:type="paragraph" w:styleId="ListParagraph"><w:name w:val="List Paragraph"/><w:basedOn w:val="Normal"/><w:qFormat/><w:pPr><w:spacing w:after="40"/><w:contextualSpacing/></w:pPr></w:style>`)
+	out.WriteString(`<w:style w:type="character" w:styleId="Hyperlink"><w:name w:val="Hyperlink"/><w:rPr><w:color w:val="0563C1"/><w:u w:val="single"/></w:rPr></w:style>`)
+	out.WriteString(`<w:style w:type="table" w:styleId="TableGrid"><w:name w:val="Table Grid"/><w:tblPr><w:tblBorders><w:top w:val="single" w:sz="4" w:space="0" w:color="D0D7DE"/><w:left w:val="single" w:sz="4" w:space="0" w:color="D0D7DE"/><w:bottom w:val="single" w:sz="4" w:space="0" w:color="D0D7DE"/><w:right w:val="single" w:sz="4" w:space="0" w:color="D0D7DE"/><w:insideH w:val="single" w:sz="4" w:space="0" w:color="D0D7DE"/><w:insideV w:val="single" w:sz="4" w:space="0" w:color="D0D7DE"/></w:tblBorders><w:tblCellMar><w:left w:w="108" w:type="dxa"/><w:right w:w="108" w:type="dxa"/></w:tblCellMar></w:tblPr><w:tblStylePr w:type="firstRow"><w:rPr><w:b/></w:rPr><w:tcPr><w:shd w:val="clear" w:color="auto" w:fill="F6F8FA"/></w:tcPr></w:tblStylePr></w:style>`)
+	out.WriteString(`</w:styles>`)
+	return out.Bytes()
+}
+
+// numbering has the bullets shared by every bulleted list, and a numbering
+// restarting at one for every numbered list.
+func (w *docxWriter) numbering() []byte {
+	var out bytes.Buffer
+	out.WriteString(xml.Header)
+	fmt.Fprintf(&out, `<w:numbering xmlns:w="%s">`, docxMainNamespace)
+	bullets := []string{"•", "◦", "▪"}
+	formats := []string{"decimal", "lowerLetter", "lowerRoman"}
+	for abstract := range 2 {
+		fmt.Fprintf(&out, `<w:abstractNum w:abstractNumId="%d"><w:multiLevelType w:val="hybridMultilevel"/>`, abstract)
+		for level := 0; level <= maxListLevel; level++ {
+			format, text := "bullet", bullets[level%len(bullets)]
+			if abstract == 1 {
+				format, text = formats[level%len(formats)], fmt.Sprintf("%%%d.", level+1)
+			}
+			fmt.Fprintf(&out, `<w:lvl w:ilvl="%d"><w:start w:val="1"/><w:numFmt w:val="%s"/><w:lvlText w:val="%s"/><w:lvlJc w:val="left"/><w:pPr><w:ind w:left="%d" w:hanging="%d"/></w:pPr></w:lvl>`,
+				level, format, text, docxListIndent*(level+1), docxListHanging)
+		}
+		out.WriteString(`</w:abstractNum>`)
+	}
+	fmt.Fprintf(&out, `<w:num w:numId="%d"><w:abstractNumId w:val="0"/></w:num>`, docxBulletNumbering)
+	for i := 1; i <= w.numberedLists; i++ {
+		fmt.Fprintf(&out, `<w:num w:numId="%d"><w:abstractNumId w:val="1"/><w:lvlOverride w:ilvl="0"><w:startOverride w:val="1"/></w:lvlOverride></w:num>`, docxBulletNumbering+i)
+	}
+	out.WriteString(`</w:numbering>`)
+	return out.Bytes()
+}
+
+func docxEscape(s string) string {
+	var sb strings.Builder
+	xml.EscapeText(&sb, []byte(s))
+	return sb.String()
+}
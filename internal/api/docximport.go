@@ -0,0 +1,671 @@
+package api
+
+import (
+	"archive/zip"
+	"bytes"
+	"cmp"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// maxDocxPart caps the uncompressed size of the parts of an imported docx,
+// so that a small upload cannot inflate into a huge one.
+const maxDocxPart = 16 * MaxDocumentSize
+
+// Losses reported by the docx import, for what a document cannot hold.
+const (
+	lossNotes         = "footnotes and endnotes were dropped"
+	lossComments      = "comments were dropped"
+	lossHeaders       = "headers and footers were dropped"
+	lossShapes        = "text boxes and shapes were dropped"
+	lossEquations     = "equations were dropped"
+	lossInlineImages  = "images inside text were dropped"
+	lossImages        = "images that are not png, jpeg or gif, or too large, were dropped"
+	lossMergedCells   = "merged table cells were split"
+	lossNestedTables  = "nested tables were flattened to text"
+	lossCellFormat    = "formatting inside tables was dropped"
+	lossTrackedChange = "tracked changes were accepted"
+	lossHighlight     = "highlights were dropped"
+	lossFonts         = "unsupported font names were dropped"
+)
+
+// xmlNode is any element of an xml part, elements are matched on their
+// local name.
+type xmlNode struct {
+	XMLName xml.Name
+	Attrs   []xml.Attr `xml:",any,attr"`
+	Nodes   []xmlNode  `xml:",any"`
+	Content string     `xml:",chardata"`
+}
+
+func (n *xmlNode) attr(name string) string {
+	for _, a := range n.Attrs {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// child returns the first child element with the name, nil when n is nil.
+func (n *xmlNode) child(name string) *xmlNode {
+	if n == nil {
+		return nil
+	}
+	for i := range n.Nodes {
+		if n.Nodes[i].XMLName.Local == name {
+			return &n.Nodes[i]
+		}
+	}
+	return nil
+}
+
+// find returns the first element with the name in n or below it.
+func (n *xmlNode) find(name string) *xmlNode {
+	if n == nil {
+		return nil
+	}
+	for i := range n.Nodes {
+		if n.Nodes[i].XMLName.Local == name {
+			return &n.Nodes[i]
+		}
+		if found := n.Nodes[i].find(name); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// on reads an on/off property, present without value means on.
+func (n *xmlNode) on() bool {
+	switch n.attr("val") {
+	case "0", "false", "off", "none":
+		return false
+	}
+	return true
+}
+
+type docxStyle struct {
+	name, basedOn string
+}
+
+type docxRun struct {
+	text  string
+	marks []Mark
+}
+
+// docxReader maps the body of a docx document to blocs.
+type docxReader struct {
+	zip    *zip.Reader
+	dir    string
+	rels   map[string]docxRel
+	styles map[string]docxStyle
+	// formats are the formats of the levels of each numbering
+	formats    map[string][]string
+	blocs      []Bloc
+	losses     []string
+	imageBytes int
+}
+
+// ParseDOCX reads a Word document into blocs. Paragraphs take their type
+// from their style, lists from their numbering, and what a document cannot
+// hold is dropped or flattened, the losses say what.
+func ParseDOCX(data []byte) (Document, []string, error) {
+	z, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return Document{}, nil, fmt.Errorf("not a docx file")
+	}
+	r := &docxReader{zip: z, rels: map[string]docxRel{}, styles: map[string]docxStyle{}, formats: map[string][]string{}}
+	main := "word/document.xml"
+	var packageRels xmlNode
+	if err := r.part("_rels/.rels", &packageRels); err == nil {
+		for _, rel := range packageRels.Nodes {
+			if rel.attr("Type") == docxOfficeDocument {
+				main = strings.TrimPrefix(rel.attr("Target"), "/")
+			}
+		}
+	}
+	r.dir = path.Dir(main)
+	var document xmlNode
+	if err := r.part(main, &document); err != nil {
+		return Document{}, nil, err
+	}
+	var rels xmlNode
+	if err := r.part(path.Join(r.dir, "_rels", path.Base(main)+".rels"), &rels); err == nil {
+		for _, rel := range rels.Nodes {
+			target := rel.attr("Target")
+			external := rel.attr("TargetMode") == "External"
+			if !external {
+				target = r.resolve(target)
+			}
+			r.rels[rel.attr("Id")] = docxRel{kind: rel.attr("Type"), target: target, external: external}
+			switch rel.attr("Type") {
+			case docxRelsNamespace + "/header", docxRelsNamespace + "/footer":
+				r.lose(lossHeaders)
+			case docxStylesRel:
+				r.readStyles(target)
+			case docxNumberingRel:
+				r.readNumbering(target)
+			}
+		}
+	}
+	body := document.child("body")
+	if body == nil {
+		return Document{}, nil, fmt.Errorf("docx file has no body")
+	}
+	r.blocks(body)
+	doc := Document{Blocs: r.blocs}
+	if len(doc.Blocs) > MaxBlocs {
+		return Document{}, nil, fmt.Errorf("document too large")
+	}
+	if err := doc.Validate(); err != nil {
+		return Document{}, nil, err
+	}
+	return doc, r.losses, nil
+}
+
+// part decodes a part of the package.
+func (r *docxReader) part(name string, v any) error {
+	data, err := r.file(name)
+	if err != nil {
+		return err
+	}
+	return xml.Unmarshal(data, v)
+}
+
+func (r *docxReader) file(name string) ([]byte, error) {
+	f, err := r.zip.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("docx file has no %s", name)
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, maxDocxPart+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxDocxPart {
+		return nil, fmt.Errorf("docx file too large")
+	}
+	return data, nil
+}
+
+// resolve turns the target of an internal relationship into the name of a
+// part.
+func (r *docxReader) resolve(target string) string {
+	if strings.HasPrefix(target, "/") {
+		return strings.TrimPrefix(target, "/")
+	}
+	return path.Join(r.dir, target)
+}
+
+func (r *docxReader) lose(loss string) {
+	if !slices.Contains(r.losses, loss) {
+		r.losses = append(r.losses, loss)
+	}
+}
+
+func (r *docxReader) readStyles(name string) {
+	var styles xmlNode
+	if r.part(name, &styles) != nil {
+		return
+	}
+	for _, s := range styles.Nodes {
+		if s.XMLName.Local != "style" {
+			continue
+		}
+		style := docxStyle{}
+		if n := s.child("name"); n != nil {
+			style.name = strings.ToLower(n.attr("val"))
+		}
+		if n := s.child("basedOn"); n != nil {
+			style.basedOn = n.attr("val")
+		}
+		r.styles[s.attr("styleId")] = style
+	}
+}
+
+func (r *docxReader) readNumbering(name string) {
+	var numbering xmlNode
+	if r.part(name, &numbering) != nil {
+		return
+	}
+	abstracts := map[string][]string{}
+	for _, n := range numbering.Nodes {
+		if n.XMLName.Local != "abstractNum" {
+			continue
+		}
+		formats := make([]string, maxListLevel+1)
+		for _, lvl := range n.Nodes {
+			level, err := strconv.Atoi(lvl.attr("ilvl"))
+			if lvl.XMLName.Local != "lvl" || err != nil || level < 0 || level > maxListLevel {
+				continue
+			}
+			if format := lvl.child("numFmt"); format != nil {
+				formats[level] = format.attr("val")
+			}
+		}
+		abstracts[n.attr("abstractNumId")] = formats
+	}
+	for _, n := range numbering.Nodes {
+		if n.XMLName.Local != "num" {
+			continue
+		}
+		if abstract := n.child("abstractNumId"); abstract != nil {
+			r.formats[n.attr("numId")] = abstracts[abstract.attr("val")]
+		}
+	}
+}
+
+// paragraphType is the type of bloc for a paragraph style, following the
+// styles it is based on. Styles are matched on their name since their ids
+// change with the language of Word.
+func (r *docxReader) paragraphType(styleId string) (string, int) {
+	for range 10 {
+		style, ok := r.styles[styleId]
+		name := style.name
+		if !ok {
+			name = strings.ToLower(styleId)
+		}
+		var level int
+		if _, err := fmt.Sscanf(strings.ReplaceAll(name, " ", ""), "heading%d", &level); err == nil && level >= 1 {
+			return HeadingBloc, min(level, maxHeadingLevel)
+		}
+		switch {
+		case name == "title":
+			return HeadingBloc, 1
+		case name == "subtitle":
+			return HeadingBloc, 2
+		case name == "quote" || name == "intense quote" || name == "block text":
+			return QuoteBloc, 0
+		case strings.Contains(name, "code") || strings.Contains(name, "preformatted") || name == "source":
+			return CodeBloc, 0
+		case strings.HasPrefix(name, "list bullet"):
+			return BulletedListBloc, 0
+		case strings.HasPrefix(name, "list number"):
+			return NumberedListBloc, 0
+		}
+		if !ok || style.basedOn == "" {
+			break
+		}
+		styleId = style.basedOn
+	}
+	return ParagraphBloc, 0
+}
+
+// blocks adds the blocs of the paragraphs and tables of a body.
+func (r *docxReader) blocks(body *xmlNode) {
+	for i := range body.Nodes {
+		n := &body.Nodes[i]
+		switch n.XMLName.Local {
+		case "p":
+			r.paragraph(n)
+		case "tbl":
+			r.table(n)
+		case "sdt":
+			if content := n.child("sdtContent"); content != nil {
+				r.blocks(content)
+			}
+		case "customXml", "ins", "moveTo":
+			r.blocks(n)
+		case "del", "moveFrom":
+			r.lose(lossTrackedChange)
+		case "oMathPara", "oMath":
+			r.lose(lossEquations)
+		}
+	}
+}
+
+func (r *docxReader) paragraph(p *xmlNode) {
+	b := Bloc{Type: ParagraphBloc}
+	pPr := p.child("pPr")
+	numbered := false
+	if pPr != nil {
+		if style := pPr.child("pStyle"); style != nil {
+			b.Type, b.Attrs.Level = r.paragraphType(style.attr("val"))
+		}
+		if outline := pPr.child("outlineLvl"); outline != nil && b.Type == ParagraphBloc {
+			if level, err := strconv.Atoi(outline.attr("val")); err == nil && level < maxHeadingLevel {
+				b.Type, b.Attrs.Level = HeadingBloc, level+1
+			}
+		}
+		if numPr := pPr.child("numPr"); numPr != nil && b.Type != HeadingBloc {
+			level := 0
+			if ilvl := numPr.child("ilvl"); ilvl != nil {
+				level, _ = strconv.Atoi(ilvl.attr("val"))
+			}
+			level = min(max(level, 0), maxListLevel)
+			if numId := numPr.child("numId"); numId != nil && numId.attr("val") != "0" {
+				numbered = true
+				b.Type, b.Attrs.Level = BulletedListBloc, level
+				if formats := r.formats[numId.attr("val")]; formats != nil && formats[level] != "bullet" && formats[level] != "none" && formats[level] != "" {
+					b.Type = NumberedListBloc
+				}
+			}
+		}
+	}
+	var images []*xmlNode
+	runs := r.inline(p, "", &images)
+	for _, run := range runs {
+		start := runeLen(b.Text)
+		b.Text += run.text
+		for _, m := range run.marks {
+			m.Start, m.End = start, start+runeLen(run.text)
+			b.Marks = append(b.Marks, m)
+		}
+	}
+	b.Marks = normalizeMarks(b.Marks)
+
+	if strings.TrimSpace(b.Text) == "" && len(images) == 1 {
+		if image, ok := r.image(images[0]); ok {
+			r.blocs = append(r.blocs, image)
+			return
+		}
+	}
+	if len(images) > 0 {
+		r.lose(lossInlineImages)
+	}
+	if b.Text == "" && pPr.child("pBdr").child("bottom") != nil {
+		r.blocs = append(r.blocs, Bloc{Type: RuleBloc})
+		return
+	}
+	// checklist items start with a checkbox, from a content control or typed
+	if checked, n, ok := cutCheckbox(b.Text); ok {
+		level := 0
+		if numbered {
+			level = b.Attrs.Level
+		} else if ind := pPr.child("ind"); ind != nil {
+			if left, err := strconv.Atoi(cmp.Or(ind.attr("left"), ind.attr("start"))); err == nil {
+				level = min(max(left/docxListIndent-1, 0), maxListLevel)
+			}
+		}
+		b.Text = string([]rune(b.Text)[n:])
+		b.Marks = deleteMarks(b.Marks, 0, n)
+		b.Type = ChecklistBloc
+		b.Attrs = BlocAttrs{Level: level, Checked: checked}
+		r.blocs = append(r.blocs, b)
+		return
+	}
+	if b.Type == CodeBloc {
+		b.Marks = nil
+	}
+	r.blocs = append(r.blocs, b)
+}
+
+// cutCheckbox reports whether text starts with a checkbox and how many
+// characters to remove with the space after it.
+func cutCheckbox(text string) (bool, int, bool) {
+	for _, box := range []string{"☐", "☒", "☑"} {
+		if rest, ok := strings.CutPrefix(text, box); ok {
+			n := 1
+			if strings.HasPrefix(rest, " ") {
+				n++
+			}
+			return box != "☐", n, true
+		}
+	}
+	return false, 0, false
+}
+
+// inline reads the runs of a paragraph, or of an element inside one, with
+// the link they are in. Drawings are collected in images.
+func (r *docxReader) inline(n *xmlNode, link string, images *[]*xmlNode) []docxRun {
+	var runs []docxRun
+	for i := range n.Nodes {
+		c := &n.Nodes[i]
+		switch c.XMLName.Local {
+		case "r":
+			runs = append(runs, r.run(c, link, images)...)
+		case "hyperlink":
+			target := ""
+			if rel, ok := r.rels[c.attr("id")]; ok && rel.external && validLink(rel.target) {
+				target = rel.target
+			}
+			runs = append(runs, r.inline(c, target, images)...)
+		case "ins", "moveTo", "smartTag", "customXml", "fldSimple", "bdo", "dir":
+			runs = append(runs, r.inline(c, link, images)...)
+		case "sdt":
+			if content := c.child("sdtContent"); content != nil {
+				runs = append(runs, r.inline(content, link, images)...)
+			}
+		case "del", "moveFrom":
+			r.lose(lossTrackedChange)
+		case "oMath", "oMathPara":
+			r.lose(lossEquations)
+		}
+	}
+	return runs
+}
+
+func (r *docxReader) run(n *xmlNode, link string, images *[]*xmlNode) []docxRun {
+	var marks []Mark
+	if rPr := n.child("rPr"); rPr != nil {
+		marks = r.runMarks(rPr)
+	}
+	if link != "" {
+		marks = append(marks, Mark{Type: LinkMark, Value: link})
+	}
+	var sb strings.Builder
+	var walk func(n *xmlNode)
+	walk = func(n *xmlNode) {
+		for i := range n.Nodes {
+			c := &n.Nodes[i]
+			switch c.XMLName.Local {
+			case "t":
+				sb.WriteString(c.Content)
+			case "tab", "ptab":
+				sb.WriteString("\t")
+			case "br", "cr":
+				sb.WriteString("\n")
+			case "noBreakHyphen":
+				sb.WriteString("-")
+			case "drawing":
+				if c.find("txbx") != nil {
+					r.lose(lossShapes)
+				} else {
+					*images = append(*images, c)
+				}
+			case "pict", "object":
+				r.lose(lossShapes)
+			case "footnoteReference", "endnoteReference":
+				r.lose(lossNotes)
+			case "commentReference":
+				r.lose(lossComments)
+			case "AlternateContent":
+				if choice := c.child("Choice"); choice != nil {
+					walk(choice)
+				}
+			}
+		}
+	}
+	walk(n)
+	if sb.Len() == 0 {
+		return nil
+	}
+	return []docxRun{{text: sb.String(), marks: marks}}
+}
+
+// runMarks maps run properties to marks, without offsets.
+func (r *docxReader) runMarks(rPr *xmlNode) []Mark {
+	var marks []Mark
+	code := false
+	for i := range rPr.Nodes {
+		p := &rPr.Nodes[i]
+		switch p.XMLName.Local {
+		case "b":
+			if p.on() {
+				marks = append(marks, Mark{Type: BoldMark})
+			}
+		case "i":
+			if p.on() {
+				marks = append(marks, Mark{Type: ItalicMark})
+			}
+		case "u":
+			if p.on() {
+				marks = append(marks, Mark{Type: UnderlineMark})
+			}
+		case "strike", "dstrike":
+			if p.on() {
+				marks = append(marks, Mark{Type: StrikeMark})
+			}
+		case "color":
+			if value := p.attr("val"); len(value) == 6 && colorValue.MatchString("#"+value) {
+				marks = append(marks, Mark{Type: ColorMark, Value: "#" + strings.ToLower(value)})
+			}
+		case "rFonts":
+			font := cmp.Or(p.attr("ascii"), p.attr("hAnsi"))
+			switch {
+			case font == "":
+			case pdfFontFamily(font) == courier:
+				code = true
+			case fontValue.MatchString(font):
+				marks = append(marks, Mark{Type: FontMark, Value: font})
+			default:
+				r.lose(lossFonts)
+			}
+		case "highlight":
+			if p.attr("val") != "none" {
+				r.lose(lossHighlight)
+			}
+		}
+	}
+	if code {
+		marks = append(marks, Mark{Type: CodeMark})
+	}
+	return marks
+}
+
+// image makes an image bloc of a drawing, the picture is kept inline as a
+// data url.
+func (r *docxReader) image(drawing *xmlNode) (Bloc, bool) {
+	blip := drawing.find("blip")
+	if blip == nil {
+		r.lose(lossShapes)
+		return Bloc{}, false
+	}
+	rel, ok := r.rels[blip.attr("embed")]
+	if !ok || rel.external {
+		r.lose(lossImages)
+		return Bloc{}, false
+	}
+	format := strings.ToLower(strings.TrimPrefix(path.Ext(rel.target), "."))
+	if format == "jpg" {
+		format = "jpeg"
+	}
+	if _, ok := docxImageTypes[format]; !ok {
+		r.lose(lossImages)
+		return Bloc{}, false
+	}
+	data, err := r.file(rel.target)
+	if err != nil {
+		r.lose(lossImages)
+		return Bloc{}, false
+	}
+	src := "data:image/" + format + ";base64," + base64.StdEncoding.EncodeToString(data)
+	// the images of a document share the room for its content
+	if len(src) > maxImageSrc || r.imageBytes+len(src) > MaxDocumentSize {
+		r.lose(lossImages)
+		return Bloc{}, false
+	}
+	r.imageBytes += len(src)
+	b := Bloc{Type: ImageBloc, Attrs: BlocAttrs{Src: src}}
+	if docPr := drawing.find("docPr"); docPr != nil {
+		b.Attrs.Alt = docPr.attr("descr")
+	}
+	if extent := drawing.find("extent"); extent != nil {
+		cx, _ := strconv.Atoi(extent.attr("cx"))
+		cy, _ := strconv.Atoi(extent.attr("cy"))
+		b.Attrs.Width, b.Attrs.Height = max(cx/emuPerPixel, 0), max(cy/emuPerPixel, 0)
+	}
+	return b, true
+}
+
+// table reads the text of the cells, a table in a cell is flattened into
+// it.
+func (r *docxReader) table(tbl *xmlNode) {
+	var rows [][]string
+	width := 0
+	for i := range tbl.Nodes {
+		tr := &tbl.Nodes[i]
+		if tr.XMLName.Local != "tr" {
+			continue
+		}
+		var row []string
+		for j := range tr.Nodes {
+			tc := &tr.Nodes[j]
+			if tc.XMLName.Local != "tc" {
+				continue
+			}
+			row = append(row, r.cellText(tc))
+			if tcPr := tc.child("tcPr"); tcPr != nil {
+				if span := tcPr.child("gridSpan"); span != nil {
+					n, _ := strconv.Atoi(span.attr("val"))
+					for k := 1; k < n && len(row) < maxTableCells; k++ {
+						row = append(row, "")
+					}
+					r.lose(lossMergedCells)
+				}
+				if tcPr.child("vMerge") != nil {
+					r.lose(lossMergedCells)
+				}
+			}
+		}
+		width = max(width, len(row))
+		rows = append(rows, row)
+	}
+	if width == 0 {
+		return
+	}
+	for i := range rows {
+		for len(rows[i]) < width {
+			rows[i] = append(rows[i], "")
+		}
+	}
+	r.blocs = append(r.blocs, Bloc{Type: TableBloc, Attrs: BlocAttrs{Rows: rows}})
+}
+
+func (r *docxReader) cellText(tc *xmlNode) string {
+	var lines []string
+	for i := range tc.Nodes {
+		c := &tc.Nodes[i]
+		switch c.XMLName.Local {
+		case "p":
+			var images []*xmlNode
+			var sb strings.Builder
+			for _, run := range r.inline(c, "", &images) {
+				sb.WriteString(run.text)
+				if len(run.marks) > 0 {
+					r.lose(lossCellFormat)
+				}
+			}
+			if len(images) > 0 {
+				r.lose(lossInlineImages)
+			}
+			lines = append(lines, sb.String())
+		case "tbl":
+			r.lose(lossNestedTables)
+			for j := range c.Nodes {
+				if c.Nodes[j].XMLName.Local != "tr" {
+					continue
+				}
+				var cells []string
+				for k := range c.Nodes[j].Nodes {
+					if c.Nodes[j].Nodes[k].XMLName.Local == "tc" {
+						cells = append(cells, r.cellText(&c.Nodes[j].Nodes[k]))
+					}
+				}
+				lines = append(lines, strings.Join(cells, "\t"))
+			}
+		case "sdt":
+			if content := c.child("sdtContent"); content != nil {
+				lines = append(lines, r.cellText(content))
+			}
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,234 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+type exportFormat struct {
+	contentType string
+	extension   string
+	render      func(doc Document, name string, options url.Values) ([]byte, error)
+}
+
+// exportFormats are the formats documents can be exported to, by the name
+// given in the format parameter.
+var exportFormats = map[string]exportFormat{
+	"markdown": {
+		contentType: "text/markdown; charset=utf-8",
+		extension:   ".md",
+		render: func(doc Document, _ string, _ url.Values) ([]byte, error) {
+			return RenderMarkdown(doc), nil
+		},
+	},
+	"html": {
+		contentType: "text/html; charset=utf-8",
+		extension:   ".html",
+		render: func(doc Document, name string, _ url.Values) ([]byte, error) {
+			return RenderHTML(doc, name), nil
+		},
+	},
+	"pdf": {
+		contentType: "application/pdf",
+		extension:   ".pdf",
+		render: func(doc Document, name string, options url.Values) ([]byte, error) {
+			pdfOptions, err := ParsePDFOptions(options)
+			if err != nil {
+				return nil, err
+			}
+			return RenderPDF(doc, name, pdfOptions)
+		},
+	},
+	"docx": {
+		contentType: docxContentType,
+		extension:   ".docx",
+		render: func(doc Document, name string, _ url.Values) ([]byte, error) {
+			return RenderDOCX(doc, name)
+		},
+	},
+	"odt": {
+		contentType: odtContentType,
+		extension:   ".odt",
+		render: func(doc Document, name string, _ url.Values) ([]byte, error) {
+			return RenderODT(doc, name)
+		},
+	},
+	"text": {
+		contentType: "text/plain; charset=utf-8",
+		extension:   ".txt",
+		render: func(doc Document, _ string, _ url.Values) ([]byte, error) {
+			return RenderText(doc), nil
+		},
+	},
+}
+
+// importFormats are the formats documents can be created from, parsers
+// return what the document could not keep.
+var importFormats = map[string]func(data []byte) (Document, []string, error){
+	"markdown": func(data []byte) (Document, []string, error) {
+		doc, err := ParseMarkdown(data)
+		return doc, nil, err
+	},
+	"docx": ParseDOCX,
+}
+
+// importExtensions give the format of an uploaded file without format
+// parameter.
+var importExtensions = map[string]string{
+	".md":       "markdown",
+	".markdown": "markdown",
+	".docx":     "docx",
+}
+
+// RenderDocument writes a document in one of the export formats, name is the
+// name of the document which some formats use as a title. The options are
+// those of the format, like the page settings of a pdf.
+func RenderDocument(doc Document, name, format string, options url.Values) ([]byte, error) {
+	f, ok := exportFormats[format]
+	if !ok {
+		return nil, fmt.Errorf("400: unsupported format %q", format)
+	}
+	return f.render(doc, name, options)
+}
+
+// ExportHandler sends the current content of a document in the format asked
+// for, as a file to download.
+func (cfg *ApiConfig) ExportHandler(w http.ResponseWriter, r *http.Request) {
+	userId, documentId, err := getDocumentAndUserFromUrl(r)
+	if err != nil {
+		RespondWithError(w, ParseStatusFromError(err), err.Error())
+		return
+	}
+	if _, err := cfg.GetUserRole(r.Context(), userId, documentId); err != nil {
+		RespondWithError(w, ParseStatusFromError(err), err.Error())
+		return
+	}
+	format, ok := exportFormats[r.URL.Query().Get("format")]
+	if !ok {
+		RespondWithError(w, 400, "unsupported format")
+		return
+	}
+	document, err := cfg.Db.GetDocument(r.Context(), documentId)
+	if err != nil {
+		RespondWithError(w, 500, err.Error())
+		return
+	}
+	doc, err := cfg.LoadDocument(r.Context(), documentId)
+	if err != nil {
+		RespondWithError(w, 500, err.Error())
+		return
+	}
+	data, err := format.render(doc, document.Name, r.URL.Query())
+	if err != nil {
+		RespondWithError(w, ParseStatusFromError(err), err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", format.contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{
+		"filename": exportFileName(document.Name) + format.extension,
+	}))
+	w.WriteHeader(200)
+	w.Write(data)
+}
+
+// ImportHandler creates a document owned by the caller from a file, sent as
+// the "file" field of a multipart form or as the whole body. The name comes
+// from the "name" field or parameter, or from the file name, and the format
+// from the format parameter, or from the file extension, markdown otherwise.
+// The warnings of the response list what the import could not keep.
+func (cfg *ApiConfig) ImportHandler(w http.ResponseWriter, r *http.Request) {
+	type responseBody struct {
+		Id       uuid.UUID `json:"id"`
+		Name     string    `json:"name"`
+		OwnerId  string    `json:"owner_id"`
+		Warnings []string  `json:"warnings,omitempty"`
+	}
+	userId, err := GetUserIdFromContext(r.Context())
+	if err != nil {
+		RespondWithError(w, 401, err.Error())
+		return
+	}
+	format := r.URL.Query().Get("format")
+	r.Body = http.MaxBytesReader(w, r.Body, MaxDocumentSize)
+	defer r.Body.Close()
+	name := r.URL.Query().Get("name")
+	var data []byte
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			RespondWithError(w, 400, err.Error())
+			return
+		}
+		defer file.Close()
+		data, err = io.ReadAll(file)
+		if err != nil {
+			RespondWithError(w, 400, err.Error())
+			return
+		}
+		if formName := r.FormValue("name"); formName != "" {
+			name = formName
+		} else if name == "" {
+			name = strings.TrimSuffix(header.Filename, filepath.Ext(header.Filename))
+		}
+		if format == "" {
+			format = importExtensions[strings.ToLower(filepath.Ext(header.Filename))]
+		}
+	} else {
+		data, err = io.ReadAll(r.Body)
+		if err != nil {
+			RespondWithError(w, 400, err.Error())
+			return
+		}
+	}
+	if name == "" {
+		name = "Imported document"
+	}
+	if format == "" {
+		format = "markdown"
+	}
+	parse, ok := importFormats[format]
+	if !ok {
+		RespondWithError(w, 400, "unsupported format")
+		return
+	}
+	doc, warnings, err := parse(data)
+	if err != nil {
+		RespondWithError(w, 400, err.Error())
+		return
+	}
+	document, err := cfg.createDocument(r.Context(), userId, uuid.NullUUID{}, name, doc)
+	if err != nil {
+		RespondWithError(w, 500, err.Error())
+		return
+	}
+	RespondWithJson(w, 201, responseBody{
+		Id:       document.ID,
+		Name:     document.Name,
+		OwnerId:  document.OwnerID.UUID.String(),
+		Warnings: warnings,
+	})
+}
+
+// exportFileName keeps the characters of a document name that are safe in a
+// file name.
+func exportFileName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == ' ', r == '.':
+			return r
+		}
+		return '_'
+	}, name)
+	name = strings.Trim(name, " .")
+	if name == "" {
+		return "document"
+	}
+	return name
+}
@@ -0,0 +1,451 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/ahmedjebari022/go-docs/internal/database"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+)
+
+// Folders hold documents and other folders of their owner. Sharing a folder
+// grants its role on every document below it, GetUserPermission resolves the
+// strongest of the roles granted on a document and on its folders.
+
+type folderResponse struct {
+	Id       uuid.UUID  `json:"id"`
+	Name     string     `json:"name"`
+	OwnerId  uuid.UUID  `json:"owner_id"`
+	ParentId *uuid.UUID `json:"parent_id"`
+}
+
+type folderDocumentResponse struct {
+	Id        uuid.UUID `json:"id"`
+	Name      string    `json:"name"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func newFolderResponse(f database.Folder) folderResponse {
+	res := folderResponse{Id: f.ID, Name: f.Name, OwnerId: f.OwnerID}
+	if f.ParentID.Valid {
+		res.ParentId = &f.ParentID.UUID
+	}
+	return res
+}
+
+// getFolderFromUrl loads the folder named in the url and the role of the user
+// on it, granted on the folder or on one of its ancestors. Errors carry their
+// http status.
+func (cfg *ApiConfig) getFolderFromUrl(r *http.Request) (userId uuid.UUID, folder database.Folder, role string, err error) {
+	userId, err = GetUserIdFromContext(r.Context())
+	if err != nil {
+		return uuid.Nil, database.Folder{}, "", fmt.Errorf("401: not authenticated")
+	}
+	folderId, err := uuid.Parse(r.PathValue("folderId"))
+	if err != nil {
+		return uuid.Nil, database.Folder{}, "", fmt.Errorf("400: invalid folder id")
+	}
+	folder, err = cfg.Db.GetFolder(r.Context(), folderId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return uuid.Nil, database.Folder{}, "", fmt.Errorf("404: folder not found")
+	}
+	if err != nil {
+		return uuid.Nil, database.Folder{}, "", fmt.Errorf("500: %s", err.Error())
+	}
+	if folder.OwnerID == userId {
+		return userId, folder, OwnerRole, nil
+	}
+	role, err = cfg.Db.GetFolderRole(r.Context(), database.GetFolderRoleParams{
+		FolderID: folder.ID,
+		UserID:   userId,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return uuid.Nil, database.Folder{}, "", fmt.Errorf("403: not authorized")
+	}
+	if err != nil {
+		return uuid.Nil, database.Folder{}, "", fmt.Errorf("500: %s", err.Error())
+	}
+	return userId, folder, role, nil
+}
+
+// ownFolder checks a folder a user puts something in is one of theirs, nil
+// standing for the root.
+func (cfg *ApiConfig) ownFolder(r *http.Request, userId uuid.UUID, folderId *uuid.UUID) (uuid.NullUUID, error) {
+	if folderId == nil {
+		return uuid.NullUUID{}, nil
+	}
+	folder, err := cfg.Db.GetFolder(r.Context(), *folderId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return uuid.NullUUID{}, fmt.Errorf("404: folder not found")
+	}
+	if err != nil {
+		return uuid.NullUUID{}, fmt.Errorf("500: %s", err.Error())
+	}
+	if folder.OwnerID != userId {
+		return uuid.NullUUID{}, fmt.Errorf("403: not the owner of the folder")
+	}
+	return uuid.NullUUID{UUID: folder.ID, Valid: true}, nil
+}
+
+func (cfg *ApiConfig) CreateFolderHandler(w http.ResponseWriter, r *http.Request) {
+	type requestBody struct {
+		Name     string     `json:"name" validate:"required,max=255"`
+		ParentId *uuid.UUID `json:"parent_id"`
+	}
+	userId, err := GetUserIdFromContext(r.Context())
+	if err != nil {
+		RespondWithError(w, 401, err.Error())
+		return
+	}
+	var params requestBody
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&params); err != nil {
+		RespondWithError(w, 400, err.Error())
+		return
+	}
+	defer r.Body.Close()
+	validate := validator.New(validator.WithRequiredStructEnabled())
+	if err := validate.Struct(params); err != nil {
+		RespondWithError(w, 400, err.Error())
+		return
+	}
+	parent, err := cfg.ownFolder(r, userId, params.ParentId)
+	if err != nil {
+		RespondWithError(w, ParseStatusFromError(err), err.Error())
+		return
+	}
+	folder, err := cfg.Db.CreateFolder(r.Context(), database.CreateFolderParams{
+		ID:       uuid.New(),
+		Name:     params.Name,
+		OwnerID:  userId,
+		ParentID: parent,
+	})
+	if err != nil {
+		RespondWithError(w, 500, err.Error())
+		return
+	}
+	RespondWithJson(w, http.StatusCreated, newFolderResponse(folder))
+}
+
+// GetFoldersHandler lists the root of the user: their top level folders and
+// the documents outside of folders, along with the folders shared with them.
+func (cfg *ApiConfig) GetFoldersHandler(w http.ResponseWriter, r *http.Request) {
+	type sharedFolder struct {
+		folderResponse
+		Role string `json:"role"`
+	}
+	type responseBody struct {
+		Folders   []folderResponse         `json:"folders"`
+		Documents []folderDocumentResponse `json:"documents"`
+		Shared    []sharedFolder           `json:"shared"`
+	}
+	userId, err := GetUserIdFromContext(r.Context())
+	if err != nil {
+		RespondWithError(w, 401, err.Error())
+		return
+	}
+	folders, err := cfg.Db.GetRootFoldersByOwner(r.Context(), userId)
+	if err != nil {
+		RespondWithError(w, 500, err.Error())
+		return
+	}
+	documents, err := cfg.Db.GetRootDocumentsByOwner(r.Context(), uuid.NullUUID{UUID: userId, Valid: true})
+	if err != nil {
+		RespondWithError(w, 500, err.Error())
+		return
+	}
+	shared, err := cfg.Db.GetSharedFolders(r.Context(), userId)
+	if err != nil {
+		RespondWithError(w, 500, err.Error())
+		return
+	}
+	res := responseBody{
+		Folders:   []folderResponse{},
+		Documents: []folderDocumentResponse{},
+		Shared:    []sharedFolder{},
+	}
+	for _, f := range folders {
+		res.Folders = append(res.Folders, newFolderResponse(f))
+	}
+	for _, d := range documents {
+		res.Documents = append(res.Documents, folderDocumentResponse{Id: d.ID, Name: d.Name, UpdatedAt: d.UpdatedAt})
+	}
+	for _, f := range shared {
+		res.Shared = append(res.Shared, sharedFolder{
+			folderResponse: folderResponse{Id: f.ID, Name: f.Name, OwnerId: f.OwnerID},
+			Role:           f.Role,
+		})
+	}
+	RespondWithJson(w, 200, res)
+}
+
+// GetFolderHandler lists the folders and documents of a folder.
+func (cfg *ApiConfig) GetFolderHandler(w http.ResponseWriter, r *http.Request) {
+	type responseBody struct {
+		folderResponse
+		Role      string                   `json:"role"`
+		Folders   []folderResponse         `json:"folders"`
+		Documents []folderDocumentResponse `json:"documents"`
+	}
+	_, folder, role, err := cfg.getFolderFromUrl(r)
+	if err != nil {
+		RespondWithError(w, ParseStatusFromError(err), err.Error())
+		return
+	}
+	parent := uuid.NullUUID{UUID: folder.ID, Valid: true}
+	folders, err := cfg.Db.GetChildFolders(r.Context(), parent)
+	if err != nil {
+		RespondWithError(w, 500, err.Error())
+		return
+	}
+	documents, err := cfg.Db.GetDocumentsInFolder(r.Context(), parent)
+	if err != nil {
+		RespondWithError(w, 500, err.Error())
+		return
+	}
+	res := responseBody{
+		folderResponse: newFolderResponse(folder),
+		Role:           role,
+		Folders:        []folderResponse{},
+		Documents:      []folderDocumentResponse{},
+	}
+	for _, f := range folders {
+		res.Folders = append(res.Folders, newFolderResponse(f))
+	}
+	for _, d := range documents {
+		res.Documents = append(res.Documents, folderDocumentResponse{Id: d.ID, Name: d.Name, UpdatedAt: d.UpdatedAt})
+	}
+	RespondWithJson(w, 200, res)
+}
+
+// UpdateFolderHandler renames a folder and moves it under another folder of
+// its owner, or to the root when parent_id is null.
+func (cfg *ApiConfig) UpdateFolderHandler(w http.ResponseWriter, r *http.Request) {
+	type requestBody struct {
+		Name     string     `json:"name" validate:"required,max=255"`
+		ParentId *uuid.UUID `json:"parent_id"`
+	}
+	userId, folder, role, err := cfg.getFolderFromUrl(r)
+	if err != nil {
+		RespondWithError(w, ParseStatusFromError(err), err.Error())
+		return
+	}
+	if role != OwnerRole {
+		RespondWithError(w, 403, "not the owner of the folder")
+		return
+	}
+	var params requestBody
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&params); err != nil {
+		RespondWithError(w, 400, err.Error())
+		return
+	}
+	defer r.Body.Close()
+	validate := validator.New(validator.WithRequiredStructEnabled())
+	if err := validate.Struct(params); err != nil {
+		RespondWithError(w, 400, err.Error())
+		return
+	}
+	parent, err := cfg.ownFolder(r, userId, params.ParentId)
+	if err != nil {
+		RespondWithError(w, ParseStatusFromError(err), err.Error())
+		return
+	}
+
+	// two moves checked at once could make a loop, serializing them makes
+	// one fail instead
+	tx, err := cfg.DbC.BeginTx(r.Context(), &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		RespondWithError(w, 500, err.Error())
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.Db.WithTx(tx)
+	if parent.Valid {
+		within, err := qtx.IsFolderWithin(r.Context(), database.IsFolderWithinParams{
+			FolderID:   parent.UUID,
+			AncestorID: folder.ID,
+		})
+		if err != nil {
+			RespondWithError(w, 500, err.Error())
+			return
+		}
+		if within {
+			RespondWithError(w, 400, "a folder cannot be moved inside itself")
+			return
+		}
+	}
+	err = qtx.UpdateFolder(r.Context(), database.UpdateFolderParams{
+		ID:       folder.ID,
+		Name:     params.Name,
+		ParentID: parent,
+	})
+	if err != nil {
+		RespondWithError(w, 500, err.Error())
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		RespondWithError(w, 409, "the folders changed meanwhile, try again")
+		return
+	}
+	folder.Name, folder.ParentID = params.Name, parent
+	RespondWithJson(w, 200, newFolderResponse(folder))
+}
+
+// DeleteFolderHandler deletes a folder with the folders below it. Documents
+// are never deleted along, they go back to the root of their owner.
+func (cfg *ApiConfig) DeleteFolderHandler(w http.ResponseWriter, r *http.Request) {
+	_, folder, role, err := cfg.getFolderFromUrl(r)
+	if err != nil {
+		RespondWithError(w, ParseStatusFromError(err), err.Error())
+		return
+	}
+	if role != OwnerRole {
+		RespondWithError(w, 403, "not the owner of the folder")
+		return
+	}
+	if err := cfg.Db.DeleteFolder(r.Context(), folder.ID); err != nil {
+		RespondWithError(w, 500, err.Error())
+		return
+	}
+	RespondWithJson(w, 204, struct{}{})
+}
+
+// MoveDocumentHandler puts a document in a folder of its owner, or at the
+// root when folder_id is null.
+func (cfg *ApiConfig) MoveDocumentHandler(w http.ResponseWriter, r *http.Request) {
+	type requestBody struct {
+		FolderId *uuid.UUID `json:"folder_id"`
+	}
+	userId, documentId, err := cfg.requireOwnerShip(r)
+	if err != nil {
+		RespondWithError(w, ParseStatusFromError(err), err.Error())
+		return
+	}
+	var params requestBody
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&params); err != nil {
+		RespondWithError(w, 400, err.Error())
+		return
+	}
+	defer r.Body.Close()
+	folder, err := cfg.ownFolder(r, userId, params.FolderId)
+	if err != nil {
+		RespondWithError(w, ParseStatusFromError(err), err.Error())
+		return
+	}
+	err = cfg.Db.MoveDocument(r.Context(), database.MoveDocumentParams{
+		ID:       documentId,
+		FolderID: folder,
+	})
+	if err != nil {
+		RespondWithError(w, 500, err.Error())
+		return
+	}
+	RespondWithJson(w, 204, struct{}{})
+}
+
+func (cfg *ApiConfig) GetFolderCollaboratorsHandler(w http.ResponseWriter, r *http.Request) {
+	type userRole struct {
+		Id    uuid.UUID `json:"id"`
+		Email string    `json:"email"`
+		Role  string    `json:"role"`
+	}
+	type responseBody struct {
+		Collaborators []userRole `json:"collaborators"`
+	}
+	_, folder, _, err := cfg.getFolderFromUrl(r)
+	if err != nil {
+		RespondWithError(w, ParseStatusFromError(err), err.Error())
+		return
+	}
+	users, err := cfg.Db.GetUsersFromFolder(r.Context(), folder.ID)
+	if err != nil {
+		RespondWithError(w, 500, err.Error())
+		return
+	}
+	res := responseBody{Collaborators: []userRole{}}
+	for _, u := range users {
+		res.Collaborators = append(res.Collaborators, userRole{Id: u.ID, Email: u.Email, Role: u.Role})
+	}
+	RespondWithJson(w, 200, res)
+}
+
+// SetFolderCollaboratorHandler shares a folder with a user, or changes the
+// role they were given.
+func (cfg *ApiConfig) SetFolderCollaboratorHandler(w http.ResponseWriter, r *http.Request) {
+	type requestBody struct {
+		UserId uuid.UUID `json:"user_id"`
+		Role   string    `json:"role"`
+	}
+	userId, folder, role, err := cfg.getFolderFromUrl(r)
+	if err != nil {
+		RespondWithError(w, ParseStatusFromError(err), err.Error())
+		return
+	}
+	if role != OwnerRole {
+		RespondWithError(w, 403, "not the owner of the folder")
+		return
+	}
+	var params requestBody
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&params); err != nil {
+		RespondWithError(w, 400, err.Error())
+		return
+	}
+	defer r.Body.Close()
+	if params.Role != EditorRole && params.Role != ViewerRole {
+		RespondWithError(w, 400, "wrong role value")
+		return
+	}
+	if params.UserId == userId {
+		RespondWithError(w, 400, "the owner already has every right")
+		return
+	}
+	err = cfg.Db.SetFolderPermission(r.Context(), database.SetFolderPermissionParams{
+		UserID:   params.UserId,
+		FolderID: folder.ID,
+		Role:     params.Role,
+	})
+	if err != nil {
+		RespondWithError(w, 500, err.Error())
+		return
+	}
+	RespondWithJson(w, 200, struct{}{})
+}
+
+func (cfg *ApiConfig) DeleteFolderCollaboratorHandler(w http.ResponseWriter, r *http.Request) {
+	type requestBody struct {
+		Id uuid.UUID `json:"id"`
+	}
+	_, folder, role, err := cfg.getFolderFromUrl(r)
+	if err != nil {
+		RespondWithError(w, ParseStatusFromError(err), err.Error())
+		return
+	}
+	if role != OwnerRole {
+		RespondWithError(w, 403, "not the owner of the folder")
+		return
+	}
+	var params requestBody
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&params); err != nil {
+		RespondWithError(w, 400, err.Error())
+		return
+	}
+	defer r.Body.Close()
+	err = cfg.Db.DeleteFolderPermission(r.Context(), database.DeleteFolderPermissionParams{
+		UserID:   params.Id,
+		FolderID: folder.ID,
+	})
+	if err != nil {
+		RespondWithError(w, 500, err.Error())
+		return
+	}
+	RespondWithJson(w, 204, struct{}{})
+}
@@ -0,0 +1,267 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// fontWeight are the weights written to css, anything else in the style of a
+// bloc is dropped.
+var fontWeight = regexp.MustCompile(`^(normal|bold|bolder|lighter|[1-9]00)$`)
+
+// htmlMarks are the marks html can write, in the order they are nested.
+var htmlMarks = []string{LinkMark, BoldMark, ItalicMark, UnderlineMark, StrikeMark, ColorMark, FontMark, CodeMark}
+
+const htmlStyle = `body { font-family: sans-serif; line-height: 1.5; max-width: 50em; margin: 2em auto; padding: 0 1em; color: #1f2328; }
+p, h1, h2, h3, h4, h5, h6, li, blockquote p { white-space: pre-wrap; }
+blockquote { margin: 1em 0; padding: 0 1em; color: #59636e; border-left: 0.25em solid #d1d9e0; }
+pre { padding: 1em; overflow: auto; background: #f6f8fa; border-radius: 6px; }
+code { font-family: monospace; background: #f6f8fa; padding: 0.1em 0.3em; border-radius: 4px; }
+pre code { padding: 0; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #d1d9e0; padding: 0.3em 0.8em; }
+th { background: #f6f8fa; }
+ul.checklist { list-style: none; padding-left: 1.2em; }
+img { max-width: 100%; }
+hr { border: 0; border-top: 1px solid #d1d9e0; }
+`
+
+// RenderHTML writes the document as a standalone html page titled with the
+// name of the document. All text is escaped, and colours, fonts, links and
+// image sources are only written when they pass the same checks as marks,
+// so a document cannot inject markup, css or scripts.
+func RenderHTML(doc Document, title string) []byte {
+	var out bytes.Buffer
+	out.WriteString("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n")
+	out.WriteString("<meta name=\"viewport\" content=\"width=device-width, initial-scale=1\">\n")
+	fmt.Fprintf(&out, "<title>%s</title>\n<style>\n%s</style>\n</head>\n<body>\n", html.EscapeString(title), htmlStyle)
+	// lists holds the open lists, the item of the last one is still open so
+	// that nested lists go inside it
+	type openList struct {
+		tag   string
+		class string
+		level int
+	}
+	var lists []openList
+	closeLists := func(keep func(l openList) bool) {
+		for len(lists) > 0 && !keep(lists[len(lists)-1]) {
+			fmt.Fprintf(&out, "</li></%s>\n", lists[len(lists)-1].tag)
+			lists = lists[:len(lists)-1]
+		}
+	}
+	inQuote := false
+	for _, b := range doc.Blocs {
+		kind := b.Kind()
+		if kind != BulletedListBloc && kind != NumberedListBloc && kind != ChecklistBloc {
+			closeLists(func(openList) bool { return false })
+		}
+		if kind != QuoteBloc && inQuote {
+			out.WriteString("</blockquote>\n")
+			inQuote = false
+		}
+		style := htmlStyling(b.Style)
+		switch kind {
+		case HeadingBloc:
+			level := min(max(b.Attrs.Level, 1), maxHeadingLevel)
+			fmt.Fprintf(&out, "<h%d%s>%s</h%d>\n", level, style, htmlInline(b), level)
+		case BulletedListBloc, NumberedListBloc, ChecklistBloc:
+			list := openList{tag: "ul", level: b.Attrs.Level}
+			switch kind {
+			case NumberedListBloc:
+				list.tag = "ol"
+			case ChecklistBloc:
+				list.class = "checklist"
+			}
+			closeLists(func(l openList) bool {
+				return l.level < list.level || (l.level == list.level && l.tag == list.tag && l.class == list.class)
+			})
+			if len(lists) > 0 && lists[len(lists)-1].level == list.level {
+				out.WriteString("</li>\n")
+			} else {
+				out.WriteString("<" + list.tag)
+				if list.class != "" {
+					fmt.Fprintf(&out, " class=%q", list.class)
+				}
+				out.WriteString(">\n")
+				lists = append(lists, list)
+			}
+			fmt.Fprintf(&out, "<li%s>", style)
+			if kind == ChecklistBloc {
+				out.WriteString("<input type=\"checkbox\" disabled")
+				if b.Attrs.Checked {
+					out.WriteString(" checked")
+				}
+				out.WriteString("> ")
+			}
+			out.WriteString(htmlInline(b))
+		case QuoteBloc:
+			if !inQuote {
+				out.WriteString("<blockquote>\n")
+				inQuote = true
+			}
+			fmt.Fprintf(&out, "<p%s>%s</p>\n", style, htmlInline(b))
+		case CodeBloc:
+			out.WriteString("<pre><code")
+			if b.Attrs.Language != "" && codeLanguage.MatchString(b.Attrs.Language) {
+				fmt.Fprintf(&out, " class=\"language-%s\"", html.EscapeString(b.Attrs.Language))
+			}
+			fmt.Fprintf(&out, ">%s</code></pre>\n", html.EscapeString(b.Text))
+		case TableBloc:
+			out.WriteString("<table>\n")
+			for i, row := range b.Attrs.Rows {
+				cell := "td"
+				if i == 0 {
+					cell = "th"
+					out.WriteString("<thead>\n")
+				} else if i == 1 {
+					out.WriteString("<tbody>\n")
+				}
+				out.WriteString("<tr>")
+				for _, text := range row {
+					fmt.Fprintf(&out, "<%s>%s</%s>", cell, html.EscapeString(text), cell)
+				}
+				out.WriteString("</tr>\n")
+				if i == 0 {
+					out.WriteString("</thead>\n")
+				}
+			}
+			if len(b.Attrs.Rows) > 1 {
+				out.WriteString("</tbody>\n")
+			}
+			out.WriteString("</table>\n")
+		case RuleBloc:
+			out.WriteString("<hr>\n")
+		case ImageBloc:
+			if validateImageSrc(b.Attrs.Src) != nil {
+				continue
+			}
+			fmt.Fprintf(&out, "<figure><img src=\"%s\" alt=\"%s\"", html.EscapeString(b.Attrs.Src), html.EscapeString(b.Attrs.Alt))
+			if b.Attrs.Width > 0 {
+				fmt.Fprintf(&out, " width=\"%d\"", b.Attrs.Width)
+			}
+			if b.Attrs.Height > 0 {
+				fmt.Fprintf(&out, " height=\"%d\"", b.Attrs.Height)
+			}
+			out.WriteString("></figure>\n")
+		default:
+			fmt.Fprintf(&out, "<p%s>%s</p>\n", style, htmlInline(b))
+		}
+	}
+	closeLists(func(openList) bool { return false })
+	if inQuote {
+		out.WriteString("</blockquote>\n")
+	}
+	out.WriteString("</body>\n</html>\n")
+	return out.Bytes()
+}
+
+// htmlStyling is the style attribute for the style of a bloc, with only the
+// values that pass the checks.
+func htmlStyling(s Styling) string {
+	var rules []string
+	if s.Font != "" && fontValue.MatchString(s.Font) {
+		rules = append(rules, fmt.Sprintf("font-family: &quot;%s&quot;", html.EscapeString(s.Font)))
+	}
+	if s.Weight != "" && fontWeight.MatchString(s.Weight) {
+		rules = append(rules, "font-weight: "+s.Weight)
+	}
+	if s.Color != "" && colorValue.MatchString(s.Color) {
+		rules = append(rules, "color: "+s.Color)
+	}
+	if len(rules) == 0 {
+		return ""
+	}
+	return " style=\"" + strings.Join(rules, "; ") + "\""
+}
+
+// htmlInline writes the text of a bloc with its inline marks, the style of
+// the bloc is written on its element instead. Tags are kept open across runs
+// sharing them.
+func htmlInline(b Bloc) string {
+	b.Style = Styling{}
+	var sb strings.Builder
+	var open []Mark
+	closeTo := func(n int) {
+		for len(open) > n {
+			sb.WriteString(htmlCloser(open[len(open)-1]))
+			open = open[:len(open)-1]
+		}
+	}
+	for _, run := range b.Runs() {
+		var marks []Mark
+		for _, markType := range htmlMarks {
+			if value, ok := run.HasMark(markType); ok && htmlOpener(Mark{Type: markType, Value: value}) != "" {
+				marks = append(marks, Mark{Type: markType, Value: value})
+			}
+		}
+		kept := 0
+		for kept < len(open) && slices.Contains(marks, open[kept]) {
+			kept++
+		}
+		closeTo(kept)
+		for _, m := range marks {
+			if !slices.Contains(open, m) {
+				sb.WriteString(htmlOpener(m))
+				open = append(open, m)
+			}
+		}
+		sb.WriteString(html.EscapeString(run.Text))
+	}
+	closeTo(0)
+	return sb.String()
+}
+
+// htmlOpener is the opening tag of a mark, empty when its value does not
+// pass the checks.
+func htmlOpener(m Mark) string {
+	switch m.Type {
+	case BoldMark:
+		return "<strong>"
+	case ItalicMark:
+		return "<em>"
+	case UnderlineMark:
+		return "<u>"
+	case StrikeMark:
+		return "<s>"
+	case CodeMark:
+		return "<code>"
+	case LinkMark:
+		if !validLink(m.Value) {
+			return ""
+		}
+		return "<a href=\"" + html.EscapeString(m.Value) + "\" rel=\"noopener noreferrer nofollow\">"
+	case ColorMark:
+		if !colorValue.MatchString(m.Value) {
+			return ""
+		}
+		return "<span style=\"color: " + m.Value + "\">"
+	case FontMark:
+		if !fontValue.MatchString(m.Value) {
+			return ""
+		}
+		return "<span style=\"font-family: &quot;" + html.EscapeString(m.Value) + "&quot;\">"
+	}
+	return ""
+}
+
+func htmlCloser(m Mark) string {
+	switch m.Type {
+	case BoldMark:
+		return "</strong>"
+	case ItalicMark:
+		return "</em>"
+	case UnderlineMark:
+		return "</u>"
+	case StrikeMark:
+		return "</s>"
+	case CodeMark:
+		return "</code>"
+	case LinkMark:
+		return "</a>"
+	}
+	return "</span>"
+}
@@ -0,0 +1,315 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// JSONPatchOp is an operation of a JSON Patch (RFC 6902). Value is left nil
+// when the operation has none, a json null is kept as such.
+type JSONPatchOp struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// ApplyJSONPatch runs a JSON Patch against the json form of the document and
+// reads the result back. The document is left untouched when an operation
+// fails, errors carry their http status: 409 for a failed test, 422 for an
+// operation that does not apply, 413 as soon as the document grows past
+// MaxDocumentSize.
+func (d *Document) ApplyJSONPatch(patch []JSONPatchOp) error {
+	data, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	var root any
+	if err := json.Unmarshal(data, &root); err != nil {
+		return err
+	}
+	// size follows the values the operations add and remove, so that copies
+	// cannot grow the tree much past the limit before it is checked
+	size := len(data)
+	for i, op := range patch {
+		var grown int
+		root, grown, err = applyJSONPatchOp(root, op)
+		if err != nil {
+			return fmt.Errorf("%s (operation %d)", err.Error(), i)
+		}
+		size += grown
+		if size > MaxDocumentSize {
+			return fmt.Errorf("413: document too large")
+		}
+	}
+	data, err = json.Marshal(root)
+	if err != nil {
+		return err
+	}
+	if len(data) > MaxDocumentSize {
+		return fmt.Errorf("413: document too large")
+	}
+	var doc Document
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("422: %s", err.Error())
+	}
+	*d = doc
+	return nil
+}
+
+// applyJSONPatchOp runs op against root and returns the new root along with
+// how many bytes the encoded values it added outweigh those it removed.
+func applyJSONPatchOp(root any, op JSONPatchOp) (any, int, error) {
+	path, err := parsePointer(op.Path)
+	if err != nil {
+		return nil, 0, err
+	}
+	var value any
+	switch op.Op {
+	case "add", "replace", "test":
+		if op.Value == nil {
+			return nil, 0, fmt.Errorf("422: %s: missing value", op.Op)
+		}
+		if err := json.Unmarshal(op.Value, &value); err != nil {
+			return nil, 0, fmt.Errorf("422: %s: %s", op.Op, err.Error())
+		}
+	case "move", "copy":
+		from, err := parsePointer(op.From)
+		if err != nil {
+			return nil, 0, err
+		}
+		value, err = pointerGet(root, from)
+		if err != nil {
+			return nil, 0, err
+		}
+		if op.Op == "copy" {
+			value = copyJSON(value)
+			break
+		}
+		if op.From == op.Path {
+			return root, 0, nil
+		}
+		if strings.HasPrefix(op.Path, op.From+"/") {
+			return nil, 0, fmt.Errorf("422: move: %q is inside %q", op.Path, op.From)
+		}
+		root, err = pointerRemove(root, from)
+		if err != nil {
+			return nil, 0, err
+		}
+	case "remove":
+	default:
+		return nil, 0, fmt.Errorf("422: unknown operation %q", op.Op)
+	}
+
+	switch op.Op {
+	case "add", "copy":
+		// adding to an object replaces the member already there
+		replaced := 0
+		if len(path) == 0 {
+			replaced = encodedSize(root)
+		} else if parent, err := pointerGet(root, path[:len(path)-1]); err == nil {
+			if m, ok := parent.(map[string]any); ok {
+				if old, found := m[path[len(path)-1]]; found {
+					replaced = encodedSize(old)
+				}
+			}
+		}
+		root, err = pointerAdd(root, path, value)
+		return root, encodedSize(value) - replaced, err
+	case "move":
+		root, err = pointerAdd(root, path, value)
+		return root, 0, err
+	case "remove":
+		old, err := pointerGet(root, path)
+		if err != nil {
+			return nil, 0, err
+		}
+		root, err = pointerRemove(root, path)
+		return root, -encodedSize(old), err
+	case "replace":
+		old, err := pointerGet(root, path)
+		if err != nil {
+			return nil, 0, err
+		}
+		grown := encodedSize(value) - encodedSize(old)
+		if len(path) == 0 {
+			return value, grown, nil
+		}
+		root, err = pointerUpdate(root, path, func(parent any, token string) (any, error) {
+			if m, ok := parent.(map[string]any); ok {
+				m[token] = value
+				return m, nil
+			}
+			a := parent.([]any)
+			i, _ := strconv.Atoi(token)
+			a[i] = value
+			return a, nil
+		})
+		return root, grown, err
+	default:
+		got, err := pointerGet(root, path)
+		if err != nil {
+			return nil, 0, err
+		}
+		if !reflect.DeepEqual(got, value) {
+			return nil, 0, fmt.Errorf("409: test failed at %q", op.Path)
+		}
+		return root, 0, nil
+	}
+}
+
+// parsePointer splits a JSON Pointer (RFC 6901) in its reference tokens, the
+// empty pointer being the whole document.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("422: invalid path %q", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+	}
+	return tokens, nil
+}
+
+// arrayIndex reads the index of an array of n elements, "-" and n only
+// where appending is allowed.
+func arrayIndex(token string, n int, appending bool) (int, error) {
+	if token == "-" && appending {
+		return n, nil
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || (token != "0" && strings.HasPrefix(token, "0")) || strings.HasPrefix(token, "+") {
+		return 0, fmt.Errorf("422: invalid index %q", token)
+	}
+	if i > n || (i == n && !appending) {
+		return 0, fmt.Errorf("422: index %d out of range", i)
+	}
+	return i, nil
+}
+
+func pointerGet(node any, path []string) (any, error) {
+	for _, token := range path {
+		switch n := node.(type) {
+		case map[string]any:
+			child, ok := n[token]
+			if !ok {
+				return nil, fmt.Errorf("422: no member %q", token)
+			}
+			node = child
+		case []any:
+			i, err := arrayIndex(token, len(n), false)
+			if err != nil {
+				return nil, err
+			}
+			node = n[i]
+		default:
+			return nil, fmt.Errorf("422: %q is not in a container", token)
+		}
+	}
+	return node, nil
+}
+
+// pointerUpdate replaces the container holding the last token of path by
+// what f makes of it, along with the containers above.
+func pointerUpdate(node any, path []string, f func(parent any, token string) (any, error)) (any, error) {
+	if len(path) == 1 {
+		switch node.(type) {
+		case map[string]any, []any:
+			return f(node, path[0])
+		}
+		return nil, fmt.Errorf("422: %q is not in a container", path[0])
+	}
+	child, err := pointerGet(node, path[:1])
+	if err != nil {
+		return nil, err
+	}
+	child, err = pointerUpdate(child, path[1:], f)
+	if err != nil {
+		return nil, err
+	}
+	if m, ok := node.(map[string]any); ok {
+		m[path[0]] = child
+		return m, nil
+	}
+	a := node.([]any)
+	i, _ := strconv.Atoi(path[0])
+	a[i] = child
+	return a, nil
+}
+
+func pointerAdd(root any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	return pointerUpdate(root, path, func(parent any, token string) (any, error) {
+		if m, ok := parent.(map[string]any); ok {
+			m[token] = value
+			return m, nil
+		}
+		a := parent.([]any)
+		i, err := arrayIndex(token, len(a), true)
+		if err != nil {
+			return nil, err
+		}
+		a = append(a, nil)
+		copy(a[i+1:], a[i:])
+		a[i] = value
+		return a, nil
+	})
+}
+
+func pointerRemove(root any, path []string) (any, error) {
+	if len(path) == 0 {
+		return nil, fmt.Errorf("422: cannot remove the whole document")
+	}
+	return pointerUpdate(root, path, func(parent any, token string) (any, error) {
+		if m, ok := parent.(map[string]any); ok {
+			if _, found := m[token]; !found {
+				return nil, fmt.Errorf("422: no member %q", token)
+			}
+			delete(m, token)
+			return m, nil
+		}
+		a := parent.([]any)
+		i, err := arrayIndex(token, len(a), false)
+		if err != nil {
+			return nil, err
+		}
+		return append(a[:i], a[i+1:]...), nil
+	})
+}
+
+// copyJSON copies a decoded json value, so that a copy and its source can be
+// changed apart.
+func copyJSON(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		m := make(map[string]any, len(v))
+		for key, child := range v {
+			m[key] = copyJSON(child)
+		}
+		return m
+	case []any:
+		a := make([]any, len(v))
+		for i, child := range v {
+			a[i] = copyJSON(child)
+		}
+		return a
+	}
+	return value
+}
+
+// encodedSize is the length of the json encoding of a decoded json value.
+func encodedSize(value any) int {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return 0
+	}
+	return len(data)
+}
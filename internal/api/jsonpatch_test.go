@@ -0,0 +1,150 @@
+package api
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestApplyJSONPatchCopyGrowth checks that copies doubling the document are
+// stopped once it passes MaxDocumentSize, rather than after the whole patch.
+func TestApplyJSONPatchCopyGrowth(t *testing.T) {
+	var patch []JSONPatchOp
+	body := "[" + strings.TrimSuffix(strings.Repeat(`{"op":"copy","from":"/blocs","path":"/blocs/-"},`, 64), ",") + "]"
+	if err := json.Unmarshal([]byte(body), &patch); err != nil {
+		t.Fatal(err)
+	}
+	doc := Document{Blocs: []Bloc{{Type: ParagraphBloc, Text: "one"}}}
+	err := doc.ApplyJSONPatch(patch)
+	if err == nil || ParseStatusFromError(err) != 413 {
+		t.Fatalf("got %v, want a 413", err)
+	}
+	if len(doc.Blocs) != 1 || doc.Blocs[0].Text != "one" {
+		t.Fatalf("document changed by a failed patch: %+v", doc)
+	}
+}
+
+func TestParsePointer(t *testing.T) {
+	tests := []struct {
+		pointer string
+		want    []string
+		err     bool
+	}{
+		{pointer: "", want: nil},
+		{pointer: "/", want: []string{""}},
+		{pointer: "/blocs/0/text", want: []string{"blocs", "0", "text"}},
+		{pointer: "/a~1b", want: []string{"a/b"}},
+		{pointer: "/m~0n", want: []string{"m~n"}},
+		// ~01 is an escaped ~ followed by 1, not an escaped /
+		{pointer: "/~01", want: []string{"~1"}},
+		{pointer: "blocs", err: true},
+	}
+	for _, tt := range tests {
+		got, err := parsePointer(tt.pointer)
+		if tt.err {
+			if err == nil {
+				t.Errorf("%q: got %q, want an error", tt.pointer, got)
+			}
+			continue
+		}
+		if err != nil || !slices.Equal(got, tt.want) {
+			t.Errorf("%q: got %q, %v, want %q", tt.pointer, got, err, tt.want)
+		}
+	}
+}
+
+func TestArrayIndex(t *testing.T) {
+	tests := []struct {
+		token     string
+		appending bool
+		want      int
+		err       bool
+	}{
+		{token: "0", want: 0},
+		{token: "2", want: 2},
+		{token: "3", err: true},
+		{token: "3", appending: true, want: 3},
+		{token: "4", appending: true, err: true},
+		{token: "-", appending: true, want: 3},
+		{token: "-", err: true},
+		{token: "01", err: true},
+		{token: "00", err: true},
+		{token: "+1", err: true},
+		{token: "-1", err: true},
+		{token: "one", err: true},
+	}
+	for _, tt := range tests {
+		got, err := arrayIndex(tt.token, 3, tt.appending)
+		if tt.err {
+			if err == nil {
+				t.Errorf("%q (appending %v): got %d, want an error", tt.token, tt.appending, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("%q (appending %v): got %d, %v, want %d", tt.token, tt.appending, got, err, tt.want)
+		}
+	}
+}
+
+func TestApplyJSONPatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		patch string
+		// want lists the texts of the blocs after the patch
+		want   []string
+		status int
+	}{
+		{name: "replace", patch: `[{"op":"replace","path":"/blocs/0/text","value":"first"}]`, want: []string{"first", "two", "three"}},
+		{name: "add at the end", patch: `[{"op":"add","path":"/blocs/-","value":{"text":"four"}}]`, want: []string{"one", "two", "three", "four"}},
+		{name: "add in the middle", patch: `[{"op":"add","path":"/blocs/1","value":{"text":"new"}}]`, want: []string{"one", "new", "two", "three"}},
+		{name: "remove", patch: `[{"op":"remove","path":"/blocs/1"}]`, want: []string{"one", "three"}},
+		{name: "move", patch: `[{"op":"move","from":"/blocs/0","path":"/blocs/2"}]`, want: []string{"two", "three", "one"}},
+		{name: "move onto itself", patch: `[{"op":"move","from":"/blocs/0","path":"/blocs/0"}]`, want: []string{"one", "two", "three"}},
+		{name: "copy", patch: `[{"op":"copy","from":"/blocs/2","path":"/blocs/0"}]`, want: []string{"three", "one", "two", "three"}},
+		{name: "copy is apart from its source", patch: `[{"op":"copy","from":"/blocs/0","path":"/blocs/-"},{"op":"replace","path":"/blocs/3/text","value":"copy"}]`, want: []string{"one", "two", "three", "copy"}},
+		{name: "test passes", patch: `[{"op":"test","path":"/blocs/1/text","value":"two"},{"op":"remove","path":"/blocs/1"}]`, want: []string{"one", "three"}},
+		{name: "test fails", patch: `[{"op":"test","path":"/blocs/1/text","value":"deux"}]`, status: 409},
+		{name: "test fails after changes", patch: `[{"op":"remove","path":"/blocs/0"},{"op":"test","path":"/blocs/0/text","value":"one"}]`, status: 409},
+		{name: "failure after changes", patch: `[{"op":"remove","path":"/blocs/0"},{"op":"remove","path":"/blocs/5"}]`, status: 422},
+		{name: "leading zero", patch: `[{"op":"remove","path":"/blocs/01"}]`, status: 422},
+		{name: "dash outside of add", patch: `[{"op":"replace","path":"/blocs/-","value":{"text":"x"}}]`, status: 422},
+		{name: "move into its own child", patch: `[{"op":"move","from":"/blocs","path":"/blocs/0"}]`, status: 422},
+		{name: "missing value", patch: `[{"op":"add","path":"/blocs/0"}]`, status: 422},
+		{name: "unknown operation", patch: `[{"op":"merge","path":"/blocs/0"}]`, status: 422},
+		{name: "remove the document", patch: `[{"op":"remove","path":""}]`, status: 422},
+		{name: "result is no document", patch: `[{"op":"replace","path":"/blocs","value":"none"}]`, status: 422},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var patch []JSONPatchOp
+			if err := json.Unmarshal([]byte(tt.patch), &patch); err != nil {
+				t.Fatal(err)
+			}
+			doc := Document{Blocs: []Bloc{
+				{Type: ParagraphBloc, Text: "one"},
+				{Type: ParagraphBloc, Text: "two"},
+				{Type: ParagraphBloc, Text: "three"},
+			}}
+			err := doc.ApplyJSONPatch(patch)
+			want := tt.want
+			if tt.status != 0 {
+				if err == nil || ParseStatusFromError(err) != tt.status {
+					t.Fatalf("got %v, want a %d", err, tt.status)
+				}
+				// the patch is applied as a whole or not at all
+				want = []string{"one", "two", "three"}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, b := range doc.Blocs {
+				got = append(got, b.Text)
+			}
+			if !slices.Equal(got, want) {
+				t.Fatalf("got blocs %q, want %q", got, want)
+			}
+		})
+	}
+}
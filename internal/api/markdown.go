@@ -0,0 +1,518 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	east "github.com/yuin/goldmark/extension/ast"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+var (
+	markdownEscaper = strings.NewReplacer(
+		`\`, `\\`, "`", "\\`", `*`, `\*`, `_`, `\_`, `[`, `\[`, `]`, `\]`,
+		`<`, `\<`, `>`, `\>`, `~`, `\~`, `|`, `\|`, `&`, `\&`,
+	)
+	orderedMarker = regexp.MustCompile(`^(\d{1,9})([.)])`)
+	markdown      = goldmark.New(goldmark.WithExtensions(extension.Table, extension.Strikethrough, extension.TaskList))
+)
+
+// markdownDelimiters are the marks markdown can write, in the order they are
+// nested. Underline, colour and font have no markdown equivalent.
+var markdownDelimiters = []string{LinkMark, BoldMark, ItalicMark, StrikeMark}
+
+// RenderMarkdown writes the document as CommonMark, with the GitHub
+// extensions for tables, strikethrough and task lists.
+func RenderMarkdown(doc Document) []byte {
+	var out bytes.Buffer
+	// widths[l] is the width of the marker of the current list item at level
+	// l, the items below it are indented by it
+	var widths []int
+	var counters []int
+	previousList := false
+	for _, b := range doc.Blocs {
+		kind := b.Kind()
+		list := kind == BulletedListBloc || kind == NumberedListBloc || kind == ChecklistBloc
+		if !list {
+			widths, counters = nil, nil
+		}
+		var block string
+		switch kind {
+		case HeadingBloc:
+			block = strings.Repeat("#", b.Attrs.Level) + " " + strings.ReplaceAll(markdownInline(b), "\\\n", " ")
+		case BulletedListBloc, NumberedListBloc, ChecklistBloc:
+			level := b.Attrs.Level
+			for len(widths) <= level {
+				widths = append(widths, 2)
+				counters = append(counters, 0)
+			}
+			widths, counters = widths[:level+1], counters[:level+1]
+			indent := 0
+			for _, w := range widths[:level] {
+				indent += w
+			}
+			marker := "- "
+			switch kind {
+			case NumberedListBloc:
+				counters[level]++
+				marker = strconv.Itoa(counters[level]) + ". "
+			case ChecklistBloc:
+				counters[level] = 0
+				marker = "- [ ] "
+				if b.Attrs.Checked {
+					marker = "- [x] "
+				}
+			default:
+				counters[level] = 0
+			}
+			widths[level] = len(marker)
+			if kind == ChecklistBloc {
+				widths[level] = 2
+			}
+			pad := strings.Repeat(" ", indent)
+			content := strings.ReplaceAll(markdownInline(b), "\n", "\n"+pad+strings.Repeat(" ", len(marker)))
+			block = pad + marker + content
+		case QuoteBloc:
+			block = "> " + strings.ReplaceAll(markdownInline(b), "\n", "\n> ")
+		case CodeBloc:
+			fence := strings.Repeat("`", max(3, longestRun(b.Text, '`')+1))
+			block = fence + b.Attrs.Language + "\n" + b.Text + "\n" + fence
+		case TableBloc:
+			var rows []string
+			for i, row := range b.Attrs.Rows {
+				cells := make([]string, len(row))
+				for j, cell := range row {
+					cells[j] = markdownEscaper.Replace(strings.ReplaceAll(cell, "\n", " "))
+				}
+				rows = append(rows, "| "+strings.Join(cells, " | ")+" |")
+				if i == 0 {
+					rows = append(rows, "|"+strings.Repeat(" --- |", len(row)))
+				}
+			}
+			block = strings.Join(rows, "\n")
+		case RuleBloc:
+			block = "---"
+		case ImageBloc:
+			block = "![" + markdownEscaper.Replace(b.Attrs.Alt) + "](" + markdownURL(b.Attrs.Src) + ")"
+		default:
+			block = markdownInline(b)
+		}
+		if block == "" {
+			previousList = false
+			continue
+		}
+		if out.Len() > 0 {
+			if list && previousList {
+				out.WriteString("\n")
+			} else {
+				out.WriteString("\n\n")
+			}
+		}
+		out.WriteString(block)
+		previousList = list
+	}
+	if out.Len() > 0 {
+		out.WriteString("\n")
+	}
+	return out.Bytes()
+}
+
+// markdownInline writes the text of a bloc with its marks. Delimiters are
+// kept open across runs sharing them, and whitespace is left outside of them
+// since CommonMark does not read "** bold**" as emphasis.
+func markdownInline(b Bloc) string {
+	var sb strings.Builder
+	var open []Mark
+	pending := ""
+	for _, run := range b.Runs() {
+		var want []Mark
+		for _, delimiter := range markdownDelimiters {
+			if value, ok := run.HasMark(delimiter); ok {
+				want = append(want, Mark{Type: delimiter, Value: value})
+			}
+		}
+		keep := 0
+		for keep < len(open) && keep < len(want) && open[keep] == want[keep] {
+			keep++
+		}
+		if strings.TrimSpace(run.Text) == "" {
+			want = want[:keep]
+		}
+		for i := len(open) - 1; i >= keep; i-- {
+			sb.WriteString(markdownCloser(open[i]))
+		}
+		open = open[:keep]
+		sb.WriteString(pending)
+		pending = ""
+		var content string
+		if _, ok := run.HasMark(CodeMark); ok {
+			content = markdownCode(run.Text)
+		} else {
+			content = escapeMarkdownText(run.Text)
+		}
+		if len(want) > keep {
+			trimmed := strings.TrimLeftFunc(content, unicode.IsSpace)
+			sb.WriteString(content[:len(content)-len(trimmed)])
+			content = trimmed
+			for _, m := range want[keep:] {
+				sb.WriteString(markdownOpener(m))
+			}
+			open = want
+		}
+		if len(open) > 0 {
+			trimmed := strings.TrimRightFunc(content, unicode.IsSpace)
+			pending = content[len(trimmed):]
+			content = trimmed
+		}
+		sb.WriteString(content)
+	}
+	for i := len(open) - 1; i >= 0; i-- {
+		sb.WriteString(markdownCloser(open[i]))
+	}
+	sb.WriteString(pending)
+	return escapeLineStart(sb.String())
+}
+
+func markdownOpener(m Mark) string {
+	switch m.Type {
+	case LinkMark:
+		return "["
+	case BoldMark:
+		return "**"
+	case ItalicMark:
+		return "*"
+	default:
+		return "~~"
+	}
+}
+
+func markdownCloser(m Mark) string {
+	if m.Type == LinkMark {
+		return "](" + markdownURL(m.Value) + ")"
+	}
+	return markdownOpener(m)
+}
+
+// markdownCode writes a code span with a fence longer than any run of
+// backticks inside it.
+func markdownCode(s string) string {
+	fence := strings.Repeat("`", longestRun(s, '`')+1)
+	if strings.HasPrefix(s, "`") || strings.HasSuffix(s, "`") {
+		s = " " + s + " "
+	}
+	return fence + strings.ReplaceAll(s, "\n", " ") + fence
+}
+
+// escapeMarkdownText escapes the characters markdown would read as syntax,
+// line breaks become hard breaks.
+func escapeMarkdownText(s string) string {
+	return strings.ReplaceAll(markdownEscaper.Replace(s), "\n", "\\\n")
+}
+
+// escapeLineStart escapes what would start a heading, a list or a quote at
+// the beginning of the lines of a paragraph.
+func escapeLineStart(s string) string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		if line == "" {
+			continue
+		}
+		switch line[0] {
+		case '#', '-', '+', '=', '>':
+			lines[i] = `\` + line
+		default:
+			lines[i] = orderedMarker.ReplaceAllString(line, `$1\$2`)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func markdownURL(u string) string {
+	return strings.NewReplacer(" ", "%20", "(", "%28", ")", "%29", "<", "%3C", ">", "%3E").Replace(u)
+}
+
+func longestRun(s string, c rune) int {
+	longest, current := 0, 0
+	for _, r := range s {
+		if r == c {
+			current++
+			longest = max(longest, current)
+		} else {
+			current = 0
+		}
+	}
+	return longest
+}
+
+// ParseMarkdown reads a CommonMark document, with the GitHub extensions for
+// tables, strikethrough and task lists, into blocs. What blocs cannot hold,
+// like html or nested quotes, is kept as plain text.
+func ParseMarkdown(source []byte) (Document, error) {
+	root := markdown.Parser().Parse(text.NewReader(source))
+	p := markdownParser{source: source}
+	for n := root.FirstChild(); n != nil; n = n.NextSibling() {
+		p.block(n, ParagraphBloc, 0)
+	}
+	doc := Document{Blocs: p.blocs}
+	if len(doc.Blocs) > MaxBlocs {
+		return Document{}, fmt.Errorf("document too large")
+	}
+	if err := doc.Validate(); err != nil {
+		return Document{}, err
+	}
+	return doc, nil
+}
+
+type markdownParser struct {
+	source []byte
+	blocs  []Bloc
+}
+
+// block adds the blocs of a markdown block. Paragraphs take the type of the
+// list item or quote they are in.
+func (p *markdownParser) block(n ast.Node, kind string, level int) {
+	switch n := n.(type) {
+	case *ast.Heading:
+		b := p.inline(n, Bloc{Type: HeadingBloc})
+		b.Attrs.Level = n.Level
+		p.blocs = append(p.blocs, b)
+	case *ast.Paragraph, *ast.TextBlock:
+		if image, ok := soleImage(n); ok && validateImageSrc(unescapeMarkdown(image.Destination)) == nil {
+			p.blocs = append(p.blocs, Bloc{Type: ImageBloc, Attrs: BlocAttrs{
+				Src: unescapeMarkdown(image.Destination),
+				Alt: p.plainText(image),
+			}})
+			return
+		}
+		b := p.inline(n, Bloc{Type: kind})
+		checked := false
+		if box, ok := n.FirstChild().(*east.TaskCheckBox); ok {
+			checked = box.IsChecked
+			if kind == BulletedListBloc {
+				b.Type = ChecklistBloc
+			}
+		}
+		switch b.Type {
+		case BulletedListBloc, NumberedListBloc:
+			b.Attrs.Level = level
+		case ChecklistBloc:
+			b.Attrs.Level = level
+			b.Attrs.Checked = checked
+		}
+		p.blocs = append(p.blocs, b)
+	case *ast.List:
+		itemKind := BulletedListBloc
+		if n.IsOrdered() {
+			itemKind = NumberedListBloc
+		}
+		itemLevel := 0
+		if kind == BulletedListBloc || kind == NumberedListBloc || kind == ChecklistBloc {
+			itemLevel = min(level+1, maxListLevel)
+		}
+		for item := n.FirstChild(); item != nil; item = item.NextSibling() {
+			first := true
+			for c := item.FirstChild(); c != nil; c = c.NextSibling() {
+				if first || c.Kind() == ast.KindList {
+					p.block(c, itemKind, itemLevel)
+				} else {
+					// later paragraphs of the item
+					p.block(c, ParagraphBloc, 0)
+				}
+				first = false
+			}
+		}
+	case *ast.Blockquote:
+		for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+			p.block(c, QuoteBloc, 0)
+		}
+	case *ast.FencedCodeBlock:
+		language := strings.ToLower(string(n.Language(p.source)))
+		if !codeLanguage.MatchString(language) {
+			language = ""
+		}
+		p.blocs = append(p.blocs, Bloc{Type: CodeBloc, Text: p.lines(n), Attrs: BlocAttrs{Language: language}})
+	case *ast.CodeBlock:
+		p.blocs = append(p.blocs, Bloc{Type: CodeBloc, Text: p.lines(n)})
+	case *ast.ThematicBreak:
+		p.blocs = append(p.blocs, Bloc{Type: RuleBloc})
+	case *east.Table:
+		var rows [][]string
+		for row := n.FirstChild(); row != nil; row = row.NextSibling() {
+			var cells []string
+			for cell := row.FirstChild(); cell != nil; cell = cell.NextSibling() {
+				cells = append(cells, p.plainText(cell))
+			}
+			rows = append(rows, cells)
+		}
+		p.blocs = append(p.blocs, Bloc{Type: TableBloc, Attrs: BlocAttrs{Rows: rows}})
+	case *ast.HTMLBlock:
+		p.blocs = append(p.blocs, Bloc{Type: ParagraphBloc, Text: p.lines(n)})
+	default:
+		for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+			p.block(c, kind, level)
+		}
+	}
+}
+
+func soleImage(n ast.Node) (*ast.Image, bool) {
+	image, ok := n.FirstChild().(*ast.Image)
+	return image, ok && n.FirstChild() == n.LastChild()
+}
+
+func (p *markdownParser) lines(n ast.Node) string {
+	var sb strings.Builder
+	lines := n.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		segment := lines.At(i)
+		sb.Write(segment.Value(p.source))
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+// inline sets the text of b and its marks from the inline content of n.
+func (p *markdownParser) inline(n ast.Node, b Bloc) Bloc {
+	var sb strings.Builder
+	var marks []Mark
+	length := 0
+	var walk func(n ast.Node, active []Mark)
+	write := func(s string, active []Mark) {
+		size := len([]rune(s))
+		for _, m := range active {
+			marks = append(marks, Mark{Type: m.Type, Value: m.Value, Start: length, End: length + size})
+		}
+		sb.WriteString(s)
+		length += size
+	}
+	walk = func(n ast.Node, active []Mark) {
+		for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+			switch c := c.(type) {
+			case *ast.Text:
+				write(p.text(c), active)
+				if c.HardLineBreak() {
+					write("\n", nil)
+				} else if c.SoftLineBreak() {
+					write(" ", nil)
+				}
+			case *ast.String:
+				write(string(c.Value), active)
+			case *ast.CodeSpan:
+				write(p.plainText(c), append(active, Mark{Type: CodeMark}))
+			case *ast.Emphasis:
+				mark := Mark{Type: ItalicMark}
+				if c.Level >= 2 {
+					mark.Type = BoldMark
+				}
+				walk(c, append(active, mark))
+			case *east.Strikethrough:
+				walk(c, append(active, Mark{Type: StrikeMark}))
+			case *ast.Link:
+				link := Mark{Type: LinkMark, Value: unescapeMarkdown(c.Destination)}
+				if !validLink(link.Value) {
+					walk(c, active)
+				} else {
+					walk(c, append(active, link))
+				}
+			case *ast.AutoLink:
+				url := string(c.URL(p.source))
+				link := Mark{Type: LinkMark, Value: url}
+				if !validLink(url) {
+					write(string(c.Label(p.source)), active)
+				} else {
+					write(string(c.Label(p.source)), append(active, link))
+				}
+			case *ast.Image:
+				write(p.plainText(c), active)
+			case *ast.RawHTML:
+				for i := 0; i < c.Segments.Len(); i++ {
+					segment := c.Segments.At(i)
+					write(string(segment.Value(p.source)), active)
+				}
+			case *east.TaskCheckBox:
+			default:
+				walk(c, active)
+			}
+		}
+	}
+	walk(n, nil)
+	b.Text = strings.TrimRight(sb.String(), "\n")
+	b.Marks = normalizeMarks(clampMarks(marks, runeLen(b.Text)))
+	return b
+}
+
+// clampMarks cuts marks at the end of a text that was trimmed.
+func clampMarks(marks []Mark, length int) []Mark {
+	for i := range marks {
+		marks[i].End = min(marks[i].End, length)
+	}
+	return marks
+}
+
+func (p *markdownParser) plainText(n ast.Node) string {
+	var sb strings.Builder
+	var walk func(n ast.Node)
+	walk = func(n ast.Node) {
+		for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+			switch c := c.(type) {
+			case *ast.Text:
+				sb.WriteString(p.text(c))
+				if c.SoftLineBreak() || c.HardLineBreak() {
+					sb.WriteString(" ")
+				}
+			case *ast.String:
+				sb.Write(c.Value)
+			default:
+				walk(c)
+			}
+		}
+	}
+	walk(n)
+	return sb.String()
+}
+
+// text is the content of a text node, with backslash escapes and character
+// references resolved unless the node is raw, as in code spans.
+func (p *markdownParser) text(n *ast.Text) string {
+	value := n.Segment.Value(p.source)
+	if n.IsRaw() {
+		return string(value)
+	}
+	return unescapeMarkdown(value)
+}
+
+// unescapeMarkdown resolves backslash escapes and character references in
+// one pass, so that an escaped ampersand does not start a reference.
+func unescapeMarkdown(s []byte) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && i+1 < len(s) && util.IsPunct(s[i+1]):
+			i++
+			sb.WriteByte(s[i])
+			continue
+		case s[i] == '&':
+			if end := bytes.IndexByte(s[i:min(i+34, len(s))], ';'); end > 0 {
+				reference := s[i : i+end+1]
+				resolved := util.ResolveEntityNames(util.ResolveNumericReferences(reference))
+				if !bytes.Equal(resolved, reference) {
+					sb.Write(resolved)
+					i += end
+					continue
+				}
+			}
+		}
+		sb.WriteByte(s[i])
+	}
+	return sb.String()
+}
+
+func validLink(url string) bool {
+	return Mark{Type: LinkMark, Value: url, End: 1}.validate(1) == nil
+}
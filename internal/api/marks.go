@@ -0,0 +1,285 @@
+package api
+
+import (
+	"cmp"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Types of inline marks. Link, color and font marks carry a value.
+const (
+	BoldMark      = "bold"
+	ItalicMark    = "italic"
+	UnderlineMark = "underline"
+	StrikeMark    = "strike"
+	CodeMark      = "code"
+	LinkMark      = "link"
+	ColorMark     = "color"
+	FontMark      = "font"
+)
+
+var (
+	colorValue = regexp.MustCompile(`^(#[0-9a-fA-F]{3}|#[0-9a-fA-F]{6}|[a-zA-Z]{1,20})$`)
+	fontValue  = regexp.MustCompile(`^[A-Za-z0-9 '-]{1,64}$`)
+	boldWeight = []string{"bold", "bolder", "600", "700", "800", "900"}
+)
+
+// namedColors are the css colour names that formats without them, like pdf
+// and docx, can show. Other names are dropped there.
+var namedColors = map[string][3]uint8{
+	"black": {0, 0, 0}, "silver": {192, 192, 192}, "gray": {128, 128, 128}, "grey": {128, 128, 128},
+	"white": {255, 255, 255}, "maroon": {128, 0, 0}, "red": {255, 0, 0}, "purple": {128, 0, 128},
+	"fuchsia": {255, 0, 255}, "magenta": {255, 0, 255}, "green": {0, 128, 0}, "lime": {0, 255, 0},
+	"olive": {128, 128, 0}, "yellow": {255, 255, 0}, "navy": {0, 0, 128}, "blue": {0, 0, 255},
+	"teal": {0, 128, 128}, "aqua": {0, 255, 255}, "cyan": {0, 255, 255}, "orange": {255, 165, 0},
+	"brown": {165, 42, 42}, "pink": {255, 192, 203},
+}
+
+// Mark formats the characters of a bloc from Start included to End excluded,
+// counted in unicode code points like text offsets. A character has at most
+// one mark of each type: marks are attributes of the characters, they move
+// and go away with them and text inserted next to a mark does not take it.
+type Mark struct {
+	Type  string `json:"type"`
+	Value string `json:"value,omitempty"`
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+}
+
+// Run is a piece of text of a bloc with the same marks all along, the marks
+// of a run have no offsets.
+type Run struct {
+	Text  string `json:"text"`
+	Marks []Mark `json:"marks,omitempty"`
+}
+
+func (m Mark) validate(length int) error {
+	switch m.Type {
+	case BoldMark, ItalicMark, UnderlineMark, StrikeMark, CodeMark:
+		if m.Value != "" {
+			return fmt.Errorf("%s mark takes no value", m.Type)
+		}
+	case LinkMark:
+		u, err := url.Parse(m.Value)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "mailto") {
+			return fmt.Errorf("invalid link")
+		}
+	case ColorMark:
+		if !colorValue.MatchString(m.Value) {
+			return fmt.Errorf("invalid color")
+		}
+	case FontMark:
+		if !fontValue.MatchString(m.Value) {
+			return fmt.Errorf("invalid font")
+		}
+	default:
+		return fmt.Errorf("unknown mark %q", m.Type)
+	}
+	if m.Start < 0 || m.Start >= m.End || m.End > length {
+		return fmt.Errorf("%s mark %d-%d out of range", m.Type, m.Start, m.End)
+	}
+	return nil
+}
+
+// validateMarks checks the marks of a text of the given length, they must be
+// normalized.
+func validateMarks(marks []Mark, length int) error {
+	for i, m := range marks {
+		if err := m.validate(length); err != nil {
+			return err
+		}
+		if i > 0 && marks[i-1].Type == m.Type && marks[i-1].End > m.Start {
+			return fmt.Errorf("overlapping %s marks", m.Type)
+		}
+	}
+	if !slices.IsSortedFunc(marks, compareMarks) {
+		return fmt.Errorf("marks are not sorted")
+	}
+	return nil
+}
+
+func compareMarks(a, b Mark) int {
+	return cmp.Or(cmp.Compare(a.Type, b.Type), cmp.Compare(a.Start, b.Start), cmp.Compare(a.Value, b.Value))
+}
+
+// normalizeMarks sorts marks and merges those of the same value that touch,
+// so that the same formatting is always written the same way.
+func normalizeMarks(marks []Mark) []Mark {
+	marks = slices.DeleteFunc(marks, func(m Mark) bool { return m.Start >= m.End })
+	slices.SortFunc(marks, compareMarks)
+	var merged []Mark
+	for _, m := range marks {
+		if n := len(merged); n > 0 && merged[n-1].Type == m.Type && merged[n-1].Value == m.Value && merged[n-1].End >= m.Start {
+			merged[n-1].End = max(merged[n-1].End, m.End)
+			continue
+		}
+		merged = append(merged, m)
+	}
+	return merged
+}
+
+// insertMarks makes room for n characters inserted at offset, which carry
+// inserted with offsets relative to them.
+func insertMarks(marks []Mark, offset, n int, inserted []Mark) []Mark {
+	var result []Mark
+	for _, m := range marks {
+		switch {
+		case m.End <= offset:
+			result = append(result, m)
+		case m.Start >= offset:
+			m.Start += n
+			m.End += n
+			result = append(result, m)
+		default:
+			after := m
+			m.End = offset
+			after.Start = offset + n
+			after.End += n
+			result = append(result, m, after)
+		}
+	}
+	for _, m := range inserted {
+		m.Start += offset
+		m.End += offset
+		result = append(result, m)
+	}
+	return normalizeMarks(result)
+}
+
+// deleteMarks drops the characters from offset to offset+n out of the marks.
+func deleteMarks(marks []Mark, offset, n int) []Mark {
+	var result []Mark
+	for _, m := range marks {
+		m.Start = deletedPosition(m.Start, offset, n)
+		m.End = deletedPosition(m.End, offset, n)
+		result = append(result, m)
+	}
+	return normalizeMarks(result)
+}
+
+// clearMark removes the marks of a type from the characters start to end.
+func clearMark(marks []Mark, markType string, start, end int) []Mark {
+	var result []Mark
+	for _, m := range marks {
+		if m.Type != markType || m.End <= start || m.Start >= end {
+			result = append(result, m)
+			continue
+		}
+		if m.Start < start {
+			before := m
+			before.End = start
+			result = append(result, before)
+		}
+		if m.End > end {
+			m.Start = end
+			result = append(result, m)
+		}
+	}
+	return normalizeMarks(result)
+}
+
+// deletedPosition is where position p ends up once n characters are deleted
+// at offset.
+func deletedPosition(p, offset, n int) int {
+	switch {
+	case p <= offset:
+		return p
+	case p <= offset+n:
+		return offset
+	default:
+		return p - n
+	}
+}
+
+// styleMarks maps the style of a bloc, which predates marks, to marks
+// covering its whole text.
+func styleMarks(style Styling, length int) []Mark {
+	var marks []Mark
+	if length == 0 {
+		return nil
+	}
+	if slices.Contains(boldWeight, style.Weight) {
+		marks = append(marks, Mark{Type: BoldMark, End: length})
+	}
+	if style.Font != "" && fontValue.MatchString(style.Font) {
+		marks = append(marks, Mark{Type: FontMark, Value: style.Font, End: length})
+	}
+	if style.Color != "" && colorValue.MatchString(style.Color) {
+		marks = append(marks, Mark{Type: ColorMark, Value: style.Color, End: length})
+	}
+	return marks
+}
+
+// Runs splits the text of the bloc where its formatting changes. The style
+// of the bloc counts as marks over the whole text, inline marks of the same
+// type take precedence over it.
+func (b Bloc) Runs() []Run {
+	text := []rune(b.Text)
+	marks := b.Marks
+	for _, m := range styleMarks(b.Style, len(text)) {
+		for _, inline := range b.Marks {
+			if inline.Type == m.Type {
+				m = Mark{}
+				break
+			}
+		}
+		if m.Type != "" {
+			marks = append(marks, m)
+		}
+	}
+	bounds := []int{0, len(text)}
+	for _, m := range marks {
+		bounds = append(bounds, m.Start, m.End)
+	}
+	slices.Sort(bounds)
+	bounds = slices.Compact(bounds)
+	var runs []Run
+	for i := 1; i < len(bounds); i++ {
+		start, end := bounds[i-1], bounds[i]
+		run := Run{Text: string(text[start:end])}
+		for _, m := range marks {
+			if m.Start <= start && end <= m.End {
+				run.Marks = append(run.Marks, Mark{Type: m.Type, Value: m.Value})
+			}
+		}
+		slices.SortFunc(run.Marks, compareMarks)
+		runs = append(runs, run)
+	}
+	return runs
+}
+
+// HasMark reports whether the run has a mark of the type, and its value.
+func (r Run) HasMark(markType string) (string, bool) {
+	for _, m := range r.Marks {
+		if m.Type == markType {
+			return m.Value, true
+		}
+	}
+	return "", false
+}
+
+// colorRGB reads the value of a colour mark, a hex colour or one of
+// namedColors.
+func colorRGB(value string) ([3]uint8, bool) {
+	if !colorValue.MatchString(value) {
+		return [3]uint8{}, false
+	}
+	if !strings.HasPrefix(value, "#") {
+		c, ok := namedColors[strings.ToLower(value)]
+		return c, ok
+	}
+	hex := value[1:]
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	var c [3]uint8
+	for i := range c {
+		v, _ := strconv.ParseUint(hex[2*i:2*i+2], 16, 8)
+		c[i] = uint8(v)
+	}
+	return c, true
+}
@@ -17,12 +17,7 @@ const (
 
 func (cfg *ApiConfig) AuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		value, err := ReadSigned(r, accessCookieName, cfg.CookieKey)
-		if err != nil {
-			RespondWithError(w, 401, "authentication error")
-			return
-		}
-		userId, err := auth.ValidateJwt(cfg.SecretKey, value)
+		userId, err := cfg.authenticateCookie(r)
 		if err != nil {
 			RespondWithError(w, 401, "authentication error")
 			return
@@ -34,6 +29,32 @@ func (cfg *ApiConfig) AuthMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+func (cfg *ApiConfig) authenticateCookie(r *http.Request) (uuid.UUID, error) {
+	value, err := ReadSigned(r, accessCookieName, cfg.CookieKey)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return auth.ValidateJwt(cfg.SecretKey, value)
+}
+
+// AuthenticateWebSocket identifies the user opening a websocket on a document,
+// either from the access cookie or from a "ticket" query parameter issued by
+// CreateTicketHandler for that same document.
+func (cfg *ApiConfig) AuthenticateWebSocket(r *http.Request, documentId uuid.UUID) (uuid.UUID, error) {
+	if userId, err := cfg.authenticateCookie(r); err == nil {
+		return userId, nil
+	}
+	ticket := r.URL.Query().Get("ticket")
+	if ticket == "" {
+		return uuid.Nil, fmt.Errorf("401: authentication error")
+	}
+	userId, err := auth.ValidateTicket(cfg.SecretKey, ticket, documentId)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("401: authentication error")
+	}
+	return userId, nil
+}
+
 func GetUserIdFromContext(ctx context.Context) (uuid.UUID, error) {
 	if userId := ctx.Value(k).(uuid.UUID); userId != uuid.Nil {
 		return userId, nil
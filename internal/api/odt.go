@@ -0,0 +1,417 @@
+package api
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"image"
+	"strings"
+)
+
+// Namespaces and types of an OpenDocument text package.
+const (
+	odtContentType     = "application/vnd.oasis.opendocument.text"
+	odtManifestNS      = "urn:oasis:names:tc:opendocument:xmlns:manifest:1.0"
+	odtCodeFont        = "Liberation Mono"
+	odtMaxImageWidth   = 17.0
+	odtListIndent      = 0.635
+	odtCentimetrePerPx = 2.54 / 96
+)
+
+const odtNamespaces = `xmlns:office="urn:oasis:names:tc:opendocument:xmlns:office:1.0" ` +
+	`xmlns:style="urn:oasis:names:tc:opendocument:xmlns:style:1.0" ` +
+	`xmlns:text="urn:oasis:names:tc:opendocument:xmlns:text:1.0" ` +
+	`xmlns:table="urn:oasis:names:tc:opendocument:xmlns:table:1.0" ` +
+	`xmlns:draw="urn:oasis:names:tc:opendocument:xmlns:drawing:1.0" ` +
+	`xmlns:fo="urn:oasis:names:tc:opendocument:xmlns:xsl-fo-compatible:1.0" ` +
+	`xmlns:svg="urn:oasis:names:tc:opendocument:xmlns:svg-compatible:1.0" ` +
+	`xmlns:xlink="http://www.w3.org/1999/xlink" ` +
+	`xmlns:dc="http://purl.org/dc/elements/1.1/" ` +
+	`xmlns:meta="urn:oasis:names:tc:opendocument:xmlns:meta:1.0" ` +
+	`office:version="1.2"`
+
+// odtListStyles are the list styles of bulleted and numbered lists, named
+// in styles.xml.
+var odtListStyles = map[string]string{BulletedListBloc: "Bullets", NumberedListBloc: "Numbering_20_123"}
+
+// odtWriter builds the content of an odt package while the document is
+// written.
+type odtWriter struct {
+	body bytes.Buffer
+	// textStyles are the automatic styles of runs by their properties,
+	// named in the order they were first used
+	textStyles map[string]string
+	styleOrder []string
+	media      []docxMedia
+	// spaced is set when the text written last ends with whitespace, a space
+	// after it would be collapsed unless written as text:s
+	spaced bool
+}
+
+// RenderODT writes the document as an OpenDocument text, the format of
+// LibreOffice. Paragraph types map to its default styles, lists to list
+// styles and checklists to indented paragraphs starting with a checkbox
+// character, as for docx.
+func RenderODT(doc Document, name string) ([]byte, error) {
+	w := &odtWriter{textStyles: map[string]string{}}
+	// lists holds the kinds of the open lists, the item of the last one is
+	// still open so that nested lists go inside it
+	var lists []string
+	closeLists := func(level int) {
+		for len(lists) > level {
+			w.body.WriteString("</text:list-item></text:list>")
+			lists = lists[:len(lists)-1]
+		}
+	}
+	for _, b := range doc.Blocs {
+		kind := b.Kind()
+		if kind != BulletedListBloc && kind != NumberedListBloc {
+			closeLists(0)
+		}
+		switch kind {
+		case HeadingBloc:
+			level := min(max(b.Attrs.Level, 1), maxHeadingLevel)
+			fmt.Fprintf(&w.body, "<text:h text:style-name=\"Heading_20_%d\" text:outline-level=\"%d\">", level, level)
+			w.inline(b)
+			w.body.WriteString("</text:h>")
+		case BulletedListBloc, NumberedListBloc:
+			level := b.Attrs.Level
+			if level < len(lists) && lists[level] != kind {
+				closeLists(level)
+			} else {
+				closeLists(level + 1)
+			}
+			if level < len(lists) {
+				w.body.WriteString("</text:list-item>")
+			}
+			for len(lists) <= level {
+				if len(lists) > 0 && len(lists) < level {
+					// a level was skipped, the list items between are empty
+					w.body.WriteString("<text:list>")
+				} else {
+					fmt.Fprintf(&w.body, "<text:list text:style-name=\"%s\">", odtListStyles[kind])
+				}
+				lists = append(lists, kind)
+				if len(lists) <= level {
+					w.body.WriteString("<text:list-item>")
+				}
+			}
+			w.body.WriteString("<text:list-item>")
+			w.paragraph("List_20_Contents", b)
+		case ChecklistBloc:
+			prefix := docxCheckboxes[b.Attrs.Checked] + " "
+			b.Text = prefix + b.Text
+			b.Marks = insertMarks(b.Marks, 0, runeLen(prefix), nil)
+			w.paragraph(fmt.Sprintf("Checklist_%d", min(max(b.Attrs.Level, 0), maxListLevel)), b)
+		case QuoteBloc:
+			w.paragraph("Quotations", b)
+		case CodeBloc:
+			w.paragraph("Preformatted_20_Text", Bloc{Text: b.Text})
+		case TableBloc:
+			w.table(b.Attrs.Rows)
+		case RuleBloc:
+			w.body.WriteString("<text:p text:style-name=\"Horizontal_20_Line\"/>")
+		case ImageBloc:
+			w.image(b.Attrs)
+		default:
+			w.paragraph("Standard", b)
+		}
+	}
+	closeLists(0)
+
+	var out bytes.Buffer
+	z := zip.NewWriter(&out)
+	// the mimetype comes first and uncompressed, so that the type of the
+	// file can be read at a fixed offset
+	f, err := z.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Write([]byte(odtContentType)); err != nil {
+		return nil, err
+	}
+	parts := []docxMedia{
+		{"META-INF/manifest.xml", w.manifest()},
+		{"meta.xml", fmt.Appendf(nil, `%s<office:document-meta %s><office:meta><dc:title>%s</dc:title><meta:generator>go-docs</meta:generator></office:meta></office:document-meta>`, xml.Header, odtNamespaces, docxEscape(name))},
+		{"styles.xml", odtStyles()},
+		{"content.xml", w.content()},
+	}
+	for _, m := range w.media {
+		parts = append(parts, docxMedia{"Pictures/" + m.name, m.data})
+	}
+	for _, part := range parts {
+		f, err := z.Create(part.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := f.Write(part.data); err != nil {
+			return nil, err
+		}
+	}
+	if err := z.Close(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// paragraph writes a paragraph of the style with the text of the bloc in
+// spans, links in text:a elements.
+func (w *odtWriter) paragraph(style string, b Bloc) {
+	fmt.Fprintf(&w.body, "<text:p text:style-name=\"%s\">", style)
+	w.inline(b)
+	w.body.WriteString("</text:p>")
+}
+
+func (w *odtWriter) inline(b Bloc) {
+	w.spaced = true
+	link := ""
+	for _, run := range b.Runs() {
+		value, _ := run.HasMark(LinkMark)
+		if !validLink(value) {
+			value = ""
+		}
+		if value != link {
+			if link != "" {
+				w.body.WriteString("</text:a>")
+			}
+			if value != "" {
+				fmt.Fprintf(&w.body, "<text:a xlink:type=\"simple\" xlink:href=\"%s\" text:style-name=\"Internet_20_link\">", docxEscape(value))
+			}
+			link = value
+		}
+		style := w.textStyle(run)
+		if style != "" {
+			fmt.Fprintf(&w.body, "<text:span text:style-name=\"%s\">", style)
+		}
+		w.text(run.Text)
+		if style != "" {
+			w.body.WriteString("</text:span>")
+		}
+	}
+	if link != "" {
+		w.body.WriteString("</text:a>")
+	}
+}
+
+// textStyle names the automatic style with the formatting of a run, runs
+// without formatting have none.
+func (w *odtWriter) textStyle(run Run) string {
+	var props strings.Builder
+	_, code := run.HasMark(CodeMark)
+	if font, ok := run.HasMark(FontMark); code || (ok && fontValue.MatchString(font)) {
+		if code {
+			font = odtCodeFont
+		}
+		fmt.Fprintf(&props, ` fo:font-family="'%s'"`, docxEscape(strings.ReplaceAll(font, "'", "")))
+	}
+	if _, ok := run.HasMark(BoldMark); ok {
+		props.WriteString(` fo:font-weight="bold"`)
+	}
+	if _, ok := run.HasMark(ItalicMark); ok {
+		props.WriteString(` fo:font-style="italic"`)
+	}
+	if _, ok := run.HasMark(StrikeMark); ok {
+		props.WriteString(` style:text-line-through-style="solid"`)
+	}
+	if value, ok := run.HasMark(ColorMark); ok {
+		if c, ok := colorRGB(value); ok {
+			fmt.Fprintf(&props, ` fo:color="#%02x%02x%02x"`, c[0], c[1], c[2])
+		}
+	}
+	if _, ok := run.HasMark(UnderlineMark); ok {
+		props.WriteString(` style:text-underline-style="solid" style:text-underline-width="auto" style:text-underline-color="font-color"`)
+	}
+	if code {
+		props.WriteString(` fo:background-color="#f6f8fa"`)
+	}
+	if props.Len() == 0 {
+		return ""
+	}
+	name, ok := w.textStyles[props.String()]
+	if !ok {
+		name = fmt.Sprintf("T%d", len(w.styleOrder)+1)
+		w.textStyles[props.String()] = name
+		w.styleOrder = append(w.styleOrder, props.String())
+	}
+	return name
+}
+
+// text writes text with the whitespace odt would collapse as elements.
+func (w *odtWriter) text(s string) {
+	var plain strings.Builder
+	flush := func() {
+		w.body.WriteString(docxEscape(plain.String()))
+		plain.Reset()
+	}
+	for _, r := range s {
+		switch r {
+		case ' ':
+			if w.spaced {
+				flush()
+				w.body.WriteString("<text:s/>")
+			} else {
+				plain.WriteRune(r)
+			}
+			w.spaced = true
+		case '\t':
+			flush()
+			w.body.WriteString("<text:tab/>")
+			w.spaced = true
+		case '\n':
+			flush()
+			w.body.WriteString("<text:line-break/>")
+			w.spaced = true
+		default:
+			plain.WriteRune(r)
+			w.spaced = false
+		}
+	}
+	flush()
+}
+
+// table writes the rows with the first one as header, repeated on every
+// page.
+func (w *odtWriter) table(rows [][]string) {
+	if len(rows) == 0 || len(rows[0]) == 0 {
+		return
+	}
+	fmt.Fprintf(&w.body, "<table:table table:style-name=\"Table\"><table:table-column table:style-name=\"TableColumn\" table:number-columns-repeated=\"%d\"/>", len(rows[0]))
+	for i, row := range rows {
+		if i == 0 {
+			w.body.WriteString("<table:table-header-rows>")
+		}
+		w.body.WriteString("<table:table-row>")
+		style := "Table_20_Contents"
+		if i == 0 {
+			style = "Table_20_Heading"
+		}
+		for _, cell := range row {
+			w.body.WriteString("<table:table-cell table:style-name=\"TableCell\" office:value-type=\"string\">")
+			w.paragraph(style, Bloc{Text: cell})
+			w.body.WriteString("</table:table-cell>")
+		}
+		w.body.WriteString("</table:table-row>")
+		if i == 0 {
+			w.body.WriteString("</table:table-header-rows>")
+		}
+	}
+	w.body.WriteString("</table:table>")
+}
+
+// image embeds an image given as a data url, images from other sites are
+// written as a link to them.
+func (w *odtWriter) image(attrs BlocAttrs) {
+	alt := attrs.Alt
+	if alt == "" {
+		alt = attrs.Src
+	}
+	data, format, ok := decodeImageData(attrs.Src)
+	if !ok {
+		if validLink(attrs.Src) {
+			w.paragraph("Standard", Bloc{Text: alt, Marks: []Mark{{Type: LinkMark, Value: attrs.Src, End: runeLen(alt)}}})
+		} else if attrs.Alt != "" {
+			w.paragraph("Standard", Bloc{Text: attrs.Alt})
+		}
+		return
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || config.Width == 0 || config.Height == 0 {
+		return
+	}
+	width, height := float64(config.Width), float64(config.Height)
+	switch {
+	case attrs.Width > 0 && attrs.Height > 0:
+		width, height = float64(attrs.Width), float64(attrs.Height)
+	case attrs.Width > 0:
+		width, height = float64(attrs.Width), height*float64(attrs.Width)/width
+	case attrs.Height > 0:
+		width, height = width*float64(attrs.Height)/height, float64(attrs.Height)
+	}
+	width, height = width*odtCentimetrePerPx, height*odtCentimetrePerPx
+	if width > odtMaxImageWidth {
+		width, height = odtMaxImageWidth, height*odtMaxImageWidth/width
+	}
+	n := len(w.media) + 1
+	file := fmt.Sprintf("image%d.%s", n, format)
+	w.media = append(w.media, docxMedia{name: file, data: data})
+	fmt.Fprintf(&w.body, `<text:p text:style-name="Standard"><draw:frame draw:style-name="Image" draw:name="Image%d" text:anchor-type="as-char" svg:width="%.3fcm" svg:height="%.3fcm" draw:z-index="0"><draw:image xlink:href="Pictures/%s" xlink:type="simple" xlink:show="embed" xlink:actuate="onLoad"/><svg:desc>%s</svg:desc></draw:frame></text:p>`,
+		n, width, height, file, docxEscape(attrs.Alt))
+}
+
+func (w *odtWriter) content() []byte {
+	var out bytes.Buffer
+	out.WriteString(xml.Header)
+	fmt.Fprintf(&out, `<office:document-content %s><office:automatic-styles>`, odtNamespaces)
+	for level := 0; level <= maxListLevel; level++ {
+		fmt.Fprintf(&out, `<style:style style:name="Checklist_%d" style:family="paragraph" style:parent-style-name="List_20_Contents"><style:paragraph-properties fo:margin-left="%.3fcm"/></style:style>`,
+			level, 2*odtListIndent*float64(level+1))
+	}
+	for _, props := range w.styleOrder {
+		fmt.Fprintf(&out, `<style:style style:name="%s" style:family="text"><style:text-properties%s/></style:style>`, w.textStyles[props], props)
+	}
+	out.WriteString(`<style:style style:name="Table" style:family="table"><style:table-properties style:width="17cm" table:align="margins"/></style:style>`)
+	out.WriteString(`<style:style style:name="TableColumn" style:family="table-column"/>`)
+	out.WriteString(`<style:style style:name="TableCell" style:family="table-cell"><style:table-cell-properties fo:padding="0.1cm" fo:border="0.5pt solid #d0d7de"/></style:style>`)
+	out.WriteString(`<style:style style:name="Image" style:family="graphic"><style:graphic-properties style:vertical-pos="top" style:vertical-rel="baseline"/></style:style>`)
+	out.WriteString(`</office:automatic-styles><office:body><office:text>`)
+	out.Write(w.body.Bytes())
+	out.WriteString(`</office:text></office:body></office:document-content>`)
+	return out.Bytes()
+}
+
+func (w *odtWriter) manifest() []byte {
+	var out bytes.Buffer
+	out.WriteString(xml.Header)
+	fmt.Fprintf(&out, `<manifest:manifest xmlns:manifest="%s" manifest:version="1.2">`, odtManifestNS)
+	fmt.Fprintf(&out, `<manifest:file-entry manifest:full-path="/" manifest:version="1.2" manifest:media-type="%s"/>`, odtContentType)
+	for _, part := range []string{"content.xml", "styles.xml", "meta.xml"} {
+		fmt.Fprintf(&out, `<manifest:file-entry manifest:full-path="%s" manifest:media-type="text/xml"/>`, part)
+	}
+	for _, m := range w.media {
+		format := m.name[strings.LastIndex(m.name, ".")+1:]
+		fmt.Fprintf(&out, `<manifest:file-entry manifest:full-path="Pictures/%s" manifest:media-type="%s"/>`, m.name, docxImageTypes[format])
+	}
+	out.WriteString(`</manifest:manifest>`)
+	return out.Bytes()
+}
+
+// odtStyles has the styles the content refers to, named as the default
+// styles of LibreOffice so that they show under their usual names, and the
+// page layout.
+func odtStyles() []byte {
+	var out bytes.Buffer
+	out.WriteString(xml.Header)
+	fmt.Fprintf(&out, `<office:document-styles %s><office:styles>`, odtNamespaces)
+	out.WriteString(`<style:default-style style:family="paragraph"><style:paragraph-properties fo:margin-top="0cm" fo:margin-bottom="0.21cm" fo:line-height="115%"/><style:text-properties fo:font-family="'Liberation Sans'" fo:font-size="11pt" fo:language="en" fo:country="US"/></style:default-style>`)
+	out.WriteString(`<style:style style:name="Standard" style:family="paragraph" style:class="text"/>`)
+	out.WriteString(`<style:style style:name="Heading" style:family="paragraph" style:parent-style-name="Standard" style:next-style-name="Standard" style:class="text"><style:paragraph-properties fo:margin-top="0.42cm" fo:margin-bottom="0.14cm" fo:keep-with-next="always"/><style:text-properties fo:font-weight="bold"/></style:style>`)
+	for i, size := range docxHeadingSizes {
+		fmt.Fprintf(&out, `<style:style style:name="Heading_20_%[1]d" style:display-name="Heading %[1]d" style:family="paragraph" style:parent-style-name="Heading" style:next-style-name="Standard" style:default-outline-level="%[1]d" style:class="text"><style:text-properties fo:font-size="%[2]gpt"/></style:style>`, i+1, float64(size)/2)
+	}
+	out.WriteString(`<style:style style:name="List_20_Contents" style:display-name="List Contents" style:family="paragraph" style:parent-style-name="Standard" style:class="list"><style:paragraph-properties fo:margin-bottom="0.07cm"/></style:style>`)
+	out.WriteString(`<style:style style:name="Quotations" style:family="paragraph" style:parent-style-name="Standard" style:class="html"><style:paragraph-properties fo:margin-left="0.6cm" fo:padding-left="0.3cm" fo:border-left="2.25pt solid #d0d7de" fo:border-right="none" fo:border-top="none" fo:border-bottom="none"/><style:text-properties fo:font-style="italic" fo:color="#59636e"/></style:style>`)
+	fmt.Fprintf(&out, `<style:style style:name="Preformatted_20_Text" style:display-name="Preformatted Text" style:family="paragraph" style:parent-style-name="Standard" style:class="html"><style:paragraph-properties fo:background-color="#f6f8fa" fo:padding="0.1cm" fo:line-height="100%%"/><style:text-properties fo:font-family="'%s'" fo:font-size="9.5pt"/></style:style>`, odtCodeFont)
+	out.WriteString(`<style:style style:name="Table_20_Contents" style:display-name="Table Contents" style:family="paragraph" style:parent-style-name="Standard" style:class="extra"><style:paragraph-properties fo:margin-bottom="0cm"/></style:style>`)
+	out.WriteString(`<style:style style:name="Table_20_Heading" style:display-name="Table Heading" style:family="paragraph" style:parent-style-name="Table_20_Contents" style:class="extra"><style:text-properties fo:font-weight="bold"/></style:style>`)
+	out.WriteString(`<style:style style:name="Horizontal_20_Line" style:display-name="Horizontal Line" style:family="paragraph" style:parent-style-name="Standard" style:class="html"><style:paragraph-properties fo:padding="0cm" fo:border-top="none" fo:border-left="none" fo:border-right="none" fo:border-bottom="0.5pt solid #d0d7de"/><style:text-properties fo:font-size="6pt"/></style:style>`)
+	out.WriteString(`<style:style style:name="Internet_20_link" style:display-name="Internet link" style:family="text"><style:text-properties fo:color="#0563c1" style:text-underline-style="solid" style:text-underline-width="auto" style:text-underline-color="font-color"/></style:style>`)
+	bullets := []string{"•", "◦", "▪"}
+	formats := []string{"1", "a", "i"}
+	for _, kind := range []string{BulletedListBloc, NumberedListBloc} {
+		fmt.Fprintf(&out, `<text:list-style style:name="%s">`, odtListStyles[kind])
+		for level := 0; level <= maxListLevel; level++ {
+			indent := fmt.Sprintf(`<style:list-level-properties text:list-level-position-and-space-mode="label-alignment"><style:list-level-label-alignment text:label-followed-by="listtab" text:list-tab-stop-position="%[1]gcm" fo:text-indent="-%[2]gcm" fo:margin-left="%[1]gcm"/></style:list-level-properties>`,
+				2*odtListIndent*float64(level+1), odtListIndent)
+			if kind == BulletedListBloc {
+				fmt.Fprintf(&out, `<text:list-level-style-bullet text:level="%d" text:bullet-char="%s">%s</text:list-level-style-bullet>`, level+1, bullets[level%len(bullets)], indent)
+			} else {
+				fmt.Fprintf(&out, `<text:list-level-style-number text:level="%d" style:num-suffix="." style:num-format="%s">%s</text:list-level-style-number>`, level+1, formats[level%len(formats)], indent)
+			}
+		}
+		out.WriteString(`</text:list-style>`)
+	}
+	out.WriteString(`</office:styles><office:automatic-styles><style:page-layout style:name="Page"><style:page-layout-properties fo:page-width="21cm" fo:page-height="29.7cm" style:print-orientation="portrait" fo:margin-top="2cm" fo:margin-bottom="2cm" fo:margin-left="2cm" fo:margin-right="2cm"/></style:page-layout></office:automatic-styles>`)
+	out.WriteString(`<office:master-styles><style:master-page style:name="Standard" style:page-layout-name="Page"/></office:master-styles></office:document-styles>`)
+	return out.Bytes()
+}
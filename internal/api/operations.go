@@ -0,0 +1,375 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Operation types a collaborator can send. Bloc indexes refer to
+// Document.Blocs and text offsets count unicode code points in Bloc.Text.
+const (
+	InsertTextOp = "insert_text"
+	DeleteTextOp = "delete_text"
+	InsertBlocOp = "insert_bloc"
+	RemoveBlocOp = "remove_bloc"
+	MoveBlocOp   = "move_bloc"
+	SetStyleOp   = "set_style"
+	// SetTypeOp changes the type and attributes of a bloc to those of Value
+	SetTypeOp = "set_type"
+	// AddMarkOp and RemoveMarkOp format Length characters from Offset with
+	// Mark, or remove the marks of its type from them
+	AddMarkOp    = "add_mark"
+	RemoveMarkOp = "remove_mark"
+)
+
+type Operation struct {
+	Type   string   `json:"type"`
+	Bloc   int      `json:"bloc"`
+	Offset int      `json:"offset,omitempty"`
+	Text   string   `json:"text,omitempty"`
+	Length int      `json:"length,omitempty"`
+	To     int      `json:"to,omitempty"`
+	Value  *Bloc    `json:"value,omitempty"`
+	Style  *Styling `json:"style,omitempty"`
+	// Marks of inserted text, with offsets relative to it
+	Marks []Mark `json:"marks,omitempty"`
+	Mark  *Mark  `json:"mark,omitempty"`
+}
+
+func (d Document) Clone() Document {
+	if d.Blocs == nil {
+		return Document{}
+	}
+	blocs := make([]Bloc, len(d.Blocs))
+	copy(blocs, d.Blocs)
+	return Document{Blocs: blocs}
+}
+
+// Apply runs the operations in order against the document and leaves it
+// untouched if one of them is invalid.
+func (d *Document) Apply(ops []Operation) error {
+	doc := d.Clone()
+	for _, op := range ops {
+		if err := doc.apply(op); err != nil {
+			return err
+		}
+	}
+	*d = doc
+	return nil
+}
+
+// CheckSize refuses a document past the limits of one saved through the api,
+// which live operations could otherwise grow it beyond.
+func (d Document) CheckSize() error {
+	if len(d.Blocs) > MaxBlocs {
+		return fmt.Errorf("document too large")
+	}
+	data, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	if len(data) > MaxDocumentSize {
+		return fmt.Errorf("document too large")
+	}
+	return nil
+}
+
+func (d *Document) apply(op Operation) error {
+	n := len(d.Blocs)
+	switch op.Type {
+	case InsertTextOp, DeleteTextOp, SetStyleOp, SetTypeOp, AddMarkOp, RemoveMarkOp, RemoveBlocOp, MoveBlocOp:
+		if op.Bloc < 0 || op.Bloc >= n {
+			return fmt.Errorf("%s: bloc %d out of range", op.Type, op.Bloc)
+		}
+	case InsertBlocOp:
+		if op.Bloc < 0 || op.Bloc > n {
+			return fmt.Errorf("%s: bloc %d out of range", op.Type, op.Bloc)
+		}
+	default:
+		return fmt.Errorf("unknown operation %q", op.Type)
+	}
+
+	switch op.Type {
+	case InsertTextOp:
+		text := []rune(d.Blocs[op.Bloc].Text)
+		if op.Offset < 0 || op.Offset > len(text) {
+			return fmt.Errorf("%s: offset %d out of range", op.Type, op.Offset)
+		}
+		d.Blocs[op.Bloc].Text = string(text[:op.Offset]) + op.Text + string(text[op.Offset:])
+		d.Blocs[op.Bloc].Marks = insertMarks(d.Blocs[op.Bloc].Marks, op.Offset, runeLen(op.Text), op.Marks)
+	case DeleteTextOp:
+		text := []rune(d.Blocs[op.Bloc].Text)
+		if op.Offset < 0 || op.Length < 0 || op.Offset+op.Length > len(text) {
+			return fmt.Errorf("%s: range %d+%d out of range", op.Type, op.Offset, op.Length)
+		}
+		d.Blocs[op.Bloc].Text = string(text[:op.Offset]) + string(text[op.Offset+op.Length:])
+		d.Blocs[op.Bloc].Marks = deleteMarks(d.Blocs[op.Bloc].Marks, op.Offset, op.Length)
+	case SetStyleOp:
+		if op.Style == nil {
+			return fmt.Errorf("%s: missing style", op.Type)
+		}
+		d.Blocs[op.Bloc].Style = *op.Style
+	case SetTypeOp:
+		if op.Value == nil {
+			return fmt.Errorf("%s: missing value", op.Type)
+		}
+		d.Blocs[op.Bloc].Type = op.Value.Kind()
+		d.Blocs[op.Bloc].Attrs = op.Value.Attrs
+	case AddMarkOp, RemoveMarkOp:
+		if op.Mark == nil {
+			return fmt.Errorf("%s: missing mark", op.Type)
+		}
+		if op.Offset < 0 || op.Length <= 0 || op.Offset+op.Length > runeLen(d.Blocs[op.Bloc].Text) {
+			return fmt.Errorf("%s: range %d+%d out of range", op.Type, op.Offset, op.Length)
+		}
+		marks := clearMark(d.Blocs[op.Bloc].Marks, op.Mark.Type, op.Offset, op.Offset+op.Length)
+		if op.Type == AddMarkOp {
+			mark := *op.Mark
+			mark.Start, mark.End = op.Offset, op.Offset+op.Length
+			marks = normalizeMarks(append(marks, mark))
+		}
+		d.Blocs[op.Bloc].Marks = marks
+	case InsertBlocOp:
+		b := Bloc{Type: ParagraphBloc}
+		if op.Value != nil {
+			b = *op.Value
+		}
+		d.Blocs = append(d.Blocs, Bloc{})
+		copy(d.Blocs[op.Bloc+1:], d.Blocs[op.Bloc:])
+		d.Blocs[op.Bloc] = b
+	case RemoveBlocOp:
+		d.Blocs = append(d.Blocs[:op.Bloc], d.Blocs[op.Bloc+1:]...)
+	case MoveBlocOp:
+		if op.To < 0 || op.To >= n {
+			return fmt.Errorf("%s: destination %d out of range", op.Type, op.To)
+		}
+		b := d.Blocs[op.Bloc]
+		d.Blocs = append(d.Blocs[:op.Bloc], d.Blocs[op.Bloc+1:]...)
+		d.Blocs = append(d.Blocs, Bloc{})
+		copy(d.Blocs[op.To+1:], d.Blocs[op.To:])
+		d.Blocs[op.To] = b
+	}
+	switch op.Type {
+	case InsertTextOp, SetTypeOp, AddMarkOp, InsertBlocOp:
+		if err := d.Blocs[op.Bloc].Validate(); err != nil {
+			return fmt.Errorf("%s: %s", op.Type, err.Error())
+		}
+	}
+	return nil
+}
+
+// Transform rewrites ops, written against the same revision as applied, so
+// that they can be applied after it. applied is transformed the other way
+// round so both sides converge: apply(applied) + ops' == apply(ops) + applied'.
+// When both sides insert at the same place, applied goes first.
+func Transform(ops, applied []Operation) ([]Operation, []Operation) {
+	if len(ops) == 0 || len(applied) == 0 {
+		return ops, applied
+	}
+	if len(ops) == 1 && len(applied) == 1 {
+		return transformOp(ops[0], applied[0], true), transformOp(applied[0], ops[0], false)
+	}
+	if len(ops) > 1 {
+		head, applied := Transform(ops[:1], applied)
+		tail, applied := Transform(ops[1:], applied)
+		return append(head, tail...), applied
+	}
+	ops, head := Transform(ops, applied[:1])
+	ops, tail := Transform(ops, applied[1:])
+	return ops, append(head, tail...)
+}
+
+// transformOp returns op rewritten to apply after against. againstFirst breaks
+// ties between two insertions at the same position.
+func transformOp(op, against Operation, againstFirst bool) []Operation {
+	switch against.Type {
+	case InsertBlocOp:
+		if op.Type == MoveBlocOp {
+			op.To = shiftPosition(op.To, removedPosition(against.Bloc, op.Bloc), againstFirst)
+			if op.Bloc >= against.Bloc {
+				op.Bloc++
+			}
+			return []Operation{op}
+		}
+		if op.Type == InsertBlocOp {
+			op.Bloc = shiftPosition(op.Bloc, against.Bloc, againstFirst)
+		} else if op.Bloc >= against.Bloc {
+			op.Bloc++
+		}
+		return []Operation{op}
+	case RemoveBlocOp:
+		if op.Type == InsertBlocOp {
+			if op.Bloc > against.Bloc {
+				op.Bloc--
+			}
+			return []Operation{op}
+		}
+		if op.Bloc == against.Bloc {
+			return nil
+		}
+		if op.Type == MoveBlocOp {
+			if op.To > removedPosition(against.Bloc, op.Bloc) {
+				op.To--
+			}
+		}
+		if op.Bloc > against.Bloc {
+			op.Bloc--
+		}
+		return []Operation{op}
+	case MoveBlocOp:
+		return transformAgainstMove(op, against, againstFirst)
+	}
+
+	if op.Bloc != against.Bloc {
+		return []Operation{op}
+	}
+	switch {
+	case op.Type == InsertTextOp && against.Type == InsertTextOp:
+		if against.Offset < op.Offset || (against.Offset == op.Offset && againstFirst) {
+			op.Offset += runeLen(against.Text)
+		}
+	case op.Type == InsertTextOp && against.Type == DeleteTextOp:
+		if op.Offset >= against.Offset+against.Length {
+			op.Offset -= against.Length
+		} else if op.Offset > against.Offset {
+			op.Offset = against.Offset
+		}
+	case op.Type == DeleteTextOp && against.Type == InsertTextOp:
+		inserted := runeLen(against.Text)
+		if against.Offset <= op.Offset {
+			op.Offset += inserted
+		} else if against.Offset < op.Offset+op.Length {
+			before := against.Offset - op.Offset
+			return []Operation{
+				{Type: DeleteTextOp, Bloc: op.Bloc, Offset: op.Offset, Length: before},
+				{Type: DeleteTextOp, Bloc: op.Bloc, Offset: op.Offset + inserted, Length: op.Length - before},
+			}
+		}
+	case op.Type == DeleteTextOp && against.Type == DeleteTextOp:
+		overlap := min(op.Offset+op.Length, against.Offset+against.Length) - max(op.Offset, against.Offset)
+		if op.Offset >= against.Offset+against.Length {
+			op.Offset -= against.Length
+		} else if op.Offset > against.Offset {
+			op.Offset = against.Offset
+		}
+		if overlap > 0 {
+			op.Length -= overlap
+		}
+		if op.Length == 0 {
+			return nil
+		}
+	case op.Type == SetStyleOp && against.Type == SetStyleOp,
+		op.Type == SetTypeOp && against.Type == SetTypeOp:
+		if againstFirst {
+			return nil
+		}
+	case isMarkOp(op) && against.Type == InsertTextOp:
+		// the inserted text keeps its own marks
+		inserted := runeLen(against.Text)
+		if against.Offset <= op.Offset {
+			op.Offset += inserted
+		} else if against.Offset < op.Offset+op.Length {
+			after := op
+			op.Length = against.Offset - op.Offset
+			after.Offset = against.Offset + inserted
+			after.Length -= op.Length
+			return []Operation{op, after}
+		}
+	case isMarkOp(op) && against.Type == DeleteTextOp:
+		end := deletedPosition(op.Offset+op.Length, against.Offset, against.Length)
+		op.Offset = deletedPosition(op.Offset, against.Offset, against.Length)
+		op.Length = end - op.Offset
+		if op.Length == 0 {
+			return nil
+		}
+	case isMarkOp(op) && isMarkOp(against) && op.Mark.Type == against.Mark.Type:
+		// where both format the same characters, applied wins
+		if !againstFirst {
+			break
+		}
+		var ops []Operation
+		if op.Offset < against.Offset {
+			before := op
+			before.Length = min(op.Length, against.Offset-op.Offset)
+			ops = append(ops, before)
+		}
+		if end := against.Offset + against.Length; op.Offset+op.Length > end {
+			after := op
+			after.Offset = max(op.Offset, end)
+			after.Length = op.Offset + op.Length - after.Offset
+			ops = append(ops, after)
+		}
+		return ops
+	}
+	return []Operation{op}
+}
+
+func transformAgainstMove(op, against Operation, againstFirst bool) []Operation {
+	switch op.Type {
+	case InsertBlocOp:
+		p := op.Bloc
+		if p > against.Bloc {
+			p--
+		}
+		op.Bloc = shiftPosition(p, against.To, againstFirst)
+	case MoveBlocOp:
+		if op.Bloc == against.Bloc {
+			if againstFirst {
+				return nil
+			}
+			op.Bloc = against.To
+			return []Operation{op}
+		}
+		from := movedIndex(op.Bloc, against)
+		// against seen from the list without the bloc op is moving
+		removedAt := removedPosition(against.Bloc, op.Bloc)
+		insertedAt := removedPosition(against.To, from)
+		to := op.To
+		if to > removedAt {
+			to--
+		}
+		op.To = shiftPosition(to, insertedAt, againstFirst)
+		op.Bloc = from
+	default:
+		op.Bloc = movedIndex(op.Bloc, against)
+	}
+	return []Operation{op}
+}
+
+func isMarkOp(op Operation) bool {
+	return (op.Type == AddMarkOp || op.Type == RemoveMarkOp) && op.Mark != nil
+}
+
+// movedIndex is the index of bloc i once move has been applied.
+func movedIndex(i int, move Operation) int {
+	if i == move.Bloc {
+		return move.To
+	}
+	if i > move.Bloc {
+		i--
+	}
+	if i >= move.To {
+		i++
+	}
+	return i
+}
+
+// removedPosition is the index i takes once the bloc at removed is taken out.
+func removedPosition(i, removed int) int {
+	if i > removed {
+		return i - 1
+	}
+	return i
+}
+
+// shiftPosition moves an insertion position past a bloc inserted at at.
+func shiftPosition(p, at int, atFirst bool) int {
+	if p > at || (p == at && atFirst) {
+		return p + 1
+	}
+	return p
+}
+
+func runeLen(s string) int {
+	return len([]rune(s))
+}
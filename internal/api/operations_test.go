@@ -0,0 +1,183 @@
+package api
+
+import (
+	"math/rand/v2"
+	"strings"
+	"testing"
+)
+
+var opTypes = []string{
+	InsertTextOp, DeleteTextOp, InsertBlocOp, RemoveBlocOp, MoveBlocOp,
+	SetStyleOp, SetTypeOp, AddMarkOp, RemoveMarkOp,
+}
+
+// randomOp returns a valid operation of the given type against doc, false if
+// the document has no room for one.
+func randomOp(rng *rand.Rand, doc Document, opType string) (Operation, bool) {
+	n := len(doc.Blocs)
+	if n == 0 && opType != InsertBlocOp {
+		return Operation{}, false
+	}
+	op := Operation{Type: opType}
+	if n > 0 {
+		op.Bloc = rng.IntN(n)
+	}
+	length := 0
+	if n > 0 {
+		length = runeLen(doc.Blocs[op.Bloc].Text)
+	}
+	marks := []Mark{{Type: BoldMark}, {Type: LinkMark, Value: "https://a.example"}, {Type: LinkMark, Value: "https://b.example"}}
+	switch opType {
+	case InsertTextOp:
+		op.Offset = rng.IntN(length + 1)
+		op.Text = []string{"a", "bc", "déf"}[rng.IntN(3)]
+		if rng.IntN(3) == 0 {
+			op.Marks = []Mark{{Type: ItalicMark, Start: 0, End: runeLen(op.Text)}}
+		}
+	case DeleteTextOp, AddMarkOp, RemoveMarkOp:
+		if length == 0 {
+			return Operation{}, false
+		}
+		op.Offset = rng.IntN(length)
+		op.Length = 1 + rng.IntN(length-op.Offset)
+		if opType != DeleteTextOp {
+			mark := marks[rng.IntN(len(marks))]
+			op.Mark = &mark
+		}
+	case InsertBlocOp:
+		op.Bloc = rng.IntN(n + 1)
+		op.Value = &Bloc{Type: ParagraphBloc, Text: []string{"", "new", "xyz"}[rng.IntN(3)]}
+	case MoveBlocOp:
+		op.To = rng.IntN(n)
+	case SetStyleOp:
+		op.Style = &Styling{Font: []string{"serif", "mono"}[rng.IntN(2)]}
+	case SetTypeOp:
+		op.Value = []*Bloc{
+			{Type: ParagraphBloc},
+			{Type: QuoteBloc},
+			{Type: HeadingBloc, Attrs: BlocAttrs{Level: 2}},
+			{Type: CodeBloc, Attrs: BlocAttrs{Language: "go"}},
+		}[rng.IntN(4)]
+	}
+	return op, true
+}
+
+// randomOps returns up to three operations in a row against doc.
+func randomOps(rng *rand.Rand, doc Document) []Operation {
+	doc = doc.Clone()
+	var ops []Operation
+	for range 1 + rng.IntN(3) {
+		op, ok := randomOp(rng, doc, opTypes[rng.IntN(len(opTypes))])
+		if !ok {
+			continue
+		}
+		if err := doc.apply(op); err != nil {
+			panic(err)
+		}
+		ops = append(ops, op)
+	}
+	return ops
+}
+
+func randomDocument(rng *rand.Rand) Document {
+	var doc Document
+	for range rng.IntN(4) {
+		b := Bloc{Type: ParagraphBloc, Text: []string{"", "a", "hello", "wörld!"}[rng.IntN(4)]}
+		if n := runeLen(b.Text); n > 1 && rng.IntN(2) == 0 {
+			b.Marks = []Mark{{Type: BoldMark, Start: 0, End: n / 2}, {Type: LinkMark, Value: "https://a.example", Start: n / 2, End: n}}
+		}
+		doc.Blocs = append(doc.Blocs, b)
+	}
+	return doc
+}
+
+func sameDocument(a, b Document) bool {
+	if len(a.Blocs) != len(b.Blocs) {
+		return false
+	}
+	for i := range a.Blocs {
+		if !a.Blocs[i].Equal(b.Blocs[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// TestTransformConverges applies random concurrent edits in both orders and
+// checks both sides end up with the same document:
+// apply(applied) + ops' == apply(ops) + applied'.
+func TestTransformConverges(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	pairs := map[[2]string]bool{}
+	for i := range 50000 {
+		base := randomDocument(rng)
+		ops := randomOps(rng, base)
+		applied := randomOps(rng, base)
+		for _, a := range ops {
+			for _, b := range applied {
+				pairs[[2]string{a.Type, b.Type}] = true
+			}
+		}
+		opsAfter, appliedAfter := Transform(ops, applied)
+
+		server := base.Clone()
+		if err := server.Apply(applied); err != nil {
+			t.Fatalf("case %d: applied: %v", i, err)
+		}
+		if err := server.Apply(opsAfter); err != nil {
+			t.Fatalf("case %d: %+v\nops %+v\napplied %+v\nops' %+v: %v", i, base, ops, applied, opsAfter, err)
+		}
+		client := base.Clone()
+		if err := client.Apply(ops); err != nil {
+			t.Fatalf("case %d: ops: %v", i, err)
+		}
+		if err := client.Apply(appliedAfter); err != nil {
+			t.Fatalf("case %d: %+v\nops %+v\napplied %+v\napplied' %+v: %v", i, base, ops, applied, appliedAfter, err)
+		}
+		if !sameDocument(server, client) {
+			t.Fatalf("case %d: %+v\nops %+v\napplied %+v\ngot %+v\nand %+v", i, base, ops, applied, server, client)
+		}
+	}
+	for _, a := range opTypes {
+		for _, b := range opTypes {
+			if !pairs[[2]string{a, b}] {
+				t.Errorf("%s against %s never tried", a, b)
+			}
+		}
+	}
+}
+
+func TestTransformInsertTie(t *testing.T) {
+	base := Document{Blocs: []Bloc{{Type: ParagraphBloc, Text: "ac"}}}
+	ops := []Operation{{Type: InsertTextOp, Bloc: 0, Offset: 1, Text: "x"}}
+	applied := []Operation{{Type: InsertTextOp, Bloc: 0, Offset: 1, Text: "b"}}
+	opsAfter, _ := Transform(ops, applied)
+	doc := base.Clone()
+	if err := doc.Apply(append(applied, opsAfter...)); err != nil {
+		t.Fatal(err)
+	}
+	// applied goes first when both insert at the same place
+	if doc.Blocs[0].Text != "abxc" {
+		t.Fatalf("got %q, want %q", doc.Blocs[0].Text, "abxc")
+	}
+}
+
+func TestCheckSize(t *testing.T) {
+	doc := Document{Blocs: []Bloc{{Type: ParagraphBloc}}}
+	text := strings.Repeat("a", MaxDocumentSize/2)
+	if err := doc.Apply([]Operation{{Type: InsertTextOp, Bloc: 0, Text: text}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := doc.CheckSize(); err != nil {
+		t.Fatalf("document of %d characters: %v", len(doc.Blocs[0].Text), err)
+	}
+	if err := doc.Apply([]Operation{{Type: InsertBlocOp, Bloc: 1, Value: &Bloc{Text: text}}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := doc.CheckSize(); err == nil {
+		t.Fatalf("document of %d characters accepted", 2*len(text))
+	}
+	if err := (Document{Blocs: make([]Bloc, MaxBlocs+1)}).CheckSize(); err == nil {
+		t.Fatalf("%d blocs accepted", MaxBlocs+1)
+	}
+}
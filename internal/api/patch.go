@@ -0,0 +1,164 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+)
+
+// ReplaceBlocOp replaces a bloc as a whole by Value. Only patches accept it,
+// collaborators remove and insert the bloc instead.
+const ReplaceBlocOp = "replace_bloc"
+
+const (
+	jsonPatchContentType = "application/json-patch+json"
+	// patchAttempts bounds how often a patch sent with "If-Match: *" is applied
+	// again after a concurrent write
+	patchAttempts = 3
+)
+
+// PatchDocumentHandler applies a partial update to the stored content, either
+// a JSON Patch (RFC 6902) sent as application/json-patch+json or a list of
+// bloc operations sent as application/json, like collaborators send. The
+// patch is applied as a whole or not at all, against the revision named by
+// If-Match, and the new revision is returned.
+func (cfg *ApiConfig) PatchDocumentHandler(w http.ResponseWriter, r *http.Request) {
+	type opsBody struct {
+		Ops []Operation `json:"ops"`
+	}
+	type responseBody struct {
+		Revision int64 `json:"revision"`
+	}
+	userId, documentId, err := getDocumentAndUserFromUrl(r)
+	if err != nil {
+		RespondWithError(w, ParseStatusFromError(err), err.Error())
+		return
+	}
+	role, err := cfg.GetUserRole(r.Context(), userId, documentId)
+	if err != nil {
+		RespondWithError(w, ParseStatusFromError(err), err.Error())
+		return
+	}
+	if role == ViewerRole {
+		RespondWithError(w, 403, "user not authorized")
+		return
+	}
+	revision, err := ifMatchRevision(r)
+	if err != nil {
+		RespondWithError(w, ParseStatusFromError(err), err.Error())
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, MaxDocumentSize)
+	defer r.Body.Close()
+	decoder := json.NewDecoder(r.Body)
+	var apply func(doc *Document) error
+	contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch contentType {
+	case jsonPatchContentType:
+		var patch []JSONPatchOp
+		if err := decoder.Decode(&patch); err != nil {
+			RespondWithError(w, 400, err.Error())
+			return
+		}
+		apply = func(doc *Document) error {
+			return doc.ApplyJSONPatch(patch)
+		}
+	case "application/json", "":
+		var params opsBody
+		if err := decoder.Decode(&params); err != nil {
+			RespondWithError(w, 400, err.Error())
+			return
+		}
+		apply = func(doc *Document) error {
+			return doc.applyPatchOps(params.Ops)
+		}
+	default:
+		RespondWithError(w, 415, "send a json patch as "+jsonPatchContentType+" or operations as application/json")
+		return
+	}
+
+	var doc Document
+	var saved int64
+	for attempt := 1; ; attempt++ {
+		current, err := cfg.Db.GetDocumentRevision(r.Context(), documentId)
+		if err != nil {
+			RespondWithError(w, 500, err.Error())
+			return
+		}
+		if revision != AnyRevision && revision != current {
+			respondStale(w, current)
+			return
+		}
+		doc, err = cfg.LoadDocument(r.Context(), documentId)
+		if err != nil {
+			RespondWithError(w, 500, err.Error())
+			return
+		}
+		if err := apply(&doc); err != nil {
+			RespondWithError(w, ParseStatusFromError(err), err.Error())
+			return
+		}
+		if len(doc.Blocs) > MaxBlocs {
+			RespondWithError(w, 413, "document too large")
+			return
+		}
+		if err := doc.Validate(); err != nil {
+			RespondWithError(w, 422, err.Error())
+			return
+		}
+		saved, err = cfg.SaveDocument(r.Context(), documentId, current, doc)
+		if errors.Is(err, ErrStaleRevision) && revision == AnyRevision && attempt < patchAttempts {
+			continue
+		}
+		if errors.Is(err, ErrStaleRevision) {
+			current, err := cfg.Db.GetDocumentRevision(r.Context(), documentId)
+			if err != nil {
+				RespondWithError(w, 404, "document not found")
+				return
+			}
+			respondStale(w, current)
+			return
+		}
+		if err != nil {
+			RespondWithError(w, 500, err.Error())
+			return
+		}
+		break
+	}
+	cfg.documentChanged(documentId, saved, doc)
+	// like for a PUT, a missing version does not fail the saved patch
+	if _, err := cfg.CreateVersion(r.Context(), documentId, userId, SaveVersion, "", doc); err != nil {
+		fmt.Printf("error while recording a version of %s :%s\n", documentId, err.Error())
+	}
+	w.Header().Set("ETag", revisionETag(saved))
+	RespondWithJson(w, 200, responseBody{Revision: saved})
+}
+
+// applyPatchOps runs bloc operations like Apply, with replace_bloc on top.
+// The document is left untouched if one of them is invalid.
+func (d *Document) applyPatchOps(ops []Operation) error {
+	doc := d.Clone()
+	for _, op := range ops {
+		if op.Type != ReplaceBlocOp {
+			if err := doc.Apply([]Operation{op}); err != nil {
+				return fmt.Errorf("422: %s", err.Error())
+			}
+			continue
+		}
+		if op.Bloc < 0 || op.Bloc >= len(doc.Blocs) {
+			return fmt.Errorf("422: %s: bloc %d out of range", op.Type, op.Bloc)
+		}
+		if op.Value == nil {
+			return fmt.Errorf("422: %s: missing value", op.Type)
+		}
+		if err := op.Value.Validate(); err != nil {
+			return fmt.Errorf("422: %s: %s", op.Type, err.Error())
+		}
+		doc.Blocs[op.Bloc] = *op.Value
+	}
+	*d = doc
+	return nil
+}
@@ -0,0 +1,41 @@
+package api
+
+import (
+	"testing"
+)
+
+func TestApplyPatchOps(t *testing.T) {
+	doc := Document{Blocs: []Bloc{
+		{Type: ParagraphBloc, Text: "one"},
+		{Type: ParagraphBloc, Text: "two"},
+	}}
+	err := doc.applyPatchOps([]Operation{
+		{Type: InsertTextOp, Bloc: 0, Offset: 3, Text: "!"},
+		{Type: ReplaceBlocOp, Bloc: 1, Value: &Bloc{Type: HeadingBloc, Text: "Two", Attrs: BlocAttrs{Level: 1}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.Blocs[0].Text != "one!" || doc.Blocs[1].Kind() != HeadingBloc || doc.Blocs[1].Text != "Two" {
+		t.Fatalf("got %+v", doc.Blocs)
+	}
+
+	invalid := [][]Operation{
+		{{Type: ReplaceBlocOp, Bloc: 2, Value: &Bloc{Text: "three"}}},
+		{{Type: ReplaceBlocOp, Bloc: 0}},
+		{{Type: ReplaceBlocOp, Bloc: 0, Value: &Bloc{Type: HeadingBloc}}},
+		{{Type: InsertTextOp, Bloc: 0, Offset: 99, Text: "x"}},
+	}
+	for _, ops := range invalid {
+		// the first operation is valid and must be dropped along with the rest
+		ops = append([]Operation{{Type: RemoveBlocOp, Bloc: 0}}, ops...)
+		before := doc.Clone()
+		err := doc.applyPatchOps(ops)
+		if err == nil || ParseStatusFromError(err) != 422 {
+			t.Errorf("%+v: got %v, want a 422", ops, err)
+		}
+		if len(doc.Blocs) != len(before.Blocs) || !doc.Blocs[0].Equal(before.Blocs[0]) {
+			t.Errorf("%+v: document changed by a failed patch", ops)
+		}
+	}
+}
@@ -0,0 +1,702 @@
+package api
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/base64"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// PDFOptions are the page settings of a pdf export, the margin is in
+// millimetres.
+type PDFOptions struct {
+	PageSize  string
+	Landscape bool
+	Margin    float64
+}
+
+// pdfPageSizes are the sizes of the pages in points, portrait.
+var pdfPageSizes = map[string][2]float64{
+	"a3":     {841.89, 1190.55},
+	"a4":     {595.28, 841.89},
+	"a5":     {419.53, 595.28},
+	"letter": {612, 792},
+	"legal":  {612, 1008},
+}
+
+const (
+	defaultPageSize = "a4"
+	defaultMargin   = 20
+	minMargin       = 5
+	maxMargin       = 50
+	pointsPerMm     = 72 / 25.4
+	// maxImagePixels bounds the images decoded for a pdf, a small png can
+	// claim a huge size
+	maxImagePixels = 25_000_000
+)
+
+var (
+	pdfTextColor  = [3]float64{0.12, 0.14, 0.16}
+	pdfMutedColor = [3]float64{0.4, 0.42, 0.45}
+	pdfLinkColor  = [3]float64{0.04, 0.41, 0.85}
+	pdfRuleColor  = [3]float64{0.82, 0.85, 0.88}
+	pdfShadeColor = [3]float64{0.96, 0.97, 0.98}
+	pdfHeadings   = [maxHeadingLevel]float64{22, 18, 15, 13, 12, 11}
+)
+
+// ParsePDFOptions reads the page settings from the parameters page (a3, a4,
+// a5, letter or legal), orientation (portrait or landscape) and margin.
+func ParsePDFOptions(values url.Values) (PDFOptions, error) {
+	options := PDFOptions{PageSize: defaultPageSize, Margin: defaultMargin}
+	if page := strings.ToLower(values.Get("page")); page != "" {
+		if _, ok := pdfPageSizes[page]; !ok {
+			return PDFOptions{}, fmt.Errorf("400: unknown page size %q", page)
+		}
+		options.PageSize = page
+	}
+	switch values.Get("orientation") {
+	case "", "portrait":
+	case "landscape":
+		options.Landscape = true
+	default:
+		return PDFOptions{}, fmt.Errorf("400: orientation must be portrait or landscape")
+	}
+	if margin := values.Get("margin"); margin != "" {
+		m, err := strconv.ParseFloat(margin, 64)
+		if err != nil || m < minMargin || m > maxMargin {
+			return PDFOptions{}, fmt.Errorf("400: margin must be between %d and %d millimetres", minMargin, maxMargin)
+		}
+		options.Margin = m
+	}
+	return options, nil
+}
+
+// RenderPDF lays the document out on pages, with its name at the top of
+// every page and the page number at the bottom. It only uses the standard
+// pdf fonts, so text outside the latin characters of WinAnsiEncoding shows
+// as question marks.
+func RenderPDF(doc Document, name string, options PDFOptions) ([]byte, error) {
+	size, ok := pdfPageSizes[options.PageSize]
+	if !ok {
+		return nil, fmt.Errorf("400: unknown page size %q", options.PageSize)
+	}
+	if options.Margin < minMargin || options.Margin > maxMargin {
+		return nil, fmt.Errorf("400: margin must be between %d and %d millimetres", minMargin, maxMargin)
+	}
+	if options.Landscape {
+		size[0], size[1] = size[1], size[0]
+	}
+	l := &pdfLayout{width: size[0], height: size[1], margin: options.Margin * pointsPerMm}
+	l.newPage()
+	var counters []int
+	for _, b := range doc.Blocs {
+		kind := b.Kind()
+		if kind != BulletedListBloc && kind != NumberedListBloc && kind != ChecklistBloc {
+			counters = nil
+		}
+		base := pdfStyle{font: pdfFont{family: helvetica}, size: 11, color: pdfTextColor}
+		switch kind {
+		case HeadingBloc:
+			base.size = pdfHeadings[min(max(b.Attrs.Level, 1), maxHeadingLevel)-1]
+			base.font.bold = true
+			l.gap(base.size * 0.6)
+			l.text(pdfPieces(b, base), base.size, l.margin, l.contentWidth(), nil)
+			l.gap(4)
+		case BulletedListBloc, NumberedListBloc, ChecklistBloc:
+			level := min(max(b.Attrs.Level, 0), maxListLevel)
+			for len(counters) <= level {
+				counters = append(counters, 0)
+			}
+			counters = counters[:level+1]
+			counters[level]++
+			if kind != NumberedListBloc {
+				counters[level] = 0
+			}
+			indent := l.margin + 18*float64(level+1)
+			number := counters[level]
+			l.text(pdfPieces(b, base), base.size, indent, l.contentWidth()-(indent-l.margin), func(line int, top, height float64) {
+				if line > 0 {
+					return
+				}
+				l.marker(kind, number, b.Attrs.Checked, indent, top, base)
+			})
+			l.gap(3)
+		case QuoteBloc:
+			base.color = pdfMutedColor
+			l.text(pdfPieces(b, base), base.size, l.margin+14, l.contentWidth()-14, func(_ int, top, height float64) {
+				l.rect(l.margin+3, top, 2.5, height, pdfRuleColor, true)
+			})
+			l.gap(6)
+		case CodeBloc:
+			base.font.family = courier
+			base.size = 9.5
+			l.gap(2)
+			l.text(pdfPieces(Bloc{Text: b.Text}, base), base.size, l.margin+6, l.contentWidth()-12, func(_ int, top, height float64) {
+				l.rect(l.margin, top, l.contentWidth(), height, pdfShadeColor, true)
+			})
+			l.gap(8)
+		case TableBloc:
+			l.table(b.Attrs.Rows)
+			l.gap(8)
+		case RuleBloc:
+			l.space(12)
+			l.stroke(l.margin, l.y+6, l.margin+l.contentWidth(), l.y+6, 0.75, pdfRuleColor)
+			l.y += 12
+		case ImageBloc:
+			if !l.image(b.Attrs) {
+				base.font.italic = true
+				base.color = pdfMutedColor
+				alt := "[image]"
+				if b.Attrs.Alt != "" {
+					alt = "[image: " + b.Attrs.Alt + "]"
+				}
+				l.text(pdfPieces(Bloc{Text: alt}, base), base.size, l.margin, l.contentWidth(), nil)
+			}
+			l.gap(6)
+		default:
+			l.text(pdfPieces(b, base), base.size, l.margin, l.contentWidth(), nil)
+			l.gap(6)
+		}
+	}
+	return l.bytes(name), nil
+}
+
+type pdfStyle struct {
+	font      pdfFont
+	size      float64
+	color     [3]float64
+	underline bool
+	strike    bool
+	link      string
+}
+
+// pdfPiece is text of the same style, encoded in WinAnsiEncoding.
+type pdfPiece struct {
+	text  []byte
+	style pdfStyle
+}
+
+func (p pdfPiece) width() float64 {
+	return p.style.font.width(p.text) * p.style.size
+}
+
+type pdfLine struct {
+	pieces []pdfPiece
+	width  float64
+	size   float64
+}
+
+func (l *pdfLine) add(p pdfPiece) {
+	if n := len(l.pieces); n > 0 && l.pieces[n-1].style == p.style {
+		l.pieces[n-1].text = append(l.pieces[n-1].text, p.text...)
+	} else {
+		p.text = append([]byte(nil), p.text...)
+		l.pieces = append(l.pieces, p)
+	}
+	l.width += p.width()
+	l.size = max(l.size, p.style.size)
+}
+
+// pdfPieces splits the text of a bloc in pieces of the same style, words,
+// spaces and line breaks apart. The style of the bloc comes through its
+// runs.
+func pdfPieces(b Bloc, base pdfStyle) []pdfPiece {
+	var pieces []pdfPiece
+	for _, run := range b.Runs() {
+		style := base
+		code := false
+		for _, m := range run.Marks {
+			switch m.Type {
+			case BoldMark:
+				style.font.bold = true
+			case ItalicMark:
+				style.font.italic = true
+			case UnderlineMark:
+				style.underline = true
+			case StrikeMark:
+				style.strike = true
+			case CodeMark:
+				code = true
+			case LinkMark:
+				if validLink(m.Value) {
+					style.link = m.Value
+					style.color = pdfLinkColor
+					style.underline = true
+				}
+			case ColorMark:
+				if color, ok := pdfColor(m.Value); ok && style.link == "" {
+					style.color = color
+				}
+			case FontMark:
+				if fontValue.MatchString(m.Value) {
+					style.font.family = pdfFontFamily(m.Value)
+				}
+			}
+		}
+		if code {
+			style.font.family = courier
+		}
+		text := pdfEncode(run.Text)
+		for len(text) > 0 {
+			n := 1
+			switch {
+			case text[0] == '\n':
+			case text[0] == ' ':
+				for n < len(text) && text[n] == ' ' {
+					n++
+				}
+			default:
+				for n < len(text) && text[n] != ' ' && text[n] != '\n' {
+					n++
+				}
+			}
+			pieces = append(pieces, pdfPiece{text: text[:n], style: style})
+			text = text[n:]
+		}
+	}
+	return pieces
+}
+
+// wrapPieces breaks pieces into lines no wider than width, at spaces and line
+// breaks, and inside words longer than a line. Spaces where a line wraps are
+// dropped.
+func wrapPieces(pieces []pdfPiece, width, size float64) []pdfLine {
+	var lines []pdfLine
+	line := pdfLine{size: size}
+	wrapped := false
+	flush := func(wrap bool) {
+		for n := len(line.pieces); n > 0; n = len(line.pieces) {
+			last := &line.pieces[n-1]
+			trimmed := pdfPiece{text: bytes.TrimRight(last.text, " "), style: last.style}
+			line.width -= last.width() - trimmed.width()
+			if len(trimmed.text) > 0 {
+				last.text = trimmed.text
+				break
+			}
+			line.pieces = line.pieces[:n-1]
+		}
+		lines = append(lines, line)
+		line = pdfLine{size: size}
+		wrapped = wrap
+	}
+	for i := 0; i < len(pieces); {
+		p := pieces[i]
+		switch p.text[0] {
+		case '\n':
+			flush(false)
+			i++
+			continue
+		case ' ':
+			if len(line.pieces) > 0 || !wrapped {
+				line.add(p)
+			}
+			i++
+			continue
+		}
+		j := i
+		wordWidth := 0.0
+		for ; j < len(pieces) && pieces[j].text[0] != ' ' && pieces[j].text[0] != '\n'; j++ {
+			wordWidth += pieces[j].width()
+		}
+		if line.width+wordWidth > width && len(line.pieces) > 0 {
+			flush(true)
+		}
+		fits := line.width+wordWidth <= width
+		for _, p := range pieces[i:j] {
+			if fits {
+				line.add(p)
+				continue
+			}
+			// the word is longer than a line
+			for k := range p.text {
+				c := pdfPiece{text: p.text[k : k+1], style: p.style}
+				if line.width+c.width() > width && len(line.pieces) > 0 {
+					flush(true)
+				}
+				line.add(c)
+			}
+		}
+		i = j
+	}
+	flush(false)
+	return lines
+}
+
+type pdfLink struct {
+	rect [4]float64
+	url  string
+}
+
+type pdfPage struct {
+	content bytes.Buffer
+	links   []pdfLink
+}
+
+type pdfImage struct {
+	width, height int
+	data          []byte
+}
+
+// pdfLayout places content on pages, y is the position from the top of the
+// current page.
+type pdfLayout struct {
+	width, height, margin float64
+	pages                 []*pdfPage
+	current               int
+	y                     float64
+	fonts                 [12]bool
+	images                []pdfImage
+}
+
+func (l *pdfLayout) contentWidth() float64 {
+	return l.width - 2*l.margin
+}
+
+func (l *pdfLayout) page() *pdfPage {
+	return l.pages[l.current]
+}
+
+func (l *pdfLayout) newPage() {
+	l.pages = append(l.pages, &pdfPage{})
+	l.current = len(l.pages) - 1
+	l.y = l.margin
+}
+
+// space starts a new page unless there is room for height on this one or
+// the page is empty.
+func (l *pdfLayout) space(height float64) {
+	if l.y+height > l.height-l.margin && l.y > l.margin {
+		l.newPage()
+	}
+}
+
+// gap leaves vertical space, except at the top of a page.
+func (l *pdfLayout) gap(height float64) {
+	if l.y > l.margin {
+		l.y += height
+	}
+}
+
+// text wraps pieces in a column and draws them line by line, decorate draws
+// behind each line before its text.
+func (l *pdfLayout) text(pieces []pdfPiece, size, x, width float64, decorate func(line int, top, height float64)) {
+	for i, line := range wrapPieces(pieces, width, size) {
+		height := line.size * 1.35
+		l.space(height)
+		if decorate != nil {
+			decorate(i, l.y, height)
+		}
+		l.drawLine(line, x, l.y+line.size*1.05)
+		l.y += height
+	}
+}
+
+func (l *pdfLayout) drawLine(line pdfLine, x, baseline float64) {
+	for _, p := range line.pieces {
+		w := p.width()
+		l.drawText(p, x, baseline)
+		if p.style.underline {
+			l.stroke(x, baseline+p.style.size*0.12, x+w, baseline+p.style.size*0.12, p.style.size*0.06, p.style.color)
+		}
+		if p.style.strike {
+			l.stroke(x, baseline-p.style.size*0.28, x+w, baseline-p.style.size*0.28, p.style.size*0.06, p.style.color)
+		}
+		if p.style.link != "" {
+			l.page().links = append(l.page().links, pdfLink{
+				rect: [4]float64{x, l.height - baseline - p.style.size*0.25, x + w, l.height - baseline + p.style.size*0.85},
+				url:  p.style.link,
+			})
+		}
+		x += w
+	}
+}
+
+func (l *pdfLayout) drawText(p pdfPiece, x, baseline float64) {
+	l.fonts[p.style.font.index()] = true
+	c := p.style.color
+	fmt.Fprintf(&l.page().content, "BT /F%d %.2f Tf %.3f %.3f %.3f rg %.2f %.2f Td %s Tj ET\n",
+		p.style.font.index()+1, p.style.size, c[0], c[1], c[2], x, l.height-baseline, pdfString(p.text))
+}
+
+func (l *pdfLayout) stroke(x1, y1, x2, y2, width float64, c [3]float64) {
+	fmt.Fprintf(&l.page().content, "%.3f %.3f %.3f RG %.2f w %.2f %.2f m %.2f %.2f l S\n",
+		c[0], c[1], c[2], width, x1, l.height-y1, x2, l.height-y2)
+}
+
+func (l *pdfLayout) rect(x, top, width, height float64, c [3]float64, fill bool) {
+	if fill {
+		fmt.Fprintf(&l.page().content, "%.3f %.3f %.3f rg %.2f %.2f %.2f %.2f re f\n",
+			c[0], c[1], c[2], x, l.height-top-height, width, height)
+		return
+	}
+	fmt.Fprintf(&l.page().content, "%.3f %.3f %.3f RG 0.75 w %.2f %.2f %.2f %.2f re S\n",
+		c[0], c[1], c[2], x, l.height-top-height, width, height)
+}
+
+// marker draws the bullet, number or checkbox of a list item before indent.
+func (l *pdfLayout) marker(kind string, number int, checked bool, indent, top float64, base pdfStyle) {
+	baseline := top + base.size*1.05
+	switch kind {
+	case NumberedListBloc:
+		p := pdfPiece{text: []byte(strconv.Itoa(number) + "."), style: base}
+		l.drawText(p, indent-4-p.width(), baseline)
+	case ChecklistBloc:
+		box := base.size * 0.75
+		x, y := indent-14, baseline-box
+		l.rect(x, y, box, box, base.color, false)
+		if checked {
+			l.stroke(x+box*0.2, y+box*0.5, x+box*0.42, y+box*0.78, 1.2, base.color)
+			l.stroke(x+box*0.42, y+box*0.78, x+box*0.85, y+box*0.18, 1.2, base.color)
+		}
+	default:
+		p := pdfPiece{text: pdfEncode("•"), style: base}
+		l.drawText(p, indent-11, baseline)
+	}
+}
+
+// table draws the rows with the first one as header, repeated on the pages
+// the table continues on.
+func (l *pdfLayout) table(rows [][]string) {
+	if len(rows) == 0 || len(rows[0]) == 0 {
+		return
+	}
+	const padding = 4
+	columnWidth := l.contentWidth() / float64(len(rows[0]))
+	style := pdfStyle{font: pdfFont{family: helvetica}, size: 10, color: pdfTextColor}
+	cells := func(row []string, header bool) ([][]pdfLine, float64) {
+		s := style
+		s.font.bold = header
+		var lines [][]pdfLine
+		height := 0.0
+		for _, cell := range row {
+			cellLines := wrapPieces(pdfPieces(Bloc{Text: cell}, s), columnWidth-2*padding, s.size)
+			lines = append(lines, cellLines)
+			height = max(height, float64(len(cellLines))*s.size*1.35+2*padding)
+		}
+		return lines, height
+	}
+	drawRow := func(lines [][]pdfLine, height float64, header bool) {
+		for i, cellLines := range lines {
+			x := l.margin + float64(i)*columnWidth
+			if header {
+				l.rect(x, l.y, columnWidth, height, pdfShadeColor, true)
+			}
+			l.rect(x, l.y, columnWidth, height, pdfRuleColor, false)
+			for j, line := range cellLines {
+				l.drawLine(line, x+padding, l.y+padding+float64(j)*style.size*1.35+style.size*1.05)
+			}
+		}
+		l.y += height
+	}
+	header, headerHeight := cells(rows[0], true)
+	l.space(headerHeight)
+	drawRow(header, headerHeight, true)
+	for _, row := range rows[1:] {
+		lines, height := cells(row, false)
+		page := len(l.pages)
+		l.space(height)
+		if len(l.pages) != page {
+			drawRow(header, headerHeight, true)
+		}
+		drawRow(lines, height, false)
+	}
+}
+
+// image draws an image given inline as a data url, images from other sites
+// are not fetched. It reports false when the image cannot be drawn.
+func (l *pdfLayout) image(attrs BlocAttrs) bool {
+	data, ok := strings.CutPrefix(attrs.Src, "data:")
+	if !ok {
+		return false
+	}
+	_, encoded, ok := strings.Cut(data, ";base64,")
+	if !ok {
+		return false
+	}
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return false
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(raw))
+	if err != nil || config.Width == 0 || config.Height == 0 || config.Width*config.Height > maxImagePixels {
+		return false
+	}
+	img, _, err := image.Decode(bytes.NewReader(raw))
+	if err != nil {
+		return false
+	}
+	bounds := img.Bounds()
+	// composite on white, pdf images are opaque
+	rgb := make([]byte, 0, bounds.Dx()*bounds.Dy()*3)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, a := img.At(x, y).RGBA()
+			white := 0xffff - a
+			rgb = append(rgb, byte((r+white)>>8), byte((g+white)>>8), byte((b+white)>>8))
+		}
+	}
+	// one pixel is drawn as a css pixel unless the bloc gives a size
+	width, height := float64(bounds.Dx())*0.75, float64(bounds.Dy())*0.75
+	switch {
+	case attrs.Width > 0 && attrs.Height > 0:
+		width, height = float64(attrs.Width)*0.75, float64(attrs.Height)*0.75
+	case attrs.Width > 0:
+		width, height = float64(attrs.Width)*0.75, height*float64(attrs.Width)*0.75/width
+	case attrs.Height > 0:
+		width, height = width*float64(attrs.Height)*0.75/height, float64(attrs.Height)*0.75
+	}
+	if maxWidth := l.contentWidth(); width > maxWidth {
+		width, height = maxWidth, height*maxWidth/width
+	}
+	if maxHeight := l.height - 2*l.margin; height > maxHeight {
+		width, height = width*maxHeight/height, maxHeight
+	}
+	l.images = append(l.images, pdfImage{width: bounds.Dx(), height: bounds.Dy(), data: deflate(rgb)})
+	l.space(height)
+	fmt.Fprintf(&l.page().content, "q %.2f 0 0 %.2f %.2f %.2f cm /Im%d Do Q\n",
+		width, height, l.margin, l.height-l.y-height, len(l.images))
+	l.y += height
+	return true
+}
+
+// bytes writes the pdf file, drawing the header and footer of every page now
+// that the number of pages is known.
+func (l *pdfLayout) bytes(name string) []byte {
+	style := pdfStyle{font: pdfFont{family: helvetica}, size: 9, color: pdfMutedColor}
+	for i := range l.pages {
+		l.current = i
+		title := pdfPiece{text: pdfEncode(name), style: style}
+		for len(title.text) > 3 && title.width() > l.contentWidth() {
+			title.text = append(title.text[:len(title.text)-4], "..."...)
+		}
+		l.drawText(title, l.margin, l.margin/2+style.size/2)
+		number := pdfPiece{text: fmt.Appendf(nil, "Page %d of %d", i+1, len(l.pages)), style: style}
+		l.drawText(number, (l.width-number.width())/2, l.height-l.margin/2+style.size/2)
+	}
+
+	var out bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+	stream := func(dict string, data []byte) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n<< %s /Length %d >>\nstream\n", len(offsets), dict, len(data))
+		out.Write(data)
+		out.WriteString("\nendstream\nendobj\n")
+	}
+	// objects are numbered catalog, pages, info, fonts, images, then a page
+	// and its content for every page
+	var resources strings.Builder
+	resources.WriteString("<< /Font <<")
+	next := 4
+	var fonts []int
+	for i, used := range l.fonts {
+		if used {
+			fmt.Fprintf(&resources, " /F%d %d 0 R", i+1, next)
+			fonts = append(fonts, i)
+			next++
+		}
+	}
+	resources.WriteString(" >>")
+	if len(l.images) > 0 {
+		resources.WriteString(" /XObject <<")
+		for i := range l.images {
+			fmt.Fprintf(&resources, " /Im%d %d 0 R", i+1, next)
+			next++
+		}
+		resources.WriteString(" >>")
+	}
+	resources.WriteString(" >>")
+	var kids []string
+	for i := range l.pages {
+		kids = append(kids, fmt.Sprintf("%d 0 R", next+2*i))
+	}
+
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(l.pages)))
+	object(fmt.Sprintf("<< /Title %s >>", pdfTextString(name)))
+	for _, i := range fonts {
+		object(fmt.Sprintf("<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding >>", pdfFont{family: i / 4, bold: i%4 >= 2, italic: i%2 == 1}.name()))
+	}
+	for _, img := range l.images {
+		stream(fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceRGB /BitsPerComponent 8 /Filter /FlateDecode", img.width, img.height), img.data)
+	}
+	for _, page := range l.pages {
+		var annots strings.Builder
+		if len(page.links) > 0 {
+			annots.WriteString(" /Annots [")
+			for _, link := range page.links {
+				fmt.Fprintf(&annots, " << /Type /Annot /Subtype /Link /Rect [%.2f %.2f %.2f %.2f] /Border [0 0 0] /A << /S /URI /URI %s >> >>",
+					link.rect[0], link.rect[1], link.rect[2], link.rect[3], pdfString([]byte(link.url)))
+			}
+			annots.WriteString(" ]")
+		}
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Resources %s /Contents %d 0 R%s >>",
+			l.width, l.height, resources.String(), len(offsets)+2, annots.String()))
+		stream("/Filter /FlateDecode", deflate(page.content.Bytes()))
+	}
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R /Info 3 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return out.Bytes()
+}
+
+// pdfColor reads the value of a colour mark, see colorRGB.
+func pdfColor(value string) ([3]float64, bool) {
+	rgb, ok := colorRGB(value)
+	return [3]float64{float64(rgb[0]) / 255, float64(rgb[1]) / 255, float64(rgb[2]) / 255}, ok
+}
+
+// pdfString writes bytes as a literal string, escaping what is not
+// printable ascii.
+func pdfString(text []byte) string {
+	var sb strings.Builder
+	sb.WriteByte('(')
+	for _, c := range text {
+		switch {
+		case c == '(' || c == ')' || c == '\\':
+			sb.WriteByte('\\')
+			sb.WriteByte(c)
+		case c < 32 || c > 126:
+			fmt.Fprintf(&sb, "\\%03o", c)
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	sb.WriteByte(')')
+	return sb.String()
+}
+
+// pdfTextString writes text outside of page content, like the title, as a
+// utf-16 hex string.
+func pdfTextString(text string) string {
+	var sb strings.Builder
+	sb.WriteString("<FEFF")
+	for _, u := range utf16.Encode([]rune(text)) {
+		fmt.Fprintf(&sb, "%04X", u)
+	}
+	sb.WriteByte('>')
+	return sb.String()
+}
+
+func deflate(data []byte) []byte {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	w.Write(data)
+	w.Close()
+	return buf.Bytes()
+}
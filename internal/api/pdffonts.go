@@ -0,0 +1,194 @@
+package api
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Families of the standard pdf fonts, which every reader has so they are
+// not embedded. They only cover the latin characters of WinAnsiEncoding.
+const (
+	helvetica = iota
+	times
+	courier
+)
+
+type pdfFont struct {
+	family int
+	bold   bool
+	italic bool
+}
+
+var pdfFontNames = [3][4]string{
+	{"Helvetica", "Helvetica-Oblique", "Helvetica-Bold", "Helvetica-BoldOblique"},
+	{"Times-Roman", "Times-Italic", "Times-Bold", "Times-BoldItalic"},
+	{"Courier", "Courier-Oblique", "Courier-Bold", "Courier-BoldOblique"},
+}
+
+// pdfWidths are the widths of the printable ascii characters, from space to
+// tilde, in thousandths of the font size, as given by the font metrics of
+// the standard fonts. Oblique faces have the widths of the upright ones and
+// courier is fixed at 600.
+var pdfWidths = [3][2][95]int{
+	helvetica: {
+		{
+			278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+			556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+			1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+			667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+			333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+			556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+		},
+		{
+			278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278,
+			556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611,
+			975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778,
+			667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556,
+			333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611,
+			611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584,
+		},
+	},
+	times: {
+		{
+			250, 333, 408, 500, 500, 833, 778, 180, 333, 333, 500, 564, 250, 333, 250, 278,
+			500, 500, 500, 500, 500, 500, 500, 500, 500, 500, 278, 278, 564, 564, 564, 444,
+			921, 722, 667, 667, 722, 611, 556, 722, 722, 333, 389, 722, 611, 889, 722, 722,
+			556, 722, 667, 556, 611, 722, 722, 944, 722, 722, 611, 333, 278, 333, 469, 500,
+			333, 444, 500, 444, 500, 444, 333, 500, 500, 278, 278, 500, 278, 778, 500, 500,
+			500, 500, 333, 389, 278, 500, 500, 722, 500, 500, 444, 480, 200, 480, 541,
+		},
+		{
+			250, 333, 555, 500, 500, 1000, 833, 278, 333, 333, 500, 570, 250, 333, 250, 278,
+			500, 500, 500, 500, 500, 500, 500, 500, 500, 500, 333, 333, 570, 570, 570, 500,
+			930, 722, 667, 722, 722, 667, 611, 778, 778, 389, 500, 778, 667, 944, 722, 778,
+			611, 778, 722, 556, 667, 722, 722, 1000, 722, 722, 667, 333, 278, 333, 581, 500,
+			333, 500, 556, 444, 556, 444, 333, 500, 556, 278, 333, 556, 278, 833, 556, 500,
+			556, 556, 444, 389, 333, 556, 500, 722, 500, 500, 444, 394, 220, 394, 520,
+		},
+	},
+}
+
+// pdfItalicWidths are the widths of the italic times faces, which unlike
+// helvetica differ from the upright ones.
+var pdfItalicWidths = [2][95]int{
+	{
+		250, 333, 420, 500, 500, 833, 778, 214, 333, 333, 500, 675, 250, 333, 250, 278,
+		500, 500, 500, 500, 500, 500, 500, 500, 500, 500, 333, 333, 675, 675, 675, 500,
+		920, 611, 611, 667, 722, 611, 611, 722, 722, 333, 444, 667, 556, 833, 667, 722,
+		611, 722, 611, 500, 556, 722, 611, 833, 611, 556, 556, 389, 278, 389, 422, 500,
+		333, 500, 500, 444, 500, 444, 278, 500, 500, 278, 278, 444, 278, 722, 500, 500,
+		500, 500, 389, 389, 278, 500, 444, 667, 444, 444, 389, 400, 275, 400, 541,
+	},
+	{
+		250, 389, 555, 500, 500, 833, 778, 278, 333, 333, 500, 570, 250, 333, 250, 278,
+		500, 500, 500, 500, 500, 500, 500, 500, 500, 500, 333, 333, 570, 570, 570, 500,
+		832, 667, 667, 667, 722, 667, 667, 722, 778, 389, 500, 667, 611, 889, 722, 722,
+		611, 722, 667, 556, 611, 722, 667, 889, 667, 611, 611, 333, 278, 333, 570, 500,
+		333, 500, 500, 444, 500, 444, 333, 500, 556, 278, 278, 500, 278, 778, 556, 500,
+		500, 500, 389, 389, 278, 556, 444, 667, 500, 444, 389, 348, 220, 348, 570,
+	},
+}
+
+// pdfWideCharacters are the widths of characters outside ascii that are
+// much wider or narrower than a letter, in every font but courier.
+var pdfWideCharacters = map[rune]int{
+	'—': 1000, '…': 1000, '‰': 1000, '™': 1000, '•': 350, '·': 278,
+}
+
+// pdfFontFamily picks the standard family closest to a css font name.
+func pdfFontFamily(font string) int {
+	font = strings.ToLower(font)
+	for _, mono := range []string{"mono", "courier", "consolas", "menlo", "code"} {
+		if strings.Contains(font, mono) {
+			return courier
+		}
+	}
+	for _, serif := range []string{"times", "serif", "georgia", "garamond", "cambria", "roman"} {
+		if strings.Contains(font, serif) && !strings.Contains(font, "sans") {
+			return times
+		}
+	}
+	return helvetica
+}
+
+func (f pdfFont) index() int {
+	i := f.family * 4
+	if f.bold {
+		i += 2
+	}
+	if f.italic {
+		i++
+	}
+	return i
+}
+
+func (f pdfFont) name() string {
+	return pdfFontNames[f.family][f.index()%4]
+}
+
+// width is the width of encoded text at size 1.
+func (f pdfFont) width(text []byte) float64 {
+	total := 0
+	for _, c := range text {
+		total += f.charWidth(c)
+	}
+	return float64(total) / 1000
+}
+
+func (f pdfFont) charWidth(c byte) int {
+	if f.family == courier {
+		return 600
+	}
+	widths := &pdfWidths[f.family][0]
+	switch {
+	case f.family == times && f.italic && f.bold:
+		widths = &pdfItalicWidths[1]
+	case f.family == times && f.italic:
+		widths = &pdfItalicWidths[0]
+	case f.bold:
+		widths = &pdfWidths[f.family][1]
+	}
+	if c >= 32 && c <= 126 {
+		return widths[c-32]
+	}
+	// outside ascii, take the width of the letter without its accent or of
+	// a letter of average width
+	r := charmap.Windows1252.DecodeByte(c)
+	if w, ok := pdfWideCharacters[r]; ok {
+		return w
+	}
+	if base, _ := utf8.DecodeRuneInString(norm.NFD.String(string(r))); base >= 32 && base <= 126 {
+		return widths[base-32]
+	}
+	return widths['n'-32]
+}
+
+// pdfEncode converts text to WinAnsiEncoding. Accented letters the encoding
+// lacks lose their accent, other characters become question marks. Line
+// breaks are kept for wrapping, other control characters are dropped.
+func pdfEncode(text string) []byte {
+	encoded := make([]byte, 0, len(text))
+	for _, r := range text {
+		if r == '\t' {
+			encoded = append(encoded, "    "...)
+			continue
+		}
+		if r < 32 && r != '\n' {
+			continue
+		}
+		if c, ok := charmap.Windows1252.EncodeRune(r); ok {
+			encoded = append(encoded, c)
+			continue
+		}
+		base, _ := utf8.DecodeRuneInString(norm.NFD.String(string(r)))
+		if c, ok := charmap.Windows1252.EncodeRune(base); ok && base != r {
+			encoded = append(encoded, c)
+			continue
+		}
+		encoded = append(encoded, '?')
+	}
+	return encoded
+}
@@ -2,7 +2,9 @@ package api
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -30,12 +32,47 @@ func getDocumentAndUserFromUrl(r *http.Request) (userId, documentId uuid.UUID, e
 	return userId, documentId, err
 }
 
-func (cfg *ApiConfig) checkIsUserOwner(ctx context.Context, user_id, document_id uuid.UUID) (bool, error) {
-	ownerId, err := cfg.Db.GetDocumentOwnerId(ctx, document_id)
+// GetUserRole resolves the role of a user on a document: OwnerRole,
+// EditorRole or ViewerRole. The admins of its workspace own the document, and
+// so does its creator unless they are only a guest of the workspace, while
+// members edit it. Roles granted on the document or its folders apply
+// otherwise. Errors carry their http status like requireOwnerShip.
+func (cfg *ApiConfig) GetUserRole(ctx context.Context, userId, documentId uuid.UUID) (string, error) {
+	ownerId, err := cfg.Db.GetDocumentOwnerId(ctx, documentId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", fmt.Errorf("404: document not found")
+	}
 	if err != nil {
-		return false, err
+		return "", fmt.Errorf("500: %s", err.Error())
+	}
+	workspaceRole, err := cfg.Db.GetDocumentWorkspaceRole(ctx, database.GetDocumentWorkspaceRoleParams{
+		ID:     documentId,
+		UserID: userId,
+	})
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return "", fmt.Errorf("500: %s", err.Error())
+	}
+	// a creator demoted to guest only keeps what is shared with them
+	if ownerId.Valid && ownerId.UUID == userId && workspaceRole != WorkspaceGuestRole {
+		return OwnerRole, nil
 	}
-	return ownerId == user_id, nil
+	switch workspaceRole {
+	case WorkspaceAdminRole:
+		return OwnerRole, nil
+	case WorkspaceMemberRole:
+		return EditorRole, nil
+	}
+	role, err := cfg.Db.GetUserPermission(ctx, database.GetUserPermissionParams{
+		UserID:     userId,
+		DocumentID: documentId,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", fmt.Errorf("403: not authorized")
+	}
+	if err != nil {
+		return "", fmt.Errorf("500: %s", err.Error())
+	}
+	return role, nil
 }
 
 func (cfg *ApiConfig) requireOwnerShip(r *http.Request) (userId, documentId uuid.UUID, err error) {
@@ -44,16 +81,17 @@ func (cfg *ApiConfig) requireOwnerShip(r *http.Request) (userId, documentId uuid
 		return uuid.Nil, uuid.Nil, err
 	}
 
-	isOwner, err := cfg.checkIsUserOwner(r.Context(), userId, documentId)
+	role, err := cfg.GetUserRole(r.Context(), userId, documentId)
 	if err != nil {
-		return uuid.Nil, uuid.Nil, fmt.Errorf("404: document not found")
+		return uuid.Nil, uuid.Nil, err
 	}
-	if !isOwner {
+	if role != OwnerRole {
 		return uuid.Nil, uuid.Nil, fmt.Errorf("403: not authorized")
 	}
 	return userId, documentId, nil
 }
-func parseStatusFromError(err error) int {
+
+func ParseStatusFromError(err error) int {
 	msg := err.Error()
 	if len(msg) < 4 {
 		return 500
@@ -74,7 +112,7 @@ func (cfg *ApiConfig) AddCollaboratorToDocumentHandler(w http.ResponseWriter, r
 
 	_, documentId, err := cfg.requireOwnerShip(r)
 	if err != nil {
-		statusCode := parseStatusFromError(err)
+		statusCode := ParseStatusFromError(err)
 		RespondWithError(w, statusCode, err.Error())
 		return
 	}
@@ -113,7 +151,7 @@ func (cfg *ApiConfig) UpdateUserPermissionHandler(w http.ResponseWriter, r *http
 
 	_, documentId, err := cfg.requireOwnerShip(r)
 	if err != nil {
-		statusCode := parseStatusFromError(err)
+		statusCode := ParseStatusFromError(err)
 		RespondWithError(w, statusCode, err.Error())
 		return
 	}
@@ -150,27 +188,43 @@ func (cfg *ApiConfig) GetCollaboratorsHandler(w http.ResponseWriter, r *http.Req
 	}
 	userId, documentId, err := getDocumentAndUserFromUrl(r)
 	if err != nil {
-		statusCode := parseStatusFromError(err)
+		statusCode := ParseStatusFromError(err)
 		RespondWithError(w, statusCode, err.Error())
 		return
 	}
 
+	// roles granted through a folder count as well
+	if _, err := cfg.GetUserRole(r.Context(), userId, documentId); err != nil {
+		RespondWithError(w, ParseStatusFromError(err), err.Error())
+		return
+	}
+
 	u, err := cfg.Db.GetUsersFromDocument(r.Context(), documentId)
 	if err != nil {
 		RespondWithError(w, 500, err.Error())
 		return
 	}
 
+	// documents of a workspace may have lost their creator
 	owner, err := cfg.Db.GetDocumentOwner(r.Context(), documentId)
-	if err != nil {
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
 		RespondWithError(w, 500, err.Error())
 		return
 	}
-
-	if isCollaborator := userIsCollaborator(u, userId) || userId == owner.ID; !isCollaborator {
-		RespondWithError(w, 403, "not authorized")
-		return
+	hasOwner := err == nil
+	// like in GetUserRole, a creator demoted to guest no longer owns it
+	if hasOwner {
+		workspaceRole, err := cfg.Db.GetDocumentWorkspaceRole(r.Context(), database.GetDocumentWorkspaceRoleParams{
+			ID:     documentId,
+			UserID: owner.ID,
+		})
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			RespondWithError(w, 500, err.Error())
+			return
+		}
+		hasOwner = workspaceRole != WorkspaceGuestRole
 	}
+
 	res := responseBody{}
 	for _, v := range u {
 		ur := userRole{
@@ -180,11 +234,13 @@ func (cfg *ApiConfig) GetCollaboratorsHandler(w http.ResponseWriter, r *http.Req
 		res.UserRoles = append(res.UserRoles, ur)
 	}
 
-	ownerUr := userRole{
-		Email: owner.Email,
-		Role:  OwnerRole,
+	if hasOwner {
+		ownerUr := userRole{
+			Email: owner.Email,
+			Role:  OwnerRole,
+		}
+		res.UserRoles = append(res.UserRoles, ownerUr)
 	}
-	res.UserRoles = append(res.UserRoles, ownerUr)
 	RespondWithJson(w, 200, res)
 }
 
@@ -195,7 +251,7 @@ func (cfg *ApiConfig) DeleteUserFromCollaboration(w http.ResponseWriter, r *http
 
 	_, documentId, err := cfg.requireOwnerShip(r)
 	if err != nil {
-		statusCode := parseStatusFromError(err)
+		statusCode := ParseStatusFromError(err)
 		RespondWithError(w, statusCode, err.Error())
 		return
 	}
@@ -218,14 +274,3 @@ func (cfg *ApiConfig) DeleteUserFromCollaboration(w http.ResponseWriter, r *http
 	}
 	RespondWithJson(w, 204, struct{}{})
 }
-
-func userIsCollaborator(u []database.GetUsersFromDocumentRow, userId uuid.UUID) bool {
-	isCollaborator := false
-	for _, v := range u {
-		if v.ID == userId {
-			isCollaborator = true
-			break
-		}
-	}
-	return isCollaborator
-}
@@ -0,0 +1,305 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ahmedjebari022/go-docs/internal/database"
+	"github.com/ahmedjebari022/go-docs/internal/storage"
+	"github.com/google/uuid"
+)
+
+// Actions of the store intents. An intent is recorded before the store is
+// written and dropped in the transaction committing the rows, so that after
+// a crash at any step Reconcile knows what to finish or undo.
+const (
+	// createIntent covers the content of a document or version whose row is
+	// not committed yet, the content is removed if the row never comes.
+	createIntent = "create"
+	// updateIntent covers the content of a document being replaced, the
+	// revision is bumped once the content may have changed.
+	updateIntent = "update"
+	// deleteIntent covers the content of a deleted document, removed in full
+	// even if the server stopped halfway.
+	deleteIntent = "delete"
+)
+
+// reconcileGrace is the age intents must reach before Reconcile settles
+// them, so that writes in progress are left alone.
+const reconcileGrace = 10 * time.Minute
+
+// writeContent runs commit, then puts doc in the store under key before the
+// transaction commits and drops the intent covering the write. The rows
+// commit writes stay locked until the content is in place, so concurrent
+// writes reach the store in the order they commit. When commit fails nothing
+// is written, a failed creation is undone right away and anything else is
+// left to Reconcile.
+func (cfg *ApiConfig) writeContent(ctx context.Context, action string, documentId uuid.UUID, key string, doc Document, commit func(qtx *database.Queries) error) error {
+	intent, err := cfg.Db.CreateStoreIntent(ctx, database.CreateStoreIntentParams{
+		Action:     action,
+		DocumentID: documentId,
+		Key:        key,
+	})
+	if err != nil {
+		return err
+	}
+	tx, err := cfg.DbC.BeginTx(ctx, nil)
+	if err != nil {
+		cfg.Db.DeleteStoreIntent(ctx, intent)
+		return err
+	}
+	defer tx.Rollback()
+	qtx := cfg.Db.WithTx(tx)
+	if err := commit(qtx); err != nil {
+		tx.Rollback()
+		cfg.Db.DeleteStoreIntent(ctx, intent)
+		return err
+	}
+	err = cfg.putContent(ctx, key, doc)
+	if err == nil {
+		err = qtx.DeleteStoreIntent(ctx, intent)
+	}
+	if err != nil {
+		tx.Rollback()
+		if action == createIntent && cfg.Store.Delete(ctx, key) == nil {
+			cfg.Db.DeleteStoreIntent(ctx, intent)
+		}
+		return err
+	}
+	// whether a failed commit went through is unknown, Reconcile finds out
+	return tx.Commit()
+}
+
+// removeContent deletes the content of a document and of its versions.
+func (cfg *ApiConfig) removeContent(ctx context.Context, documentId uuid.UUID) error {
+	if err := cfg.Store.Delete(ctx, documentKey(documentId)); err != nil {
+		return err
+	}
+	versions, err := cfg.Store.List(ctx, versionsPrefix(documentId))
+	if err != nil {
+		return err
+	}
+	for _, key := range versions {
+		if err := cfg.Store.Delete(ctx, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReconcileReport counts what a reconciliation repaired.
+type ReconcileReport struct {
+	// Intents left by interrupted writes and settled
+	Intents int
+	// OrphanContents is the content no row refers to, removed
+	OrphanContents int
+	// MissingContents counts the documents whose content was lost, given
+	// back their latest version or an empty content
+	MissingContents int
+	// MissingVersions counts the versions whose content was lost, dropped
+	MissingVersions int
+	// TempFiles left by interrupted writes, removed
+	TempFiles int
+}
+
+func (r ReconcileReport) empty() bool {
+	return r == ReconcileReport{}
+}
+
+// Reconcile settles the intents of the writes a crash interrupted, then
+// compares the store with the database to repair what is left: content no
+// row refers to is removed, documents whose content is missing get it back
+// from their latest version, and versions whose content is missing are
+// dropped. Every step can be repeated, replicas may run it at the same time.
+func (cfg *ApiConfig) Reconcile(ctx context.Context) (ReconcileReport, error) {
+	var report ReconcileReport
+	intents, err := cfg.Db.GetStaleStoreIntents(ctx, int32(reconcileGrace/time.Second))
+	if err != nil {
+		return report, err
+	}
+	for _, intent := range intents {
+		if err := cfg.settleIntent(ctx, intent); err != nil {
+			return report, fmt.Errorf("intent %d: %w", intent.ID, err)
+		}
+		report.Intents++
+	}
+
+	keys, err := cfg.Store.List(ctx, "")
+	if err != nil {
+		return report, err
+	}
+	stored := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		stored[key] = true
+		documentId, versionId, ok := parseContentKey(key)
+		if !ok {
+			continue
+		}
+		// the row and the intents are read in one statement, a write commits
+		// its row and drops its intent at once
+		var referenced bool
+		if versionId == uuid.Nil {
+			referenced, err = cfg.Db.IsDocumentKeyReferenced(ctx, database.IsDocumentKeyReferencedParams{ID: documentId, Key: key})
+		} else {
+			referenced, err = cfg.Db.IsVersionKeyReferenced(ctx, database.IsVersionKeyReferencedParams{ID: versionId, Key: key})
+		}
+		if err != nil {
+			return report, err
+		}
+		if !referenced {
+			if err := cfg.Store.Delete(ctx, key); err != nil {
+				return report, err
+			}
+			report.OrphanContents++
+		}
+	}
+
+	documents, err := cfg.Db.GetAllDocumentIds(ctx)
+	if err != nil {
+		return report, err
+	}
+	for _, id := range documents {
+		if stored[documentKey(id)] {
+			continue
+		}
+		repaired, err := cfg.repairContent(ctx, id)
+		if err != nil {
+			return report, fmt.Errorf("document %s: %w", id, err)
+		}
+		if repaired {
+			report.MissingContents++
+		}
+	}
+	versions, err := cfg.Db.GetAllDocumentVersionIds(ctx)
+	if err != nil {
+		return report, err
+	}
+	for _, v := range versions {
+		key := versionKey(v.DocumentID, v.ID)
+		if stored[key] {
+			continue
+		}
+		// the listing may be older than the version
+		if _, err := cfg.Store.Stat(ctx, key); !errors.Is(err, storage.ErrNotFound) {
+			continue
+		}
+		if err := cfg.Db.DeleteDocumentVersion(ctx, v.ID); err != nil {
+			return report, err
+		}
+		report.MissingVersions++
+	}
+
+	if sweeper, ok := cfg.Store.(storage.Sweeper); ok {
+		report.TempFiles, err = sweeper.Sweep(ctx, time.Now().Add(-reconcileGrace))
+		if err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+// RunReconciler runs Reconcile every interval.
+func (cfg *ApiConfig) RunReconciler(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		report, err := cfg.Reconcile(ctx)
+		cancel()
+		if err != nil {
+			fmt.Printf("error while reconciling the store :%s\n", err.Error())
+		}
+		if !report.empty() {
+			fmt.Printf("store reconciled: %+v\n", report)
+		}
+	}
+}
+
+func (cfg *ApiConfig) settleIntent(ctx context.Context, intent database.StoreIntent) error {
+	switch intent.Action {
+	case createIntent:
+		_, versionId, ok := parseContentKey(intent.Key)
+		if !ok {
+			break
+		}
+		var err error
+		if versionId == uuid.Nil {
+			_, err = cfg.Db.GetDocumentOwnerId(ctx, intent.DocumentID)
+		} else {
+			_, err = cfg.Db.GetDocumentVersion(ctx, database.GetDocumentVersionParams{ID: versionId, DocumentID: intent.DocumentID})
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			err = cfg.Store.Delete(ctx, intent.Key)
+		}
+		if err != nil {
+			return err
+		}
+	case updateIntent:
+		// the content may have changed, clients holding the revision must
+		// read it again. A deleted document leaves it to the orphan check
+		if _, err := cfg.Db.UpdateDocument(ctx, intent.DocumentID); err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+	case deleteIntent:
+		if err := cfg.removeContent(ctx, intent.DocumentID); err != nil {
+			return err
+		}
+	}
+	return cfg.Db.DeleteStoreIntent(ctx, intent.ID)
+}
+
+// repairContent writes the latest version of a document whose content is
+// missing, or an empty content when it has none. It reports false when the
+// content or the document turn out to exist or be gone.
+func (cfg *ApiConfig) repairContent(ctx context.Context, documentId uuid.UUID) (bool, error) {
+	key := documentKey(documentId)
+	if _, err := cfg.Store.Stat(ctx, key); !errors.Is(err, storage.ErrNotFound) {
+		return false, err
+	}
+	if _, err := cfg.Db.GetDocumentOwnerId(ctx, documentId); errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	doc := Document{}
+	version, err := cfg.Db.GetLatestDocumentVersion(ctx, documentId)
+	if err == nil {
+		// a version whose content is lost as well is dropped later on
+		if restored, err := cfg.loadVersion(ctx, version); err == nil {
+			doc = restored
+		}
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return false, err
+	}
+	if err := cfg.putContent(ctx, key, doc); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// parseContentKey reads the document, and the version for the key of a
+// version, a store key belongs to. Keys of neither form are not ours.
+func parseContentKey(key string) (documentId, versionId uuid.UUID, ok bool) {
+	name, found := strings.CutSuffix(key, ".json")
+	if !found {
+		return uuid.Nil, uuid.Nil, false
+	}
+	parts := strings.Split(name, "/")
+	switch {
+	case len(parts) == 1:
+		documentId, err := uuid.Parse(parts[0])
+		return documentId, uuid.Nil, err == nil && documentKey(documentId) == key
+	case len(parts) == 3 && parts[0] == "versions":
+		documentId, err := uuid.Parse(parts[1])
+		if err != nil {
+			return uuid.Nil, uuid.Nil, false
+		}
+		versionId, err := uuid.Parse(parts[2])
+		return documentId, versionId, err == nil && versionKey(documentId, versionId) == key
+	}
+	return uuid.Nil, uuid.Nil, false
+}
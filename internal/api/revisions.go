@@ -0,0 +1,56 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// AnyRevision saves a document whatever its revision, revisions start at 1.
+const AnyRevision = 0
+
+// ErrStaleRevision is returned when a document moved past the revision the
+// caller edited.
+var ErrStaleRevision = errors.New("412: the document changed since the revision edited")
+
+// revisionETag is the ETag of a revision of a document.
+func revisionETag(revision int64) string {
+	return `"` + strconv.FormatInt(revision, 10) + `"`
+}
+
+// ifMatchRevision reads the revision a client edited from its If-Match
+// header, AnyRevision for "*". Updates without it are refused so that a
+// client cannot overwrite changes it never saw.
+func ifMatchRevision(r *http.Request) (int64, error) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	switch {
+	case header == "":
+		return 0, fmt.Errorf("428: If-Match header required, send the ETag of the document")
+	case header == "*":
+		return AnyRevision, nil
+	}
+	tag, ok := strings.CutPrefix(header, `"`)
+	if ok {
+		tag, ok = strings.CutSuffix(tag, `"`)
+	}
+	revision, err := strconv.ParseInt(tag, 10, 64)
+	if !ok || err != nil || revision <= 0 {
+		return 0, fmt.Errorf("400: If-Match must be a single ETag of the document")
+	}
+	return revision, nil
+}
+
+// respondStale tells a client its revision is stale, with the current one.
+func respondStale(w http.ResponseWriter, revision int64) {
+	type responseBody struct {
+		Error    string `json:"error"`
+		Revision int64  `json:"revision"`
+	}
+	w.Header().Set("ETag", revisionETag(revision))
+	RespondWithJson(w, 412, responseBody{
+		Error:    "the document changed since the revision edited",
+		Revision: revision,
+	})
+}
@@ -0,0 +1,182 @@
+package api
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+)
+
+const textRuleWidth = 40
+
+// RenderText writes the document as plain text, to be read as is or piped
+// into scripts. Blocs are separated by a blank line and the items of a list
+// by a line break. Formatting is dropped, links keep their url after their
+// text.
+func RenderText(doc Document) []byte {
+	var out bytes.Buffer
+	// widths[l] is the width of the marker of the current list item at level
+	// l, the items below it are indented by it
+	var widths []int
+	var counters []int
+	previousList := false
+	for _, b := range doc.Blocs {
+		kind := b.Kind()
+		list := kind == BulletedListBloc || kind == NumberedListBloc || kind == ChecklistBloc
+		if !list {
+			widths, counters = nil, nil
+		}
+		var block string
+		switch kind {
+		case HeadingBloc:
+			block = strings.ReplaceAll(textInline(b), "\n", " ")
+			switch b.Attrs.Level {
+			case 1:
+				block += "\n" + strings.Repeat("=", runeLen(block))
+			case 2:
+				block += "\n" + strings.Repeat("-", runeLen(block))
+			}
+		case BulletedListBloc, NumberedListBloc, ChecklistBloc:
+			level := b.Attrs.Level
+			for len(widths) <= level {
+				widths = append(widths, 2)
+				counters = append(counters, 0)
+			}
+			widths, counters = widths[:level+1], counters[:level+1]
+			indent := 0
+			for _, w := range widths[:level] {
+				indent += w
+			}
+			marker := "- "
+			switch kind {
+			case NumberedListBloc:
+				counters[level]++
+				marker = strconv.Itoa(counters[level]) + ". "
+			case ChecklistBloc:
+				counters[level] = 0
+				marker = "[ ] "
+				if b.Attrs.Checked {
+					marker = "[x] "
+				}
+			default:
+				counters[level] = 0
+			}
+			widths[level] = len(marker)
+			pad := strings.Repeat(" ", indent)
+			block = pad + marker + textIndent(textInline(b), pad+strings.Repeat(" ", len(marker)))
+		case QuoteBloc:
+			block = "> " + strings.ReplaceAll(textInline(b), "\n", "\n> ")
+		case CodeBloc:
+			block = "    " + textIndent(b.Text, "    ")
+		case TableBloc:
+			block = textTable(b.Attrs.Rows)
+		case RuleBloc:
+			block = strings.Repeat("-", textRuleWidth)
+		case ImageBloc:
+			block = "[" + b.Attrs.Alt + "]"
+			if b.Attrs.Alt == "" {
+				block = "[image]"
+			}
+			if validLink(b.Attrs.Src) {
+				block += " (" + b.Attrs.Src + ")"
+			}
+		default:
+			block = textInline(b)
+		}
+		if strings.TrimSpace(block) == "" {
+			previousList = false
+			continue
+		}
+		if out.Len() > 0 {
+			if list && previousList {
+				out.WriteString("\n")
+			} else {
+				out.WriteString("\n\n")
+			}
+		}
+		out.WriteString(block)
+		previousList = list
+	}
+	if out.Len() > 0 {
+		out.WriteString("\n")
+	}
+	return out.Bytes()
+}
+
+// textInline is the text of a bloc with the url of every link following
+// it, unless the text already is the url.
+func textInline(b Bloc) string {
+	var sb strings.Builder
+	link, linkText := "", ""
+	endLink := func() {
+		if link != "" && linkText != link {
+			sb.WriteString(" (" + link + ")")
+		}
+	}
+	for _, run := range b.Runs() {
+		value, _ := run.HasMark(LinkMark)
+		if !validLink(value) {
+			value = ""
+		}
+		if value != link {
+			endLink()
+			link, linkText = value, ""
+		}
+		sb.WriteString(run.Text)
+		linkText += run.Text
+	}
+	endLink()
+	return sb.String()
+}
+
+// textIndent indents every line of s but the first, blank lines are left
+// empty.
+func textIndent(s, pad string) string {
+	lines := strings.Split(s, "\n")
+	for i := 1; i < len(lines); i++ {
+		if strings.TrimSpace(lines[i]) != "" {
+			lines[i] = pad + lines[i]
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// textTable aligns the cells of a table in columns, the first row is
+// underlined as header.
+func textTable(rows [][]string) string {
+	if len(rows) == 0 || len(rows[0]) == 0 {
+		return ""
+	}
+	widths := make([]int, len(rows[0]))
+	cells := make([][]string, len(rows))
+	for i, row := range rows {
+		cells[i] = make([]string, len(row))
+		for j, cell := range row {
+			cells[i][j] = strings.Join(strings.Fields(cell), " ")
+			if j < len(widths) {
+				widths[j] = max(widths[j], runeLen(cells[i][j]))
+			}
+		}
+	}
+	var lines []string
+	for i, row := range cells {
+		var line strings.Builder
+		for j, cell := range row {
+			if j > 0 {
+				line.WriteString("  ")
+			}
+			line.WriteString(cell)
+			if j < len(widths) {
+				line.WriteString(strings.Repeat(" ", widths[j]-runeLen(cell)))
+			}
+		}
+		lines = append(lines, strings.TrimRight(line.String(), " "))
+		if i == 0 {
+			rule := make([]string, len(widths))
+			for j, w := range widths {
+				rule[j] = strings.Repeat("-", max(w, 1))
+			}
+			lines = append(lines, strings.Join(rule, "  "))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,37 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/ahmedjebari022/go-docs/internal/auth"
+)
+
+const ticketDuration = 30 * time.Second
+
+// CreateTicketHandler hands out a short lived ticket to open the websocket of
+// a document, since the access cookie is scoped to /api and is not sent on /ws.
+func (cfg *ApiConfig) CreateTicketHandler(w http.ResponseWriter, r *http.Request) {
+	type responseBody struct {
+		Ticket    string    `json:"ticket"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	userId, documentId, err := getDocumentAndUserFromUrl(r)
+	if err != nil {
+		RespondWithError(w, ParseStatusFromError(err), err.Error())
+		return
+	}
+	if _, err := cfg.GetUserRole(r.Context(), userId, documentId); err != nil {
+		RespondWithError(w, ParseStatusFromError(err), err.Error())
+		return
+	}
+	ticket, err := auth.GenerateTicket(cfg.SecretKey, userId, documentId, ticketDuration)
+	if err != nil {
+		RespondWithError(w, 500, err.Error())
+		return
+	}
+	RespondWithJson(w, 200, responseBody{
+		Ticket:    ticket,
+		ExpiresAt: time.Now().Add(ticketDuration),
+	})
+}
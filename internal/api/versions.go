@@ -0,0 +1,284 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/ahmedjebari022/go-docs/internal/database"
+	"github.com/google/uuid"
+)
+
+// Kinds of versions: what caused the content to be recorded.
+const (
+	SaveVersion     = "save"
+	SnapshotVersion = "snapshot"
+	RestoreVersion  = "restore"
+	NamedVersion    = "named"
+)
+
+// Retention of versions: only the latest versionsKept unlabeled versions are
+// kept, none older than versionRetentionDays. Labeled versions stay until the
+// document is deleted.
+const (
+	versionsKept         = 100
+	versionRetentionDays = 30
+	maxLabelLength       = 200
+)
+
+type versionResponse struct {
+	Id          uuid.UUID  `json:"id"`
+	AuthorId    *uuid.UUID `json:"author_id,omitempty"`
+	AuthorEmail string     `json:"author_email,omitempty"`
+	Kind        string     `json:"kind"`
+	Label       string     `json:"label,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+func newVersionResponse(v database.DocumentVersion) versionResponse {
+	res := versionResponse{
+		Id:        v.ID,
+		Kind:      v.Kind,
+		Label:     v.Label.String,
+		CreatedAt: v.CreatedAt,
+	}
+	if v.AuthorID.Valid {
+		res.AuthorId = &v.AuthorID.UUID
+	}
+	return res
+}
+
+// CreateVersion records doc as a version of the document. The content is kept
+// in the store next to the document, the metadata in the database. Versions
+// falling out of the retention rules are dropped on the way.
+func (cfg *ApiConfig) CreateVersion(ctx context.Context, documentId, authorId uuid.UUID, kind, label string, doc Document) (database.DocumentVersion, error) {
+	versionId := uuid.New()
+	var version database.DocumentVersion
+	err := cfg.writeContent(ctx, createIntent, documentId, versionKey(documentId, versionId), doc, func(qtx *database.Queries) error {
+		var err error
+		version, err = qtx.CreateDocumentVersion(ctx, database.CreateDocumentVersionParams{
+			ID:         versionId,
+			DocumentID: documentId,
+			AuthorID:   uuid.NullUUID{UUID: authorId, Valid: authorId != uuid.Nil},
+			Kind:       kind,
+			Label:      sql.NullString{String: label, Valid: label != ""},
+		})
+		return err
+	})
+	if err != nil {
+		return database.DocumentVersion{}, err
+	}
+	expired, err := cfg.Db.DeleteExpiredDocumentVersions(ctx, database.DeleteExpiredDocumentVersionsParams{
+		DocumentID:    documentId,
+		RetentionDays: versionRetentionDays,
+		Kept:          versionsKept,
+	})
+	if err != nil {
+		fmt.Printf("error while pruning the versions of %s :%s\n", documentId, err.Error())
+	}
+	for _, id := range expired {
+		cfg.Store.Delete(ctx, versionKey(documentId, id))
+	}
+	return version, nil
+}
+
+// getVersionFromUrl checks the user can see the document and loads the
+// version named in the url. Errors carry their http status.
+func (cfg *ApiConfig) getVersionFromUrl(r *http.Request) (userId uuid.UUID, role string, version database.DocumentVersion, err error) {
+	userId, documentId, err := getDocumentAndUserFromUrl(r)
+	if err != nil {
+		return uuid.Nil, "", database.DocumentVersion{}, err
+	}
+	role, err = cfg.GetUserRole(r.Context(), userId, documentId)
+	if err != nil {
+		return uuid.Nil, "", database.DocumentVersion{}, err
+	}
+	versionId, err := uuid.Parse(r.PathValue("versionId"))
+	if err != nil {
+		return uuid.Nil, "", database.DocumentVersion{}, fmt.Errorf("400: version error")
+	}
+	version, err = cfg.Db.GetDocumentVersion(r.Context(), database.GetDocumentVersionParams{
+		ID:         versionId,
+		DocumentID: documentId,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return uuid.Nil, "", database.DocumentVersion{}, fmt.Errorf("404: version not found")
+	}
+	if err != nil {
+		return uuid.Nil, "", database.DocumentVersion{}, fmt.Errorf("500: %s", err.Error())
+	}
+	return userId, role, version, nil
+}
+
+func (cfg *ApiConfig) GetVersionsHandler(w http.ResponseWriter, r *http.Request) {
+	type responseBody struct {
+		Versions []versionResponse `json:"versions"`
+	}
+	userId, documentId, err := getDocumentAndUserFromUrl(r)
+	if err != nil {
+		RespondWithError(w, ParseStatusFromError(err), err.Error())
+		return
+	}
+	if _, err := cfg.GetUserRole(r.Context(), userId, documentId); err != nil {
+		RespondWithError(w, ParseStatusFromError(err), err.Error())
+		return
+	}
+	versions, err := cfg.Db.GetDocumentVersions(r.Context(), documentId)
+	if err != nil {
+		RespondWithError(w, 500, err.Error())
+		return
+	}
+	res := responseBody{Versions: []versionResponse{}}
+	for _, v := range versions {
+		version := newVersionResponse(database.DocumentVersion{
+			ID:        v.ID,
+			AuthorID:  v.AuthorID,
+			Kind:      v.Kind,
+			Label:     v.Label,
+			CreatedAt: v.CreatedAt,
+		})
+		version.AuthorEmail = v.Email.String
+		res.Versions = append(res.Versions, version)
+	}
+	RespondWithJson(w, 200, res)
+}
+
+// CreateVersionHandler records the current content under a label, named
+// versions are not subject to the retention rules.
+func (cfg *ApiConfig) CreateVersionHandler(w http.ResponseWriter, r *http.Request) {
+	type requestBody struct {
+		Label string `json:"label"`
+	}
+	userId, documentId, err := getDocumentAndUserFromUrl(r)
+	if err != nil {
+		RespondWithError(w, ParseStatusFromError(err), err.Error())
+		return
+	}
+	role, err := cfg.GetUserRole(r.Context(), userId, documentId)
+	if err != nil {
+		RespondWithError(w, ParseStatusFromError(err), err.Error())
+		return
+	}
+	if role == ViewerRole {
+		RespondWithError(w, 403, "user not authorized")
+		return
+	}
+	var params requestBody
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&params); err != nil {
+		RespondWithError(w, 400, err.Error())
+		return
+	}
+	defer r.Body.Close()
+	if params.Label == "" || len(params.Label) > maxLabelLength {
+		RespondWithError(w, 400, "invalid label")
+		return
+	}
+	doc, err := cfg.LoadDocument(r.Context(), documentId)
+	if err != nil {
+		RespondWithError(w, 500, err.Error())
+		return
+	}
+	version, err := cfg.CreateVersion(r.Context(), documentId, userId, NamedVersion, params.Label, doc)
+	if err != nil {
+		RespondWithError(w, 500, err.Error())
+		return
+	}
+	RespondWithJson(w, http.StatusCreated, newVersionResponse(version))
+}
+
+func (cfg *ApiConfig) GetVersionHandler(w http.ResponseWriter, r *http.Request) {
+	type responseBody struct {
+		versionResponse
+		Document Document `json:"document"`
+	}
+	_, _, version, err := cfg.getVersionFromUrl(r)
+	if err != nil {
+		RespondWithError(w, ParseStatusFromError(err), err.Error())
+		return
+	}
+	doc, err := cfg.loadVersion(r.Context(), version)
+	if err != nil {
+		RespondWithError(w, 500, err.Error())
+		return
+	}
+	RespondWithJson(w, 200, responseBody{
+		versionResponse: newVersionResponse(version),
+		Document:        doc,
+	})
+}
+
+// RestoreVersionHandler makes a version the current content, if the document
+// is still at the revision named by If-Match. The content replaced is not
+// lost since every save is a version already, and the restore is recorded as
+// a new version.
+func (cfg *ApiConfig) RestoreVersionHandler(w http.ResponseWriter, r *http.Request) {
+	userId, role, version, err := cfg.getVersionFromUrl(r)
+	if err != nil {
+		RespondWithError(w, ParseStatusFromError(err), err.Error())
+		return
+	}
+	if role == ViewerRole {
+		RespondWithError(w, 403, "user not authorized")
+		return
+	}
+	revision, err := ifMatchRevision(r)
+	if err != nil {
+		RespondWithError(w, ParseStatusFromError(err), err.Error())
+		return
+	}
+	doc, err := cfg.loadVersion(r.Context(), version)
+	if err != nil {
+		RespondWithError(w, 500, err.Error())
+		return
+	}
+	saved, err := cfg.SaveDocument(r.Context(), version.DocumentID, revision, doc)
+	if errors.Is(err, ErrStaleRevision) {
+		current, err := cfg.Db.GetDocumentRevision(r.Context(), version.DocumentID)
+		if err != nil {
+			RespondWithError(w, 404, "document not found")
+			return
+		}
+		respondStale(w, current)
+		return
+	}
+	if err != nil {
+		RespondWithError(w, 500, err.Error())
+		return
+	}
+	cfg.documentChanged(version.DocumentID, saved, doc)
+	w.Header().Set("ETag", revisionETag(saved))
+	restored, err := cfg.CreateVersion(r.Context(), version.DocumentID, userId, RestoreVersion, "", doc)
+	if err != nil {
+		// restored all the same, only the version describing it is missing
+		fmt.Printf("error while recording a version of %s :%s\n", version.DocumentID, err.Error())
+		RespondWithJson(w, 204, struct{}{})
+		return
+	}
+	RespondWithJson(w, 200, newVersionResponse(restored))
+}
+
+func (cfg *ApiConfig) loadVersion(ctx context.Context, version database.DocumentVersion) (Document, error) {
+	return cfg.getContent(ctx, versionKey(version.DocumentID, version.ID))
+}
+
+// documentChanged tells the open sessions of a document its content was
+// replaced outside of them, and the revision it was saved as.
+func (cfg *ApiConfig) documentChanged(documentId uuid.UUID, revision int64, doc Document) {
+	if cfg.DocumentChanged != nil {
+		cfg.DocumentChanged(documentId, revision, doc)
+	}
+}
+
+// versionsPrefix starts the keys of the versions of a document in the store.
+func versionsPrefix(documentId uuid.UUID) string {
+	return "versions/" + documentId.String() + "/"
+}
+
+func versionKey(documentId, versionId uuid.UUID) string {
+	return versionsPrefix(documentId) + versionId.String() + ".json"
+}
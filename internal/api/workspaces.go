@@ -0,0 +1,606 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ahmedjebari022/go-docs/internal/database"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+)
+
+// Roles of the members of a workspace. Admins own every document of the
+// workspace and manage its members, members edit every document, guests only
+// reach the documents shared with them.
+const (
+	WorkspaceAdminRole  = "admin"
+	WorkspaceMemberRole = "member"
+	WorkspaceGuestRole  = "guest"
+)
+
+// invitationDays is how long an invitation to a workspace can be accepted.
+const invitationDays = 7
+
+func validWorkspaceRole(role string) bool {
+	return role == WorkspaceAdminRole || role == WorkspaceMemberRole || role == WorkspaceGuestRole
+}
+
+type workspaceResponse struct {
+	Id   uuid.UUID `json:"id"`
+	Name string    `json:"name"`
+	Role string    `json:"role"`
+}
+
+type invitationResponse struct {
+	Id          uuid.UUID `json:"id"`
+	WorkspaceId uuid.UUID `json:"workspace_id"`
+	Email       string    `json:"email"`
+	Role        string    `json:"role"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+func newInvitationResponse(i database.WorkspaceInvitation) invitationResponse {
+	return invitationResponse{
+		Id:          i.ID,
+		WorkspaceId: i.WorkspaceID,
+		Email:       i.Email,
+		Role:        i.Role,
+		ExpiresAt:   i.ExpiresAt,
+	}
+}
+
+// getWorkspaceFromUrl loads the workspace named in the url and the role of the
+// user in it. Errors carry their http status.
+func (cfg *ApiConfig) getWorkspaceFromUrl(r *http.Request) (userId uuid.UUID, workspace database.Workspace, role string, err error) {
+	userId, err = GetUserIdFromContext(r.Context())
+	if err != nil {
+		return uuid.Nil, database.Workspace{}, "", fmt.Errorf("401: not authenticated")
+	}
+	workspaceId, err := uuid.Parse(r.PathValue("workspaceId"))
+	if err != nil {
+		return uuid.Nil, database.Workspace{}, "", fmt.Errorf("400: invalid workspace id")
+	}
+	workspace, err = cfg.Db.GetWorkspace(r.Context(), workspaceId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return uuid.Nil, database.Workspace{}, "", fmt.Errorf("404: workspace not found")
+	}
+	if err != nil {
+		return uuid.Nil, database.Workspace{}, "", fmt.Errorf("500: %s", err.Error())
+	}
+	role, err = cfg.Db.GetWorkspaceRole(r.Context(), database.GetWorkspaceRoleParams{
+		WorkspaceID: workspace.ID,
+		UserID:      userId,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return uuid.Nil, database.Workspace{}, "", fmt.Errorf("403: not a member of the workspace")
+	}
+	if err != nil {
+		return uuid.Nil, database.Workspace{}, "", fmt.Errorf("500: %s", err.Error())
+	}
+	return userId, workspace, role, nil
+}
+
+// CreateWorkspaceHandler creates a workspace with the user as its admin.
+func (cfg *ApiConfig) CreateWorkspaceHandler(w http.ResponseWriter, r *http.Request) {
+	type requestBody struct {
+		Name string `json:"name" validate:"required,max=255"`
+	}
+	userId, err := GetUserIdFromContext(r.Context())
+	if err != nil {
+		RespondWithError(w, 401, err.Error())
+		return
+	}
+	var params requestBody
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&params); err != nil {
+		RespondWithError(w, 400, err.Error())
+		return
+	}
+	defer r.Body.Close()
+	validate := validator.New(validator.WithRequiredStructEnabled())
+	if err := validate.Struct(params); err != nil {
+		RespondWithError(w, 400, err.Error())
+		return
+	}
+
+	tx, err := cfg.DbC.BeginTx(r.Context(), nil)
+	if err != nil {
+		RespondWithError(w, 500, err.Error())
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.Db.WithTx(tx)
+	workspace, err := qtx.CreateWorkspace(r.Context(), database.CreateWorkspaceParams{
+		ID:   uuid.New(),
+		Name: params.Name,
+	})
+	if err != nil {
+		RespondWithError(w, 500, err.Error())
+		return
+	}
+	err = qtx.AddWorkspaceMember(r.Context(), database.AddWorkspaceMemberParams{
+		WorkspaceID: workspace.ID,
+		UserID:      userId,
+		Role:        WorkspaceAdminRole,
+	})
+	if err != nil {
+		RespondWithError(w, 500, err.Error())
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		RespondWithError(w, 500, err.Error())
+		return
+	}
+	RespondWithJson(w, http.StatusCreated, workspaceResponse{
+		Id:   workspace.ID,
+		Name: workspace.Name,
+		Role: WorkspaceAdminRole,
+	})
+}
+
+// GetWorkspacesHandler lists the workspaces the user is a member of.
+func (cfg *ApiConfig) GetWorkspacesHandler(w http.ResponseWriter, r *http.Request) {
+	type responseBody struct {
+		Workspaces []workspaceResponse `json:"workspaces"`
+	}
+	userId, err := GetUserIdFromContext(r.Context())
+	if err != nil {
+		RespondWithError(w, 401, err.Error())
+		return
+	}
+	workspaces, err := cfg.Db.GetWorkspacesByUser(r.Context(), userId)
+	if err != nil {
+		RespondWithError(w, 500, err.Error())
+		return
+	}
+	res := responseBody{Workspaces: []workspaceResponse{}}
+	for _, ws := range workspaces {
+		res.Workspaces = append(res.Workspaces, workspaceResponse{Id: ws.ID, Name: ws.Name, Role: ws.Role})
+	}
+	RespondWithJson(w, 200, res)
+}
+
+// GetWorkspaceHandler describes a workspace along with its members.
+func (cfg *ApiConfig) GetWorkspaceHandler(w http.ResponseWriter, r *http.Request) {
+	type member struct {
+		Id       uuid.UUID `json:"id"`
+		Email    string    `json:"email"`
+		Role     string    `json:"role"`
+		JoinedAt time.Time `json:"joined_at"`
+	}
+	type responseBody struct {
+		workspaceResponse
+		Members []member `json:"members"`
+	}
+	_, workspace, role, err := cfg.getWorkspaceFromUrl(r)
+	if err != nil {
+		RespondWithError(w, ParseStatusFromError(err), err.Error())
+		return
+	}
+	members, err := cfg.Db.GetWorkspaceMembers(r.Context(), workspace.ID)
+	if err != nil {
+		RespondWithError(w, 500, err.Error())
+		return
+	}
+	res := responseBody{
+		workspaceResponse: workspaceResponse{Id: workspace.ID, Name: workspace.Name, Role: role},
+		Members:           []member{},
+	}
+	for _, m := range members {
+		res.Members = append(res.Members, member{Id: m.ID, Email: m.Email, Role: m.Role, JoinedAt: m.CreatedAt})
+	}
+	RespondWithJson(w, 200, res)
+}
+
+// GetWorkspaceDocumentsHandler lists every document of a workspace, guests
+// only see those shared with them through the other lists.
+func (cfg *ApiConfig) GetWorkspaceDocumentsHandler(w http.ResponseWriter, r *http.Request) {
+	type document struct {
+		Id        uuid.UUID  `json:"id"`
+		Name      string     `json:"name"`
+		OwnerId   *uuid.UUID `json:"owner_id"`
+		UpdatedAt time.Time  `json:"updated_at"`
+	}
+	type responseBody struct {
+		Documents []document `json:"documents"`
+	}
+	_, workspace, role, err := cfg.getWorkspaceFromUrl(r)
+	if err != nil {
+		RespondWithError(w, ParseStatusFromError(err), err.Error())
+		return
+	}
+	if role == WorkspaceGuestRole {
+		RespondWithError(w, 403, "guests cannot list the documents of the workspace")
+		return
+	}
+	documents, err := cfg.Db.GetWorkspaceDocuments(r.Context(), uuid.NullUUID{UUID: workspace.ID, Valid: true})
+	if err != nil {
+		RespondWithError(w, 500, err.Error())
+		return
+	}
+	res := responseBody{Documents: []document{}}
+	for _, d := range documents {
+		doc := document{Id: d.ID, Name: d.Name, UpdatedAt: d.UpdatedAt}
+		if d.OwnerID.Valid {
+			doc.OwnerId = &d.OwnerID.UUID
+		}
+		res.Documents = append(res.Documents, doc)
+	}
+	RespondWithJson(w, 200, res)
+}
+
+// UpdateWorkspaceMemberHandler changes the role of a member. A workspace
+// always keeps an admin.
+func (cfg *ApiConfig) UpdateWorkspaceMemberHandler(w http.ResponseWriter, r *http.Request) {
+	type requestBody struct {
+		Role string `json:"role"`
+	}
+	_, workspace, role, err := cfg.getWorkspaceFromUrl(r)
+	if err != nil {
+		RespondWithError(w, ParseStatusFromError(err), err.Error())
+		return
+	}
+	if role != WorkspaceAdminRole {
+		RespondWithError(w, 403, "only admins manage the members")
+		return
+	}
+	memberId, err := uuid.Parse(r.PathValue("userId"))
+	if err != nil {
+		RespondWithError(w, 400, "invalid user id")
+		return
+	}
+	var params requestBody
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&params); err != nil {
+		RespondWithError(w, 400, err.Error())
+		return
+	}
+	defer r.Body.Close()
+	if !validWorkspaceRole(params.Role) {
+		RespondWithError(w, 400, "wrong role value")
+		return
+	}
+	err = cfg.changeWorkspaceMember(r, workspace.ID, memberId, func(qtx *database.Queries) error {
+		return qtx.UpdateWorkspaceMember(r.Context(), database.UpdateWorkspaceMemberParams{
+			WorkspaceID: workspace.ID,
+			UserID:      memberId,
+			Role:        params.Role,
+		})
+	}, params.Role != WorkspaceAdminRole)
+	if err != nil {
+		RespondWithError(w, ParseStatusFromError(err), err.Error())
+		return
+	}
+	RespondWithJson(w, 200, struct{}{})
+}
+
+// DeleteWorkspaceMemberHandler removes a member, admins remove anyone and
+// members remove themselves to leave. The documents they created stay in
+// the workspace.
+func (cfg *ApiConfig) DeleteWorkspaceMemberHandler(w http.ResponseWriter, r *http.Request) {
+	userId, workspace, role, err := cfg.getWorkspaceFromUrl(r)
+	if err != nil {
+		RespondWithError(w, ParseStatusFromError(err), err.Error())
+		return
+	}
+	memberId, err := uuid.Parse(r.PathValue("userId"))
+	if err != nil {
+		RespondWithError(w, 400, "invalid user id")
+		return
+	}
+	if role != WorkspaceAdminRole && memberId != userId {
+		RespondWithError(w, 403, "only admins manage the members")
+		return
+	}
+	err = cfg.changeWorkspaceMember(r, workspace.ID, memberId, func(qtx *database.Queries) error {
+		err := qtx.ReleaseWorkspaceDocuments(r.Context(), database.ReleaseWorkspaceDocumentsParams{
+			WorkspaceID: uuid.NullUUID{UUID: workspace.ID, Valid: true},
+			OwnerID:     uuid.NullUUID{UUID: memberId, Valid: true},
+		})
+		if err != nil {
+			return err
+		}
+		return qtx.DeleteWorkspaceMember(r.Context(), database.DeleteWorkspaceMemberParams{
+			WorkspaceID: workspace.ID,
+			UserID:      memberId,
+		})
+	}, true)
+	if err != nil {
+		RespondWithError(w, ParseStatusFromError(err), err.Error())
+		return
+	}
+	RespondWithJson(w, 204, struct{}{})
+}
+
+// changeWorkspaceMember runs change on a member with the workspace locked.
+// When demoting, an admin is refused the change if they are the last one.
+// Errors carry their http status.
+func (cfg *ApiConfig) changeWorkspaceMember(r *http.Request, workspaceId, memberId uuid.UUID, change func(qtx *database.Queries) error, demoting bool) error {
+	tx, err := cfg.DbC.BeginTx(r.Context(), nil)
+	if err != nil {
+		return fmt.Errorf("500: %s", err.Error())
+	}
+	defer tx.Rollback()
+	qtx := cfg.Db.WithTx(tx)
+	if _, err := qtx.LockWorkspace(r.Context(), workspaceId); err != nil {
+		return fmt.Errorf("500: %s", err.Error())
+	}
+	role, err := qtx.GetWorkspaceRole(r.Context(), database.GetWorkspaceRoleParams{
+		WorkspaceID: workspaceId,
+		UserID:      memberId,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("404: not a member of the workspace")
+	}
+	if err != nil {
+		return fmt.Errorf("500: %s", err.Error())
+	}
+	if demoting && role == WorkspaceAdminRole {
+		admins, err := qtx.CountWorkspaceAdmins(r.Context(), workspaceId)
+		if err != nil {
+			return fmt.Errorf("500: %s", err.Error())
+		}
+		if admins <= 1 {
+			return fmt.Errorf("409: the workspace needs another admin first")
+		}
+	}
+	if err := change(qtx); err != nil {
+		return fmt.Errorf("500: %s", err.Error())
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("500: %s", err.Error())
+	}
+	return nil
+}
+
+// CreateWorkspaceInvitationHandler invites an email address to a workspace,
+// inviting it again renews the invitation with the new role.
+func (cfg *ApiConfig) CreateWorkspaceInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	type requestBody struct {
+		Email string `json:"email" validate:"required,email"`
+		Role  string `json:"role"`
+	}
+	userId, workspace, role, err := cfg.getWorkspaceFromUrl(r)
+	if err != nil {
+		RespondWithError(w, ParseStatusFromError(err), err.Error())
+		return
+	}
+	if role != WorkspaceAdminRole {
+		RespondWithError(w, 403, "only admins invite members")
+		return
+	}
+	var params requestBody
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&params); err != nil {
+		RespondWithError(w, 400, err.Error())
+		return
+	}
+	defer r.Body.Close()
+	validate := validator.New(validator.WithRequiredStructEnabled())
+	if err := validate.Struct(params); err != nil {
+		RespondWithError(w, 400, err.Error())
+		return
+	}
+	if !validWorkspaceRole(params.Role) {
+		RespondWithError(w, 400, "wrong role value")
+		return
+	}
+	// invitations are accepted whatever the casing of the address
+	member, err := cfg.Db.IsWorkspaceMemberEmail(r.Context(), database.IsWorkspaceMemberEmailParams{
+		WorkspaceID: workspace.ID,
+		Email:       params.Email,
+	})
+	if err != nil {
+		RespondWithError(w, 500, err.Error())
+		return
+	}
+	if member {
+		RespondWithError(w, 409, "already a member of the workspace")
+		return
+	}
+	invitation, err := cfg.Db.CreateWorkspaceInvitation(r.Context(), database.CreateWorkspaceInvitationParams{
+		ID:          uuid.New(),
+		WorkspaceID: workspace.ID,
+		Email:       strings.ToLower(params.Email),
+		Role:        params.Role,
+		InvitedBy:   uuid.NullUUID{UUID: userId, Valid: true},
+		ValidDays:   invitationDays,
+	})
+	if err != nil {
+		RespondWithError(w, 500, err.Error())
+		return
+	}
+	RespondWithJson(w, http.StatusCreated, newInvitationResponse(invitation))
+}
+
+// GetWorkspaceInvitationsHandler lists the pending invitations of a workspace.
+func (cfg *ApiConfig) GetWorkspaceInvitationsHandler(w http.ResponseWriter, r *http.Request) {
+	type responseBody struct {
+		Invitations []invitationResponse `json:"invitations"`
+	}
+	_, workspace, role, err := cfg.getWorkspaceFromUrl(r)
+	if err != nil {
+		RespondWithError(w, ParseStatusFromError(err), err.Error())
+		return
+	}
+	if role != WorkspaceAdminRole {
+		RespondWithError(w, 403, "only admins see the invitations")
+		return
+	}
+	invitations, err := cfg.Db.GetWorkspaceInvitations(r.Context(), workspace.ID)
+	if err != nil {
+		RespondWithError(w, 500, err.Error())
+		return
+	}
+	res := responseBody{Invitations: []invitationResponse{}}
+	for _, i := range invitations {
+		res.Invitations = append(res.Invitations, newInvitationResponse(i))
+	}
+	RespondWithJson(w, 200, res)
+}
+
+// DeleteWorkspaceInvitationHandler withdraws an invitation.
+func (cfg *ApiConfig) DeleteWorkspaceInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	_, workspace, role, err := cfg.getWorkspaceFromUrl(r)
+	if err != nil {
+		RespondWithError(w, ParseStatusFromError(err), err.Error())
+		return
+	}
+	if role != WorkspaceAdminRole {
+		RespondWithError(w, 403, "only admins manage the invitations")
+		return
+	}
+	invitationId, err := uuid.Parse(r.PathValue("invitationId"))
+	if err != nil {
+		RespondWithError(w, 400, "invalid invitation id")
+		return
+	}
+	invitation, err := cfg.Db.GetWorkspaceInvitation(r.Context(), invitationId)
+	if err != nil || invitation.WorkspaceID != workspace.ID {
+		RespondWithError(w, 404, "invitation not found")
+		return
+	}
+	if err := cfg.Db.DeleteWorkspaceInvitation(r.Context(), invitation.ID); err != nil {
+		RespondWithError(w, 500, err.Error())
+		return
+	}
+	RespondWithJson(w, 204, struct{}{})
+}
+
+// GetInvitationsHandler lists the pending invitations sent to the email of
+// the user.
+func (cfg *ApiConfig) GetInvitationsHandler(w http.ResponseWriter, r *http.Request) {
+	type invitation struct {
+		Id            uuid.UUID `json:"id"`
+		WorkspaceId   uuid.UUID `json:"workspace_id"`
+		WorkspaceName string    `json:"workspace_name"`
+		Role          string    `json:"role"`
+		ExpiresAt     time.Time `json:"expires_at"`
+	}
+	type responseBody struct {
+		Invitations []invitation `json:"invitations"`
+	}
+	userId, err := GetUserIdFromContext(r.Context())
+	if err != nil {
+		RespondWithError(w, 401, err.Error())
+		return
+	}
+	user, err := cfg.Db.GetUserById(r.Context(), userId)
+	if err != nil {
+		RespondWithError(w, 500, err.Error())
+		return
+	}
+	invitations, err := cfg.Db.GetInvitationsByEmail(r.Context(), strings.ToLower(user.Email))
+	if err != nil {
+		RespondWithError(w, 500, err.Error())
+		return
+	}
+	res := responseBody{Invitations: []invitation{}}
+	for _, i := range invitations {
+		res.Invitations = append(res.Invitations, invitation{
+			Id:            i.ID,
+			WorkspaceId:   i.WorkspaceID,
+			WorkspaceName: i.Name,
+			Role:          i.Role,
+			ExpiresAt:     i.ExpiresAt,
+		})
+	}
+	RespondWithJson(w, 200, res)
+}
+
+// getInvitationFromUrl loads an invitation sent to the email of the user.
+// Errors carry their http status.
+func (cfg *ApiConfig) getInvitationFromUrl(r *http.Request) (userId uuid.UUID, invitation database.WorkspaceInvitation, err error) {
+	userId, err = GetUserIdFromContext(r.Context())
+	if err != nil {
+		return uuid.Nil, database.WorkspaceInvitation{}, fmt.Errorf("401: not authenticated")
+	}
+	invitationId, err := uuid.Parse(r.PathValue("invitationId"))
+	if err != nil {
+		return uuid.Nil, database.WorkspaceInvitation{}, fmt.Errorf("400: invalid invitation id")
+	}
+	user, err := cfg.Db.GetUserById(r.Context(), userId)
+	if err != nil {
+		return uuid.Nil, database.WorkspaceInvitation{}, fmt.Errorf("500: %s", err.Error())
+	}
+	invitation, err = cfg.Db.GetWorkspaceInvitation(r.Context(), invitationId)
+	// invitations sent to others are not found either
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !strings.EqualFold(invitation.Email, user.Email)) {
+		return uuid.Nil, database.WorkspaceInvitation{}, fmt.Errorf("404: invitation not found")
+	}
+	if err != nil {
+		return uuid.Nil, database.WorkspaceInvitation{}, fmt.Errorf("500: %s", err.Error())
+	}
+	return userId, invitation, nil
+}
+
+// AcceptInvitationHandler makes the user a member of the workspace they were
+// invited to.
+func (cfg *ApiConfig) AcceptInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	userId, invitation, err := cfg.getInvitationFromUrl(r)
+	if err != nil {
+		RespondWithError(w, ParseStatusFromError(err), err.Error())
+		return
+	}
+	if !invitation.ExpiresAt.After(time.Now().UTC()) {
+		RespondWithError(w, 410, "invitation expired")
+		return
+	}
+	tx, err := cfg.DbC.BeginTx(r.Context(), nil)
+	if err != nil {
+		RespondWithError(w, 500, err.Error())
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.Db.WithTx(tx)
+	err = qtx.AddWorkspaceMember(r.Context(), database.AddWorkspaceMemberParams{
+		WorkspaceID: invitation.WorkspaceID,
+		UserID:      userId,
+		Role:        invitation.Role,
+	})
+	if err != nil {
+		RespondWithError(w, 500, err.Error())
+		return
+	}
+	if err := qtx.DeleteWorkspaceInvitation(r.Context(), invitation.ID); err != nil {
+		RespondWithError(w, 500, err.Error())
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		RespondWithError(w, 500, err.Error())
+		return
+	}
+	workspace, err := cfg.Db.GetWorkspace(r.Context(), invitation.WorkspaceID)
+	if err != nil {
+		RespondWithError(w, 500, err.Error())
+		return
+	}
+	role, err := cfg.Db.GetWorkspaceRole(r.Context(), database.GetWorkspaceRoleParams{
+		WorkspaceID: workspace.ID,
+		UserID:      userId,
+	})
+	if err != nil {
+		RespondWithError(w, 500, err.Error())
+		return
+	}
+	RespondWithJson(w, 200, workspaceResponse{Id: workspace.ID, Name: workspace.Name, Role: role})
+}
+
+// DeclineInvitationHandler drops an invitation sent to the user.
+func (cfg *ApiConfig) DeclineInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	_, invitation, err := cfg.getInvitationFromUrl(r)
+	if err != nil {
+		RespondWithError(w, ParseStatusFromError(err), err.Error())
+		return
+	}
+	if err := cfg.Db.DeleteWorkspaceInvitation(r.Context(), invitation.ID); err != nil {
+		RespondWithError(w, 500, err.Error())
+		return
+	}
+	RespondWithJson(w, 204, struct{}{})
+}
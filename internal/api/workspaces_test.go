@@ -0,0 +1,114 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ahmedjebari022/go-docs/internal/database"
+	"github.com/google/uuid"
+	_ "github.com/lib/pq"
+)
+
+// testDatabase migrates a schema of its own in the database at
+// TEST_DATABASE_URL, the test is skipped without one.
+func testDatabase(t *testing.T) *sql.DB {
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the search path below only holds for the connection it is set on
+	db.SetMaxOpenConns(1)
+	schema := "test_" + strings.ReplaceAll(uuid.NewString(), "-", "")
+	t.Cleanup(func() {
+		db.Exec("DROP SCHEMA " + schema + " CASCADE")
+		db.Close()
+	})
+	if _, err := db.Exec("CREATE SCHEMA " + schema + "; SET search_path TO " + schema); err != nil {
+		t.Fatal(err)
+	}
+	files, err := filepath.Glob("../../sql/schema/*.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		migration, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		up, _, _ := strings.Cut(string(migration), "-- +goose Down")
+		if _, err := db.Exec(up); err != nil {
+			t.Fatalf("%s: %v", file, err)
+		}
+	}
+	return db
+}
+
+// TestRemovedMemberFolderGrants checks that the documents a removed member
+// leaves in a workspace are no longer shared through their folders.
+func TestRemovedMemberFolderGrants(t *testing.T) {
+	db := testDatabase(t)
+	cfg := &ApiConfig{DbC: db, Db: database.New(db)}
+	ctx := context.Background()
+
+	member, reader := uuid.New(), uuid.New()
+	for _, id := range []uuid.UUID{member, reader} {
+		if _, err := cfg.Db.CreateUser(ctx, database.CreateUserParams{ID: id, Email: id.String() + "@example.com"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	workspace, err := cfg.Db.CreateWorkspace(ctx, database.CreateWorkspaceParams{ID: uuid.New(), Name: "workspace"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cfg.Db.AddWorkspaceMember(ctx, database.AddWorkspaceMemberParams{WorkspaceID: workspace.ID, UserID: member, Role: WorkspaceMemberRole})
+	if err != nil {
+		t.Fatal(err)
+	}
+	folder, err := cfg.Db.CreateFolder(ctx, database.CreateFolderParams{ID: uuid.New(), Name: "folder", OwnerID: member})
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := cfg.Db.CreateDocument(ctx, database.CreateDocumentParams{
+		ID:          uuid.New(),
+		OwnerID:     uuid.NullUUID{UUID: member, Valid: true},
+		Name:        "document",
+		WorkspaceID: uuid.NullUUID{UUID: workspace.ID, Valid: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Db.MoveDocument(ctx, database.MoveDocumentParams{ID: doc.ID, FolderID: uuid.NullUUID{UUID: folder.ID, Valid: true}}); err != nil {
+		t.Fatal(err)
+	}
+	err = cfg.Db.SetFolderPermission(ctx, database.SetFolderPermissionParams{UserID: reader, FolderID: folder.ID, Role: EditorRole})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if role, err := cfg.GetUserRole(ctx, reader, doc.ID); err != nil || role != EditorRole {
+		t.Fatalf("before the removal: got %q, %v, want %q", role, err, EditorRole)
+	}
+
+	r := httptest.NewRequest("DELETE", "/workspaces/"+workspace.ID.String()+"/members/"+member.String(), nil)
+	r.SetPathValue("workspaceId", workspace.ID.String())
+	r.SetPathValue("userId", member.String())
+	r = r.WithContext(context.WithValue(r.Context(), k, member))
+	w := httptest.NewRecorder()
+	cfg.DeleteWorkspaceMemberHandler(w, r)
+	if w.Code != 204 {
+		t.Fatalf("removing the member: got %d %s", w.Code, w.Body.String())
+	}
+
+	role, err := cfg.GetUserRole(ctx, reader, doc.ID)
+	if err == nil || ParseStatusFromError(err) != 403 {
+		t.Fatalf("after the removal: got %q, %v, want a 403", role, err)
+	}
+}
@@ -65,6 +65,9 @@ func ValidateJwt(secretString, tokenString string)(uuid.UUID, error){
 		if err != nil{
 			return uuid.Nil, err
 		}
+		if aud, _ := token.Claims.GetAudience(); len(aud) > 0 {
+			return uuid.Nil, fmt.Errorf("token is not an access token")
+		}
 		idString, err := token.Claims.GetSubject()
 		if err != nil {
 			return uuid.Nil, err
@@ -76,6 +79,34 @@ func ValidateJwt(secretString, tokenString string)(uuid.UUID, error){
 		return id, nil
 }
 
+// GenerateTicket issues a short lived token that only grants access to the
+// given document, used by websocket clients that cannot send the access cookie.
+func GenerateTicket(secret string, userId, documentId uuid.UUID, expiresIn time.Duration) (string, error) {
+	claims := jwt.RegisteredClaims{
+		Issuer:    "godocs",
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
+		Subject:   userId.String(),
+		Audience:  jwt.ClaimStrings{documentId.String()},
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, &claims)
+	return token.SignedString([]byte(secret))
+}
+
+func ValidateTicket(secret, ticket string, documentId uuid.UUID) (uuid.UUID, error) {
+	token, err := jwt.ParseWithClaims(ticket, &jwt.RegisteredClaims{}, func(token *jwt.Token) (any, error) {
+		return []byte(secret), nil
+	}, jwt.WithAudience(documentId.String()), jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil {
+		return uuid.Nil, err
+	}
+	idString, err := token.Claims.GetSubject()
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return uuid.Parse(idString)
+}
+
 func GenerateRefreshToken() ( string, error ) {
 	b := make([]byte,32)
 	rand.Read(b)
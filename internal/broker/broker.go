@@ -0,0 +1,138 @@
+package broker
+
+import (
+	"context"
+	"sync"
+)
+
+// Broker fans messages out to every subscriber of a topic, on every server
+// sharing the broker, in the same order for all of them.
+type Broker interface {
+	Publish(ctx context.Context, topic string, payload []byte) error
+	Subscribe(topic string) (*Subscription, error)
+	// Shared reports whether other servers may publish on the same topics.
+	Shared() bool
+}
+
+// Subscription delivers the messages of a topic in the order they were
+// published. Messages are queued so a slow subscriber never blocks the
+// broker. A nil message means messages may have been lost, for instance
+// after a reconnection, and the subscriber should resynchronize.
+type Subscription struct {
+	C <-chan []byte
+
+	out    chan []byte
+	mu     sync.Mutex
+	queue  [][]byte
+	wake   chan struct{}
+	done   chan struct{}
+	once   sync.Once
+	cancel func()
+}
+
+func newSubscription(cancel func()) *Subscription {
+	s := &Subscription{
+		out:    make(chan []byte),
+		wake:   make(chan struct{}, 1),
+		done:   make(chan struct{}),
+		cancel: cancel,
+	}
+	s.C = s.out
+	go s.pump()
+	return s
+}
+
+func (s *Subscription) push(msg []byte) {
+	s.mu.Lock()
+	s.queue = append(s.queue, msg)
+	s.mu.Unlock()
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Subscription) pump() {
+	for {
+		s.mu.Lock()
+		if len(s.queue) == 0 {
+			s.mu.Unlock()
+			select {
+			case <-s.wake:
+				continue
+			case <-s.done:
+				return
+			}
+		}
+		msg := s.queue[0]
+		s.queue[0] = nil
+		s.queue = s.queue[1:]
+		s.mu.Unlock()
+		select {
+		case s.out <- msg:
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// Close stops the delivery of messages, it can be called more than once.
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		close(s.done)
+		s.cancel()
+	})
+}
+
+// topics keeps the subscriptions of each topic for the implementations.
+type topics struct {
+	mu   sync.Mutex
+	subs map[string]map[*Subscription]bool
+}
+
+// add registers a subscription and reports whether it is the first one of
+// its topic.
+func (t *topics) add(topic string, s *Subscription) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.subs == nil {
+		t.subs = make(map[string]map[*Subscription]bool)
+	}
+	first := len(t.subs[topic]) == 0
+	if first {
+		t.subs[topic] = make(map[*Subscription]bool)
+	}
+	t.subs[topic][s] = true
+	return first
+}
+
+// remove unregisters a subscription and reports whether it was the last one
+// of its topic.
+func (t *topics) remove(topic string, s *Subscription) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.subs[topic], s)
+	if len(t.subs[topic]) > 0 {
+		return false
+	}
+	delete(t.subs, topic)
+	return true
+}
+
+func (t *topics) push(topic string, msg []byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for s := range t.subs[topic] {
+		s.push(msg)
+	}
+}
+
+func (t *topics) pushAll(msg []byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, subs := range t.subs {
+		for s := range subs {
+			s.push(msg)
+		}
+	}
+}
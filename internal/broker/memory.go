@@ -0,0 +1,30 @@
+package broker
+
+import "context"
+
+// Memory is the broker of a single server, messages never leave the process.
+type Memory struct {
+	topics topics
+}
+
+func NewMemory() *Memory {
+	return &Memory{}
+}
+
+func (m *Memory) Publish(ctx context.Context, topic string, payload []byte) error {
+	m.topics.push(topic, payload)
+	return nil
+}
+
+func (m *Memory) Subscribe(topic string) (*Subscription, error) {
+	var s *Subscription
+	s = newSubscription(func() {
+		m.topics.remove(topic, s)
+	})
+	m.topics.add(topic, s)
+	return s, nil
+}
+
+func (m *Memory) Shared() bool {
+	return false
+}
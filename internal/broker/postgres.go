@@ -0,0 +1,172 @@
+package broker
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ahmedjebari022/go-docs/internal/database"
+	"github.com/lib/pq"
+)
+
+const (
+	// NOTIFY payloads are capped at 8000 bytes, bigger messages are stored in
+	// collab_messages, for a few minutes, and only their id is sent.
+	inlineLimit = 7000
+)
+
+// Postgres shares messages between servers with LISTEN/NOTIFY on the
+// database they already use. Notifications of a channel reach every listener
+// in commit order, which gives all servers the same ordering.
+type Postgres struct {
+	db       *sql.DB
+	queries  *database.Queries
+	listener *pq.Listener
+	topics   topics
+	// channels maps the LISTEN channels back to their topic
+	channels map[string]string
+}
+
+func NewPostgres(dbUrl string, db *sql.DB) *Postgres {
+	p := &Postgres{
+		db:       db,
+		queries:  database.New(db),
+		channels: make(map[string]string),
+	}
+	p.listener = pq.NewListener(dbUrl, 10*time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			fmt.Printf("broker listener error :%s\n", err.Error())
+		}
+	})
+	go p.listen()
+	go p.cleanup()
+	return p
+}
+
+func (p *Postgres) Shared() bool {
+	return true
+}
+
+func channelName(topic string) string {
+	sum := sha256.Sum256([]byte(topic))
+	return "godocs_" + hex.EncodeToString(sum[:20])
+}
+
+func (p *Postgres) Publish(ctx context.Context, topic string, payload []byte) error {
+	channel := channelName(topic)
+	if len(payload) <= inlineLimit {
+		return p.queries.Notify(ctx, database.NotifyParams{
+			Channel: channel,
+			Payload: string(payload),
+		})
+	}
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	qtx := p.queries.WithTx(tx)
+	id, err := qtx.CreateCollabMessage(ctx, database.CreateCollabMessageParams{
+		Channel: channel,
+		Payload: string(payload),
+	})
+	if err != nil {
+		return err
+	}
+	err = qtx.Notify(ctx, database.NotifyParams{
+		Channel: channel,
+		Payload: "@" + strconv.FormatInt(id, 10),
+	})
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (p *Postgres) Subscribe(topic string) (*Subscription, error) {
+	channel := channelName(topic)
+	var s *Subscription
+	s = newSubscription(func() {
+		if p.topics.remove(topic, s) {
+			p.topics.mu.Lock()
+			delete(p.channels, channel)
+			p.topics.mu.Unlock()
+			p.listener.Unlisten(channel)
+		}
+	})
+	if p.topics.add(topic, s) {
+		p.topics.mu.Lock()
+		p.channels[channel] = topic
+		p.topics.mu.Unlock()
+		if err := p.listener.Listen(channel); err != nil && err != pq.ErrChannelAlreadyOpen {
+			s.Close()
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (p *Postgres) listen() {
+	for {
+		select {
+		case n := <-p.listener.Notify:
+			if n == nil {
+				// the connection was reestablished, notifications sent in
+				// between are gone
+				p.topics.pushAll(nil)
+				continue
+			}
+			p.topics.mu.Lock()
+			topic, ok := p.channels[n.Channel]
+			p.topics.mu.Unlock()
+			if !ok {
+				continue
+			}
+			payload, err := p.payload(n.Extra)
+			if err != nil {
+				fmt.Printf("error while reading broker message :%s\n", err.Error())
+				p.topics.push(topic, nil)
+				continue
+			}
+			p.topics.push(topic, payload)
+		case <-time.After(90 * time.Second):
+			go p.listener.Ping()
+		}
+	}
+}
+
+func (p *Postgres) payload(extra string) ([]byte, error) {
+	ref, ok := strings.CutPrefix(extra, "@")
+	if !ok {
+		return []byte(extra), nil
+	}
+	id, err := strconv.ParseInt(ref, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	payload, err := p.queries.GetCollabMessagePayload(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(payload), nil
+}
+
+func (p *Postgres) cleanup() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for range ticker.C {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		err := p.queries.DeleteExpiredCollabMessages(ctx)
+		cancel()
+		if err != nil {
+			fmt.Printf("error while cleaning broker messages :%s\n", err.Error())
+		}
+	}
+}
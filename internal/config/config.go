@@ -1,8 +1,12 @@
 package config
 
-
-
-type Config struct{
-	Port 	string
-
-}
\ No newline at end of file
+import "time"
+
+type Config struct {
+	Port string
+	// websocket keepalive: the server pings every PingInterval and drops a
+	// connection that stays silent for PongWait or blocks a write for WriteWait
+	PingInterval time.Duration
+	PongWait     time.Duration
+	WriteWait    time.Duration
+}
@@ -12,25 +12,32 @@ import (
 )
 
 const createDocument = `-- name: CreateDocument :one
-INSERT INTO documents (id, created_at, updated_at, owner_id, name)
+INSERT INTO documents (id, created_at, updated_at, owner_id, name, workspace_id)
 VALUES(
     $1,
     NOW(),
     NOW(),
     $2,
-    $3
+    $3,
+    $4
 )
-RETURNING id, name, created_at, updated_at, owner_id
+RETURNING id, name, created_at, updated_at, owner_id, revision, folder_id, workspace_id
 `
 
 type CreateDocumentParams struct {
-	ID      uuid.UUID
-	OwnerID uuid.UUID
-	Name    string
+	ID          uuid.UUID
+	OwnerID     uuid.NullUUID
+	Name        string
+	WorkspaceID uuid.NullUUID
 }
 
 func (q *Queries) CreateDocument(ctx context.Context, arg CreateDocumentParams) (Document, error) {
-	row := q.db.QueryRowContext(ctx, createDocument, arg.ID, arg.OwnerID, arg.Name)
+	row := q.db.QueryRowContext(ctx, createDocument,
+		arg.ID,
+		arg.OwnerID,
+		arg.Name,
+		arg.WorkspaceID,
+	)
 	var i Document
 	err := row.Scan(
 		&i.ID,
@@ -38,6 +45,9 @@ func (q *Queries) CreateDocument(ctx context.Context, arg CreateDocumentParams)
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.OwnerID,
+		&i.Revision,
+		&i.FolderID,
+		&i.WorkspaceID,
 	)
 	return i, err
 }
@@ -51,8 +61,35 @@ func (q *Queries) DeleteDocument(ctx context.Context, id uuid.UUID) error {
 	return err
 }
 
+const getAllDocumentIds = `-- name: GetAllDocumentIds :many
+SELECT id FROM documents
+`
+
+func (q *Queries) GetAllDocumentIds(ctx context.Context) ([]uuid.UUID, error) {
+	rows, err := q.db.QueryContext(ctx, getAllDocumentIds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getDocument = `-- name: GetDocument :one
-SELECT id, name, created_at, updated_at, owner_id FROM documents WHERE id = $1
+SELECT id, name, created_at, updated_at, owner_id, revision, folder_id FROM documents WHERE id = $1
 `
 
 func (q *Queries) GetDocument(ctx context.Context, id uuid.UUID) (Document, error) {
@@ -64,6 +101,9 @@ func (q *Queries) GetDocument(ctx context.Context, id uuid.UUID) (Document, erro
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.OwnerID,
+		&i.Revision,
+		&i.FolderID,
+		&i.WorkspaceID,
 	)
 	return i, err
 }
@@ -92,13 +132,24 @@ const getDocumentOwnerId = `-- name: GetDocumentOwnerId :one
 SELECT owner_id from documents WHERE id = $1
 `
 
-func (q *Queries) GetDocumentOwnerId(ctx context.Context, id uuid.UUID) (uuid.UUID, error) {
+func (q *Queries) GetDocumentOwnerId(ctx context.Context, id uuid.UUID) (uuid.NullUUID, error) {
 	row := q.db.QueryRowContext(ctx, getDocumentOwnerId, id)
-	var owner_id uuid.UUID
+	var owner_id uuid.NullUUID
 	err := row.Scan(&owner_id)
 	return owner_id, err
 }
 
+const getDocumentRevision = `-- name: GetDocumentRevision :one
+SELECT revision FROM documents WHERE id = $1
+`
+
+func (q *Queries) GetDocumentRevision(ctx context.Context, id uuid.UUID) (int64, error) {
+	row := q.db.QueryRowContext(ctx, getDocumentRevision, id)
+	var revision int64
+	err := row.Scan(&revision)
+	return revision, err
+}
+
 const getDocumentsByOwner = `-- name: GetDocumentsByOwner :many
 SELECT id, name FROM documents
 WHERE owner_id = $1
@@ -109,7 +160,7 @@ type GetDocumentsByOwnerRow struct {
 	Name string
 }
 
-func (q *Queries) GetDocumentsByOwner(ctx context.Context, ownerID uuid.UUID) ([]GetDocumentsByOwnerRow, error) {
+func (q *Queries) GetDocumentsByOwner(ctx context.Context, ownerID uuid.NullUUID) ([]GetDocumentsByOwnerRow, error) {
 	rows, err := q.db.QueryContext(ctx, getDocumentsByOwner, ownerID)
 	if err != nil {
 		return nil, err
@@ -136,7 +187,10 @@ const getDocumentsByUser = `-- name: GetDocumentsByUser :many
 SELECT d.id, d.name FROM documents d
 LEFT JOIN document_permissions p
 ON p.document_id = d.id 
-WHERE p.user_id = $1 OR d.owner_id = $1
+WHERE p.user_id = $1 OR (d.owner_id = $1 AND NOT EXISTS (
+    SELECT 1 FROM workspace_members m
+    WHERE m.workspace_id = d.workspace_id AND m.user_id = $1 AND m.role = 'guest'
+))
 `
 
 type GetDocumentsByUserRow struct {
@@ -167,15 +221,37 @@ func (q *Queries) GetDocumentsByUser(ctx context.Context, userID uuid.UUID) ([]G
 	return items, nil
 }
 
-const updateDocument = `-- name: UpdateDocument :exec
+const updateDocument = `-- name: UpdateDocument :one
 UPDATE documents 
-SET updated_at = NOW()
+SET updated_at = NOW(), revision = revision + 1
 WHERE id = $1
+RETURNING revision
 `
 
-func (q *Queries) UpdateDocument(ctx context.Context, id uuid.UUID) error {
-	_, err := q.db.ExecContext(ctx, updateDocument, id)
-	return err
+func (q *Queries) UpdateDocument(ctx context.Context, id uuid.UUID) (int64, error) {
+	row := q.db.QueryRowContext(ctx, updateDocument, id)
+	var revision int64
+	err := row.Scan(&revision)
+	return revision, err
+}
+
+const updateDocumentIfRevision = `-- name: UpdateDocumentIfRevision :one
+UPDATE documents
+SET updated_at = NOW(), revision = revision + 1
+WHERE id = $1 AND revision = $2
+RETURNING revision
+`
+
+type UpdateDocumentIfRevisionParams struct {
+	ID       uuid.UUID
+	Revision int64
+}
+
+func (q *Queries) UpdateDocumentIfRevision(ctx context.Context, arg UpdateDocumentIfRevisionParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, updateDocumentIfRevision, arg.ID, arg.Revision)
+	var revision int64
+	err := row.Scan(&revision)
+	return revision, err
 }
 
 const updateDocumentName = `-- name: UpdateDocumentName :exec
@@ -6,17 +6,35 @@ package database
 
 import (
 	"database/sql"
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
 )
 
-type Document struct {
-	ID        uuid.UUID
-	Name      string
+type CollabMessage struct {
+	ID        int64
+	Channel   string
+	Payload   string
 	CreatedAt time.Time
+}
+
+type Document struct {
+	ID          uuid.UUID
+	Name        string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	OwnerID     uuid.NullUUID
+	Revision    int64
+	FolderID    uuid.NullUUID
+	WorkspaceID uuid.NullUUID
+}
+
+type DocumentContent struct {
+	Key       string
+	Content   json.RawMessage
+	Size      int64
 	UpdatedAt time.Time
-	OwnerID   uuid.UUID
 }
 
 type DocumentPermission struct {
@@ -27,6 +45,32 @@ type DocumentPermission struct {
 	UpdatedAt  time.Time
 }
 
+type DocumentVersion struct {
+	ID         uuid.UUID
+	DocumentID uuid.UUID
+	AuthorID   uuid.NullUUID
+	Kind       string
+	Label      sql.NullString
+	CreatedAt  time.Time
+}
+
+type Folder struct {
+	ID        uuid.UUID
+	Name      string
+	OwnerID   uuid.UUID
+	ParentID  uuid.NullUUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+type FolderPermission struct {
+	UserID    uuid.UUID
+	FolderID  uuid.UUID
+	Role      string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
 type RefreshToken struct {
 	Token     string
 	CreatedAt time.Time
@@ -36,6 +80,14 @@ type RefreshToken struct {
 	ExpiresAt time.Time
 }
 
+type StoreIntent struct {
+	ID         int64
+	Action     string
+	DocumentID uuid.UUID
+	Key        string
+	CreatedAt  time.Time
+}
+
 type User struct {
 	ID             uuid.UUID
 	Email          string
@@ -43,3 +95,28 @@ type User struct {
 	CreatedAt      time.Time
 	UpdatedAt      time.Time
 }
+
+type Workspace struct {
+	ID        uuid.UUID
+	Name      string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+type WorkspaceInvitation struct {
+	ID          uuid.UUID
+	WorkspaceID uuid.UUID
+	Email       string
+	Role        string
+	InvitedBy   uuid.NullUUID
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+}
+
+type WorkspaceMember struct {
+	WorkspaceID uuid.UUID
+	UserID      uuid.UUID
+	Role        string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
@@ -47,8 +47,24 @@ func (q *Queries) DeletePermission(ctx context.Context, arg DeletePermissionPara
 }
 
 const getUserPermission = `-- name: GetUserPermission :one
-SELECT role FROM document_permissions 
-WHERE user_id = $1 AND document_id = $2
+WITH RECURSIVE ancestors AS (
+    SELECT f.id, f.parent_id FROM folders f
+    INNER JOIN documents d ON d.folder_id = f.id
+    WHERE d.id = $2
+    UNION
+    SELECT f.id, f.parent_id FROM folders f
+    INNER JOIN ancestors a ON f.id = a.parent_id
+)
+SELECT role FROM (
+    SELECT role FROM document_permissions 
+    WHERE user_id = $1 AND document_id = $2
+    UNION ALL
+    SELECT p.role FROM folder_permissions p
+    INNER JOIN ancestors a ON a.id = p.folder_id
+    WHERE p.user_id = $1
+) roles
+ORDER BY role = 'editor' DESC
+LIMIT 1
 `
 
 type GetUserPermissionParams struct {
@@ -56,6 +72,8 @@ type GetUserPermissionParams struct {
 	DocumentID uuid.UUID
 }
 
+// the strongest role granted on the document itself or on the folders
+// holding it
 func (q *Queries) GetUserPermission(ctx context.Context, arg GetUserPermissionParams) (string, error) {
 	row := q.db.QueryRowContext(ctx, getUserPermission, arg.UserID, arg.DocumentID)
 	var role string
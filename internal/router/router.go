@@ -0,0 +1,93 @@
+package router
+
+import (
+	"net/http"
+
+	"github.com/ahmedjebari022/go-docs/internal/api"
+)
+
+// Prefix versions the API, breaking changes go under a new one.
+const Prefix = "/api/v1"
+
+// Route is an endpoint of the API, Pattern being relative to Prefix.
+type Route struct {
+	Method  string
+	Pattern string
+	Handler http.HandlerFunc
+	// Auth requires the access cookie, the handler then finds the user in the
+	// request context
+	Auth bool
+}
+
+// Routes lists every endpoint of the API.
+func Routes(cfg *api.ApiConfig) []Route {
+	return []Route{
+		{http.MethodPost, "/users", cfg.CreateUser, false},
+		{http.MethodPost, "/auth/login", cfg.LoginUser, false},
+		{http.MethodGet, "/cookie", cfg.ReaderCookieHandler, false},
+		{http.MethodPost, "/cookie/refresh", cfg.RefreshTokenHandler, false},
+		{http.MethodPost, "/cookie/revoke", cfg.RevokeTokenHandler, false},
+
+		{http.MethodGet, "/documents", cfg.GetDocumentsByUserHandler, true},
+		{http.MethodPost, "/documents", cfg.CreateDocumentHandler, true},
+		{http.MethodPost, "/documents/import", cfg.ImportHandler, true},
+		{http.MethodGet, "/documents/{documentId}", cfg.GetDocumentHandler, true},
+		{http.MethodPut, "/documents/{documentId}", cfg.UpdateDocumentHandler, true},
+		{http.MethodPatch, "/documents/{documentId}", cfg.PatchDocumentHandler, true},
+		{http.MethodDelete, "/documents/{documentId}", cfg.DeleteDocumentHandler, true},
+		{http.MethodPost, "/documents/{documentId}/ticket", cfg.CreateTicketHandler, true},
+		{http.MethodGet, "/documents/{documentId}/export", cfg.ExportHandler, true},
+		{http.MethodGet, "/documents/{documentId}/diff", cfg.DiffHandler, true},
+
+		{http.MethodPut, "/documents/{documentId}/folder", cfg.MoveDocumentHandler, true},
+
+		{http.MethodGet, "/folders", cfg.GetFoldersHandler, true},
+		{http.MethodPost, "/folders", cfg.CreateFolderHandler, true},
+		{http.MethodGet, "/folders/{folderId}", cfg.GetFolderHandler, true},
+		{http.MethodPut, "/folders/{folderId}", cfg.UpdateFolderHandler, true},
+		{http.MethodDelete, "/folders/{folderId}", cfg.DeleteFolderHandler, true},
+		{http.MethodGet, "/folders/{folderId}/collaborators", cfg.GetFolderCollaboratorsHandler, true},
+		{http.MethodPost, "/folders/{folderId}/collaborators", cfg.SetFolderCollaboratorHandler, true},
+		{http.MethodDelete, "/folders/{folderId}/collaborators", cfg.DeleteFolderCollaboratorHandler, true},
+
+		{http.MethodGet, "/documents/{documentId}/collaborators", cfg.GetCollaboratorsHandler, true},
+		{http.MethodPost, "/documents/{documentId}/collaborators", cfg.AddCollaboratorToDocumentHandler, true},
+		{http.MethodPut, "/documents/{documentId}/collaborators", cfg.UpdateUserPermissionHandler, true},
+		{http.MethodDelete, "/documents/{documentId}/collaborators", cfg.DeleteUserFromCollaboration, true},
+
+		{http.MethodGet, "/workspaces", cfg.GetWorkspacesHandler, true},
+		{http.MethodPost, "/workspaces", cfg.CreateWorkspaceHandler, true},
+		{http.MethodGet, "/workspaces/{workspaceId}", cfg.GetWorkspaceHandler, true},
+		{http.MethodGet, "/workspaces/{workspaceId}/documents", cfg.GetWorkspaceDocumentsHandler, true},
+		{http.MethodPut, "/workspaces/{workspaceId}/members/{userId}", cfg.UpdateWorkspaceMemberHandler, true},
+		{http.MethodDelete, "/workspaces/{workspaceId}/members/{userId}", cfg.DeleteWorkspaceMemberHandler, true},
+		{http.MethodGet, "/workspaces/{workspaceId}/invitations", cfg.GetWorkspaceInvitationsHandler, true},
+		{http.MethodPost, "/workspaces/{workspaceId}/invitations", cfg.CreateWorkspaceInvitationHandler, true},
+		{http.MethodDelete, "/workspaces/{workspaceId}/invitations/{invitationId}", cfg.DeleteWorkspaceInvitationHandler, true},
+
+		{http.MethodGet, "/invitations", cfg.GetInvitationsHandler, true},
+		{http.MethodPost, "/invitations/{invitationId}/accept", cfg.AcceptInvitationHandler, true},
+		{http.MethodPost, "/invitations/{invitationId}/decline", cfg.DeclineInvitationHandler, true},
+
+		{http.MethodGet, "/documents/{documentId}/versions", cfg.GetVersionsHandler, true},
+		{http.MethodPost, "/documents/{documentId}/versions", cfg.CreateVersionHandler, true},
+		{http.MethodGet, "/documents/{documentId}/versions/{versionId}", cfg.GetVersionHandler, true},
+		{http.MethodPost, "/documents/{documentId}/versions/{versionId}/restore", cfg.RestoreVersionHandler, true},
+	}
+}
+
+// New mounts the routes of the API under Prefix, and ws on the websocket of
+// documents. The websocket authenticates itself since the access cookie is
+// scoped to /api.
+func New(cfg *api.ApiConfig, ws http.HandlerFunc) *http.ServeMux {
+	mux := http.NewServeMux()
+	for _, route := range Routes(cfg) {
+		var handler http.Handler = route.Handler
+		if route.Auth {
+			handler = cfg.AuthMiddleware(handler)
+		}
+		mux.Handle(route.Method+" "+Prefix+route.Pattern, handler)
+	}
+	mux.HandleFunc("GET /ws/{documentId}", ws)
+	return mux
+}
@@ -0,0 +1,81 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/ahmedjebari022/go-docs/internal/api"
+)
+
+// handlerName is the name of the ApiConfig method a route serves.
+func handlerName(h http.HandlerFunc) string {
+	name := runtime.FuncForPC(reflect.ValueOf(h).Pointer()).Name()
+	name = strings.TrimSuffix(name, "-fm")
+	return name[strings.LastIndex(name, ".")+1:]
+}
+
+// TestRoutesMountEveryHandler checks that every exported method of ApiConfig
+// shaped like a handler is served by a route.
+func TestRoutesMountEveryHandler(t *testing.T) {
+	mounted := map[string]bool{}
+	for _, route := range Routes(&api.ApiConfig{}) {
+		mounted[handlerName(route.Handler)] = true
+	}
+	handlerType := reflect.TypeOf((func(http.ResponseWriter, *http.Request))(nil))
+	cfgType := reflect.TypeOf(&api.ApiConfig{})
+	for i := range cfgType.NumMethod() {
+		method := cfgType.Method(i)
+		// the receiver comes first in the type of the method
+		if method.Func.Type().NumIn() != 3 || method.Func.Type().NumOut() != 0 ||
+			method.Func.Type().In(1) != handlerType.In(0) || method.Func.Type().In(2) != handlerType.In(1) {
+			continue
+		}
+		if !mounted[method.Name] {
+			t.Errorf("%s is not mounted", method.Name)
+		}
+	}
+}
+
+func TestRoutes(t *testing.T) {
+	cfg := &api.ApiConfig{}
+	mux := New(cfg, func(w http.ResponseWriter, r *http.Request) {})
+	seen := map[string]bool{}
+	for _, route := range Routes(cfg) {
+		pattern := route.Method + " " + Prefix + route.Pattern
+		if seen[pattern] {
+			t.Errorf("%s is mounted twice", pattern)
+		}
+		seen[pattern] = true
+
+		path := strings.NewReplacer(
+			"{documentId}", "6f1c1f5e-3f4e-4b8e-9a57-2f0c4d1b7a10",
+			"{versionId}", "0b7f9a8e-5a3c-4d2e-8f61-7c9e2d4a1b35",
+			"{folderId}", "3d2c8e41-9b6f-4a7d-b1e0-5f8a2c6d9e47",
+			"{workspaceId}", "8a4e2b17-6c3d-4f90-a5b8-1d7e9c2f0a64",
+			"{userId}", "c5d91f3a-2e8b-4b76-9f04-6a1b3e7d8c52",
+			"{invitationId}", "e2f07b6d-4a19-4c8e-b3d5-9f6a1c2e7b80",
+		).Replace(Prefix + route.Pattern)
+		req := httptest.NewRequest(route.Method, path, nil)
+		if _, got := mux.Handler(req); got != pattern {
+			t.Errorf("%s %s: routed to %q, want %q", route.Method, path, got, pattern)
+			continue
+		}
+		if !route.Auth {
+			continue
+		}
+		// without the access cookie the middleware answers before the handler
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("%s: got status %d without authentication, want 401", pattern, rec.Code)
+		}
+	}
+	req := httptest.NewRequest(http.MethodGet, "/ws/6f1c1f5e-3f4e-4b8e-9a57-2f0c4d1b7a10", nil)
+	if _, got := mux.Handler(req); got != "GET /ws/{documentId}" {
+		t.Errorf("websocket routed to %q", got)
+	}
+}
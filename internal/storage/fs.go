@@ -0,0 +1,193 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// tempPrefix starts the names of the files being written, which List skips.
+// Files written before the stores were named tmp.json followed by digits.
+const (
+	tempPrefix       = ".tmp-"
+	legacyTempPrefix = "tmp.json"
+)
+
+// Filesystem keeps the content as files under a root directory, the key
+// being the path of the file. It only suits a single server, or servers
+// sharing the directory.
+type Filesystem struct {
+	root string
+}
+
+func NewFilesystem(root string) *Filesystem {
+	return &Filesystem{root: root}
+}
+
+func (f *Filesystem) path(key string) (string, error) {
+	if err := validKey(key); err != nil {
+		return "", err
+	}
+	return filepath.Join(f.root, filepath.FromSlash(key)), nil
+}
+
+func (f *Filesystem) Get(ctx context.Context, key string) ([]byte, error) {
+	path, err := f.path(key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
+
+// Put writes the content to a temporary file renamed over the file of the
+// key, so that it is replaced at once. The file and then the directory are
+// synced, so that after a crash the key holds either the old content or the
+// new one in full.
+func (f *Filesystem) Put(ctx context.Context, key string, data []byte) error {
+	path, err := f.path(key)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, tempPrefix+"*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// Delete removes the file of the key, and the directories left empty up to
+// the root.
+func (f *Filesystem) Delete(ctx context.Context, key string) error {
+	path, err := f.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	root := filepath.Clean(f.root)
+	for dir := filepath.Dir(path); dir != root && strings.HasPrefix(dir, root); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+	return nil
+}
+
+func (f *Filesystem) List(ctx context.Context, prefix string) ([]string, error) {
+	// only the directory holding the prefix needs to be walked
+	dir := f.root
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		path, err := f.path(prefix[:i])
+		if err != nil {
+			return nil, err
+		}
+		dir = path
+	}
+	var keys []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || isTemp(d.Name()) {
+			return nil
+		}
+		rel, err := filepath.Rel(f.root, path)
+		if err != nil {
+			return err
+		}
+		if key := filepath.ToSlash(rel); strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(keys)
+	return keys, nil
+}
+
+func (f *Filesystem) Stat(ctx context.Context, key string) (Info, error) {
+	path, err := f.path(key)
+	if err != nil {
+		return Info{}, err
+	}
+	fi, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return Info{}, ErrNotFound
+	}
+	if err != nil {
+		return Info{}, err
+	}
+	return Info{Key: key, Size: fi.Size(), ModTime: fi.ModTime()}, nil
+}
+
+// Sweep removes the temporary files older than before, left by writes a
+// crash interrupted.
+func (f *Filesystem) Sweep(ctx context.Context, before time.Time) (int, error) {
+	removed := 0
+	err := filepath.WalkDir(f.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || !isTemp(d.Name()) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil || !info.ModTime().Before(before) {
+			return nil
+		}
+		if os.Remove(path) == nil {
+			removed++
+		}
+		return nil
+	})
+	return removed, err
+}
+
+func isTemp(name string) bool {
+	return strings.HasPrefix(name, tempPrefix) || (strings.HasPrefix(name, legacyTempPrefix) && name != legacyTempPrefix)
+}
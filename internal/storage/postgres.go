@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/ahmedjebari022/go-docs/internal/database"
+)
+
+// likeEscaper escapes the wildcards of LIKE patterns.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// Postgres keeps the content as JSONB in the document_contents table of the
+// database the servers already share. Postgres normalizes JSONB, so Get may
+// return the json of a Put formatted differently.
+type Postgres struct {
+	queries *database.Queries
+}
+
+func NewPostgres(db *sql.DB) *Postgres {
+	return &Postgres{queries: database.New(db)}
+}
+
+func (p *Postgres) Get(ctx context.Context, key string) ([]byte, error) {
+	content, err := p.queries.GetDocumentContent(ctx, key)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return content, err
+}
+
+func (p *Postgres) Put(ctx context.Context, key string, data []byte) error {
+	if err := validKey(key); err != nil {
+		return err
+	}
+	return p.queries.PutDocumentContent(ctx, database.PutDocumentContentParams{
+		Key:     key,
+		Content: data,
+		Size:    int64(len(data)),
+	})
+}
+
+func (p *Postgres) Delete(ctx context.Context, key string) error {
+	return p.queries.DeleteDocumentContent(ctx, key)
+}
+
+func (p *Postgres) List(ctx context.Context, prefix string) ([]string, error) {
+	return p.queries.ListDocumentContents(ctx, likeEscaper.Replace(prefix)+"%")
+}
+
+func (p *Postgres) Stat(ctx context.Context, key string) (Info, error) {
+	info, err := p.queries.GetDocumentContentInfo(ctx, key)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Info{}, ErrNotFound
+	}
+	if err != nil {
+		return Info{}, err
+	}
+	return Info{Key: info.Key, Size: info.Size, ModTime: info.UpdatedAt}, nil
+}
@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned when no content is stored under a key.
+var ErrNotFound = errors.New("content not found")
+
+// DocumentStore keeps the content of documents and of their versions as json
+// under slash separated keys, like "<document id>.json". Put replaces the
+// content of a key as a whole, readers never see it half written.
+type DocumentStore interface {
+	Get(ctx context.Context, key string) ([]byte, error)
+	Put(ctx context.Context, key string, data []byte) error
+	// Delete removes the content of a key, removing a missing key is not an
+	// error.
+	Delete(ctx context.Context, key string) error
+	// List returns the keys starting with prefix, in lexical order.
+	List(ctx context.Context, prefix string) ([]string, error)
+	Stat(ctx context.Context, key string) (Info, error)
+}
+
+// Sweeper is implemented by the stores that leave temporary data behind when
+// a write is interrupted, Sweep removes what is older than before and
+// returns how much it removed.
+type Sweeper interface {
+	Sweep(ctx context.Context, before time.Time) (int, error)
+}
+
+// Info describes the content stored under a key.
+type Info struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
+
+// validKey rejects the keys that could point outside of the store, the
+// implementations map keys to paths.
+func validKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || path.Clean(key) != key || strings.HasPrefix(key, "../") || key == ".." {
+		return fmt.Errorf("invalid key %q", key)
+	}
+	return nil
+}
@@ -7,10 +7,14 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/ahmedjebari022/go-docs/internal/api"
+	"github.com/ahmedjebari022/go-docs/internal/broker"
 	"github.com/ahmedjebari022/go-docs/internal/config"
 	"github.com/ahmedjebari022/go-docs/internal/database"
+	"github.com/ahmedjebari022/go-docs/internal/router"
+	"github.com/ahmedjebari022/go-docs/internal/storage"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
 )
@@ -31,9 +35,6 @@ func main(){
 	if cookieKey == ""{
 		log.Fatal("Missing cookie secret Key")
 	}
-	if assetsPath == ""{
-		log.Fatal("Missing assets path")
-	}
 	db, err := sql.Open("postgres",dbUrl)
 
 	if err != nil {
@@ -48,37 +49,73 @@ func main(){
 
 	cfg := config.Config{
 		Port: port,
+		PingInterval: durationFromEnv("WS_PING_INTERVAL", 30*time.Second),
+		PongWait: durationFromEnv("WS_PONG_WAIT", 60*time.Second),
+		WriteWait: durationFromEnv("WS_WRITE_WAIT", 10*time.Second),
+	}
+	if cfg.PingInterval >= cfg.PongWait {
+		log.Fatal("WS_PING_INTERVAL must be shorter than WS_PONG_WAIT")
+	}
+	var store storage.DocumentStore
+	switch os.Getenv("STORAGE") {
+	case "", "fs":
+		if assetsPath == ""{
+			log.Fatal("Missing assets path")
+		}
+		store = storage.NewFilesystem(assetsPath)
+	case "postgres":
+		store = storage.NewPostgres(db)
+	case "s3":
+		store, err = storage.NewS3(storage.S3Config{
+			Endpoint: os.Getenv("S3_ENDPOINT"),
+			Region: os.Getenv("S3_REGION"),
+			Bucket: os.Getenv("S3_BUCKET"),
+			AccessKey: os.Getenv("S3_ACCESS_KEY_ID"),
+			SecretKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+		})
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+	default:
+		log.Fatal("STORAGE must be fs, postgres or s3")
 	}
 	apiCfg := api.ApiConfig{
 		DbC: db,
 		Db:dbQueries,
 		SecretKey: secretKey,
 		CookieKey: ck,
-		AssetsPath: assetsPath,
+		Store: store,
 		Port: port,
 	}
 
 
-	mux := http.NewServeMux()
+	var hubBroker broker.Broker = broker.NewMemory()
+	if os.Getenv("BROKER") == "postgres" {
+		hubBroker = broker.NewPostgres(dbUrl, db)
+	}
+	hub := NewHub(&apiCfg, cfg, hubBroker)
+	apiCfg.DocumentChanged = hub.reset
+	go apiCfg.RunReconciler(durationFromEnv("RECONCILE_INTERVAL", 10*time.Minute))
+
 	srv := &http.Server{
 		Addr: ":" + cfg.Port ,
-		Handler: mux,
+		Handler: router.New(&apiCfg, hub.wsHandler),
 	}
 
-	hub := NewHub()
-	go hub.Run()
-	mux.HandleFunc("POST /api/users",apiCfg.CreateUser)
-	mux.HandleFunc("POST /api/auth/login",apiCfg.LoginUser)
-	mux.HandleFunc("GET /api/cookie",apiCfg.ReaderCookieHandler)
-	mux.HandleFunc("POST /api/cookie/refresh",apiCfg.RefreshTokenHandler)
-	mux.Handle("POST /api/documents",apiCfg.AuthMiddleware(http.HandlerFunc(apiCfg.CreateDocumentHandler)))
-	mux.HandleFunc("/ws/{documentId}",hub.wsHandler)
-
 
 	fmt.Printf("Serving on:  http://localhost:%s\n", cfg.Port)
 	log.Fatal(srv.ListenAndServe())
 
 }
 
-
-
+func durationFromEnv(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Fatalf("invalid %s: %s", name, err.Error())
+	}
+	return d
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"hash/fnv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// presenceThrottle is the minimum delay between two selection updates of the
+// same user forwarded to the room, intermediate moves are coalesced.
+const presenceThrottle = 100 * time.Millisecond
+
+var collaboratorColors = []string{
+	"#e6194b", "#3cb44b", "#4363d8", "#f58231", "#911eb4",
+	"#46a5a5", "#f032e6", "#808000", "#9a6324", "#000075",
+}
+
+type Position struct {
+	Bloc   int `json:"bloc"`
+	Offset int `json:"offset"`
+}
+
+// Selection is a range between two positions, a plain cursor when both ends
+// are the same.
+type Selection struct {
+	Anchor Position `json:"anchor"`
+	Head   Position `json:"head"`
+}
+
+type Collaborator struct {
+	UserId    uuid.UUID  `json:"user_id"`
+	Email     string     `json:"email"`
+	Color     string     `json:"color"`
+	Selection *Selection `json:"selection,omitempty"`
+}
+
+// presence tracks a user of a room on every server, Conns counts the servers
+// the user is connected through.
+type presence struct {
+	Collaborator
+	Conns int `json:"conns"`
+}
+
+// localUser tracks the connections a user has on this server and throttles
+// their selection updates before they go through the broker.
+type localUser struct {
+	conns     int
+	selection *Selection
+	pending   bool
+	lastSent  time.Time
+}
+
+// colorFor gives every user the same colour in every document.
+func colorFor(userId uuid.UUID) string {
+	h := fnv.New32a()
+	h.Write(userId[:])
+	return collaboratorColors[h.Sum32()%uint32(len(collaboratorColors))]
+}
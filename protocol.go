@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/ahmedjebari022/go-docs/internal/api"
+	"github.com/google/uuid"
+)
+
+// protocolVersion is negotiated as a websocket subprotocol on connect. Bump
+// it, and keep serving the previous one for a while, on breaking changes.
+const protocolVersion = "godocs.v1"
+
+// Message kinds of the envelope. Clients send op, presence and snapshot (to
+// ask for a fresh copy after an error), the server sends all of them.
+const (
+	OpMessage       = "op"
+	AckMessage      = "ack"
+	SnapshotMessage = "snapshot"
+	PresenceMessage = "presence"
+	ErrorMessage    = "error"
+)
+
+// Error codes carried by error frames.
+const (
+	InvalidMessageError    = "invalid_message"
+	UnsupportedTypeError   = "unsupported_type"
+	ForbiddenError         = "forbidden"
+	InvalidRevisionError   = "invalid_revision"
+	InvalidOperationsError = "invalid_operations"
+	TooLargeError          = "too_large"
+	UnavailableError       = "unavailable"
+)
+
+// Presence events.
+const (
+	JoinEvent  = "join"
+	LeaveEvent = "leave"
+	MoveEvent  = "move"
+)
+
+// Envelope wraps every frame in both directions. Seq is chosen by the client
+// and echoed in the ack or error answering its message, Revision is the
+// document revision the message was written against or produced.
+type Envelope struct {
+	Type       string          `json:"type"`
+	DocumentId string          `json:"document_id,omitempty"`
+	Seq        int             `json:"seq,omitempty"`
+	Revision   int             `json:"revision"`
+	Payload    json.RawMessage `json:"payload,omitempty"`
+}
+
+// OpPayload carries operations. Those sent by the server name the session
+// they come from, so that a client catching up recognizes its own operations
+// by their Seq instead of applying them twice.
+type OpPayload struct {
+	Ops     []api.Operation `json:"ops"`
+	UserId  uuid.UUID       `json:"user_id,omitempty"`
+	Session string          `json:"session,omitempty"`
+}
+
+// SnapshotPayload is the whole document at the revision of the envelope.
+// Epoch changes whenever the server starts the document afresh, revisions
+// of different epochs cannot be compared. LastSeq is the last operation of
+// the session already part of the document.
+type SnapshotPayload struct {
+	Document      api.Document   `json:"document"`
+	Collaborators []Collaborator `json:"collaborators"`
+	Epoch         string         `json:"epoch"`
+	LastSeq       int            `json:"last_seq,omitempty"`
+}
+
+type PresencePayload struct {
+	Event        string        `json:"event,omitempty"`
+	Collaborator *Collaborator `json:"collaborator,omitempty"`
+	Selection    *Selection    `json:"selection,omitempty"`
+}
+
+type ErrorPayload struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Message is an envelope received from a client once decoded.
+type Message struct {
+	Type      string
+	Seq       int
+	Revision  int
+	Ops       []api.Operation
+	Selection *Selection
+	Err       *ErrorPayload
+	client    *Client
+}
+
+func newEnvelope(kind, documentId string, revision int, payload any) Envelope {
+	env := Envelope{Type: kind, DocumentId: documentId, Revision: revision}
+	if payload != nil {
+		// payloads are plain structs, marshalling them cannot fail
+		env.Payload, _ = json.Marshal(payload)
+	}
+	return env
+}
+
+// decodeMessage reads a client envelope. Protocol errors are reported in
+// Message.Err so they can be answered instead of dropping the connection.
+func decodeMessage(env Envelope) Message {
+	msg := Message{Type: env.Type, Seq: env.Seq, Revision: env.Revision}
+	switch env.Type {
+	case OpMessage:
+		var payload OpPayload
+		if err := json.Unmarshal(env.Payload, &payload); err != nil {
+			msg.Err = &ErrorPayload{Code: InvalidMessageError, Message: err.Error()}
+			return msg
+		}
+		msg.Ops = payload.Ops
+	case PresenceMessage:
+		var payload PresencePayload
+		if err := json.Unmarshal(env.Payload, &payload); err != nil {
+			msg.Err = &ErrorPayload{Code: InvalidMessageError, Message: err.Error()}
+			return msg
+		}
+		if payload.Selection == nil {
+			msg.Err = &ErrorPayload{Code: InvalidMessageError, Message: "missing selection"}
+			return msg
+		}
+		msg.Selection = payload.Selection
+	case SnapshotMessage:
+	default:
+		msg.Err = &ErrorPayload{Code: UnsupportedTypeError, Message: "unsupported message type " + env.Type}
+	}
+	return msg
+}
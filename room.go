@@ -0,0 +1,482 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ahmedjebari022/go-docs/internal/api"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// flushDebounce is how long a document stays quiet before it is saved,
+	// flushMaxDelay caps how long edits can stay unsaved while typing goes on.
+	flushDebounce = 2 * time.Second
+	flushMaxDelay = 10 * time.Second
+	flushTimeout  = 5 * time.Second
+	// reconnectGrace keeps an empty room open for a while, so that clients
+	// that lost their connection can resume rather than reload the document.
+	reconnectGrace = 30 * time.Second
+	// snapshotInterval is how often a document being edited is recorded as
+	// a version, it is recorded again when the last client leaves.
+	snapshotInterval = 10 * time.Minute
+)
+
+// Room holds the shared state of a document while clients edit it. Changes
+// from local clients go through the broker and are applied when they come
+// back, in the same order on every server.
+// history[i] holds the operations that moved the document from revision
+// base()+i to base()+i+1.
+type Room struct {
+	documentId string
+	hub        *Hub
+	clients    map[*Client]bool
+	// pending clients wait for the document to be loaded or synced
+	pending  map[*Client]bool
+	presence map[uuid.UUID]*presence
+	local    map[uuid.UUID]*localUser
+	// refs counts clients joined or joining, guarded by hub.mu
+	refs int
+
+	document api.Document
+	revision int
+	history  []revision
+	// epoch is chosen when the document is read from the assets and shared
+	// with the state, a client can only resume within the same epoch
+	epoch    string
+	sessions map[string]applied
+	ready    bool
+	loadErr  error
+	// dirty is set while edits made through this server have not been
+	// flushed to the assets yet
+	dirty     bool
+	lastEdit  time.Time
+	lastFlush time.Time
+	// stored is the revision of the document in the database the content was
+	// read or saved at, flushes only save on top of it. staleSince is when a
+	// flush first found the document moved past it.
+	stored     int64
+	staleSince time.Time
+	// emptySince is when the last client left
+	emptySince time.Time
+	// unversioned is set when edits made through this server have not been
+	// recorded as a version yet, so that a single server records them
+	unversioned  bool
+	lastAuthor   uuid.UUID
+	lastSnapshot time.Time
+
+	syncNonce string
+	syncSeen  bool
+	syncTimer <-chan time.Time
+	buffered  []event
+
+	joining  chan *Client
+	leaving  chan *Client
+	incoming chan Message
+	done     chan struct{}
+}
+
+func newRoom(h *Hub, documentId string) *Room {
+	return &Room{
+		documentId:   documentId,
+		hub:          h,
+		clients:      make(map[*Client]bool),
+		pending:      make(map[*Client]bool),
+		presence:     make(map[uuid.UUID]*presence),
+		local:        make(map[uuid.UUID]*localUser),
+		sessions:     make(map[string]applied),
+		lastFlush:    time.Now(),
+		lastSnapshot: time.Now(),
+		joining:      make(chan *Client),
+		leaving:      make(chan *Client),
+		incoming:     make(chan Message, sendQueueSize),
+		done:         make(chan struct{}),
+	}
+}
+
+func (r *Room) join(c *Client) {
+	r.joining <- c
+}
+
+// leave is safe to call after the room has stopped or evicted the client.
+func (r *Room) leave(c *Client) {
+	select {
+	case r.leaving <- c:
+	case <-r.done:
+	}
+}
+
+// submit queues a message for the room and reports false once it has stopped.
+func (r *Room) submit(msg Message) bool {
+	select {
+	case r.incoming <- msg:
+		return true
+	case <-r.done:
+		return false
+	}
+}
+
+func (r *Room) Run() {
+	defer close(r.done)
+	var events <-chan []byte
+	sub, err := r.hub.broker.Subscribe(r.documentId)
+	if err != nil {
+		r.loadErr = err
+		r.finishSync()
+	} else {
+		defer sub.Close()
+		events = sub.C
+		r.resync()
+	}
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	presenceTicker := time.NewTicker(presenceThrottle)
+	defer presenceTicker.Stop()
+	for {
+		select {
+		case client := <-r.joining:
+			r.add(client)
+		case client := <-r.leaving:
+			r.remove(client)
+		case msg := <-r.incoming:
+			r.handle(msg)
+		case payload := <-events:
+			r.receive(payload)
+		case <-r.syncTimer:
+			r.finishSync()
+		case now := <-presenceTicker.C:
+			for userId, u := range r.local {
+				if u.pending && now.Sub(u.lastSent) >= presenceThrottle {
+					r.publishSelection(userId, u, now)
+				}
+			}
+		case now := <-ticker.C:
+			if r.dirty && (now.Sub(r.lastEdit) >= flushDebounce || now.Sub(r.lastFlush) >= flushMaxDelay) {
+				r.flush()
+			}
+		}
+		if len(r.clients) > 0 || len(r.pending) > 0 {
+			r.emptySince = time.Time{}
+			continue
+		}
+		if r.emptySince.IsZero() {
+			r.emptySince = time.Now()
+		}
+		r.flush()
+		r.snapshot(true)
+		if !r.dirty && time.Since(r.emptySince) >= reconnectGrace && r.hub.release(r) {
+			return
+		}
+	}
+}
+
+func (r *Room) load() {
+	r.lastFlush = time.Now()
+	id, err := uuid.Parse(r.documentId)
+	if err != nil {
+		r.loadErr = err
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+	defer cancel()
+	r.document, r.stored, r.loadErr = r.hub.cfg.LoadRevision(ctx, id)
+	r.epoch = uuid.NewString()
+}
+
+// base is the revision the history starts from.
+func (r *Room) base() int {
+	return r.revision - len(r.history)
+}
+
+func (r *Room) add(client *Client) {
+	if !r.ready {
+		r.pending[client] = true
+		return
+	}
+	r.admit(client)
+}
+
+func (r *Room) admit(client *Client) {
+	r.clients[client] = true
+	if r.loadErr != nil {
+		fmt.Printf("error while opening the document :%s\n", r.loadErr.Error())
+		r.evict(client, websocket.CloseInternalServerErr, "document unavailable")
+		return
+	}
+	u, ok := r.local[client.userId]
+	if !ok {
+		u = &localUser{}
+		r.local[client.userId] = u
+		r.publish(event{
+			Kind:   joinEvent,
+			UserId: client.userId,
+			Collaborator: &Collaborator{
+				UserId: client.userId,
+				Email:  client.email,
+				Color:  colorFor(client.userId),
+			},
+		})
+	}
+	u.conns++
+	for c := range r.clients {
+		if c != client && c.userId == client.userId && c.session == client.session {
+			r.evict(c, websocket.CloseNormalClosure, "replaced by a new connection")
+		}
+	}
+	if !r.catchUp(client) {
+		r.sendSnapshot(client)
+	}
+}
+
+// catchUp sends a reconnecting client the operations it missed, and reports
+// false when it is too far behind or comes from another epoch. Missing more
+// than its send queue holds counts as too far behind, the client would be
+// disconnected before it drained them.
+func (r *Room) catchUp(client *Client) bool {
+	from := client.resumeRevision
+	if from < 0 || client.resumeEpoch != r.epoch || from < r.base() || from > r.revision {
+		return false
+	}
+	if r.revision-from+len(r.presence) > cap(client.sent)-len(client.sent) {
+		return false
+	}
+	for i, rev := range r.history[from-r.base():] {
+		env := newEnvelope(OpMessage, r.documentId, from+i+1, OpPayload{
+			Ops:     rev.Ops,
+			UserId:  rev.UserId,
+			Session: rev.Session,
+		})
+		env.Seq = rev.Seq
+		r.send(client, env)
+	}
+	for _, collaborator := range r.collaborators() {
+		r.send(client, r.envelope(PresenceMessage, PresencePayload{Event: JoinEvent, Collaborator: &collaborator}))
+	}
+	return true
+}
+
+func (r *Room) sendSnapshot(client *Client) {
+	r.send(client, r.envelope(SnapshotMessage, SnapshotPayload{
+		Document:      r.document,
+		Collaborators: r.collaborators(),
+		Epoch:         r.epoch,
+		LastSeq:       r.sessions[sessionKey(client.userId, client.session)].Seq,
+	}))
+}
+
+func (r *Room) envelope(kind string, payload any) Envelope {
+	return newEnvelope(kind, r.documentId, r.revision, payload)
+}
+
+// handle dispatches a message received from a client.
+func (r *Room) handle(msg Message) {
+	if !r.clients[msg.client] {
+		return
+	}
+	if msg.Err != nil {
+		r.sendError(msg.client, msg.Seq, *msg.Err)
+		return
+	}
+	switch msg.Type {
+	case OpMessage:
+		last := r.sessions[sessionKey(msg.client.userId, msg.client.session)]
+		replayed := msg.Seq > 0 && msg.Seq <= last.Seq
+		if !replayed && (msg.Revision < r.base() || msg.Revision > r.revision) {
+			r.sendError(msg.client, msg.Seq, ErrorPayload{Code: InvalidRevisionError, Message: "unknown revision"})
+			return
+		}
+		err := r.publish(event{
+			Kind:     opEvent,
+			Session:  msg.client.session,
+			Seq:      msg.Seq,
+			Revision: msg.Revision,
+			Ops:      msg.Ops,
+			UserId:   msg.client.userId,
+		})
+		if err != nil {
+			r.sendError(msg.client, msg.Seq, ErrorPayload{Code: UnavailableError, Message: err.Error()})
+		}
+	case PresenceMessage:
+		r.move(msg.client, *msg.Selection)
+	case SnapshotMessage:
+		r.sendSnapshot(msg.client)
+	}
+}
+
+func (r *Room) sendError(client *Client, seq int, payload ErrorPayload) {
+	env := r.envelope(ErrorMessage, payload)
+	env.Seq = seq
+	r.send(client, env)
+}
+
+func (r *Room) collaborators() []Collaborator {
+	collaborators := make([]Collaborator, 0, len(r.presence))
+	for _, p := range r.presence {
+		collaborators = append(collaborators, p.Collaborator)
+	}
+	return collaborators
+}
+
+// move records the selection of a user and publishes it, unless the user
+// moved too recently in which case the presence ticker publishes it later.
+func (r *Room) move(client *Client, selection Selection) {
+	u, ok := r.local[client.userId]
+	if !ok {
+		return
+	}
+	u.selection = &selection
+	u.pending = true
+	if now := time.Now(); now.Sub(u.lastSent) >= presenceThrottle {
+		r.publishSelection(client.userId, u, now)
+	}
+}
+
+func (r *Room) publishSelection(userId uuid.UUID, u *localUser, now time.Time) {
+	u.pending = false
+	u.lastSent = now
+	r.publish(event{
+		Kind:         moveEvent,
+		UserId:       userId,
+		Collaborator: &Collaborator{UserId: userId, Selection: u.selection},
+	})
+}
+
+// sendOthers sends an update to every connection that isn't the given user's.
+func (r *Room) sendOthers(userId uuid.UUID, env Envelope) {
+	for c := range r.clients {
+		if c.userId != userId {
+			r.send(c, env)
+		}
+	}
+}
+
+// remove is idempotent: the Reader asks for it when the connection ends but
+// the client may have been evicted already.
+func (r *Room) remove(client *Client) {
+	if r.pending[client] {
+		delete(r.pending, client)
+		close(client.sent)
+		r.hub.forget(r)
+		return
+	}
+	if _, ok := r.clients[client]; !ok {
+		return
+	}
+	delete(r.clients, client)
+	close(client.sent)
+	r.hub.forget(r)
+	if u, ok := r.local[client.userId]; ok {
+		u.conns--
+		if u.conns == 0 {
+			delete(r.local, client.userId)
+			r.publish(event{Kind: leaveEvent, UserId: client.userId})
+		}
+	}
+}
+
+// evict removes a client and tells it why in the close frame.
+func (r *Room) evict(client *Client, code int, reason string) {
+	if _, ok := r.clients[client]; !ok {
+		return
+	}
+	client.closeCode = code
+	client.closeReason = reason
+	r.remove(client)
+}
+
+// send never blocks the room: a client whose queue is full has fallen too far
+// behind to catch up with the operations, so it is disconnected and has to
+// join again to get a fresh snapshot.
+func (r *Room) send(client *Client, env Envelope) {
+	select {
+	case client.sent <- env:
+	default:
+		fmt.Printf("disconnecting slow client of %s\n", r.documentId)
+		r.evict(client, websocket.CloseTryAgainLater, "too slow to keep up")
+	}
+}
+
+// flush writes the document to the assets. On failure the room stays dirty
+// so the next tick tries again.
+func (r *Room) flush() {
+	if !r.dirty {
+		return
+	}
+	id, err := uuid.Parse(r.documentId)
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+	defer cancel()
+	r.lastFlush = time.Now()
+	saved, err := r.hub.cfg.SaveDocument(ctx, id, r.stored, r.document)
+	if errors.Is(err, api.ErrStaleRevision) {
+		r.stale(ctx, id)
+		return
+	}
+	if err != nil {
+		fmt.Printf("error while saving the document %s :%s\n", r.documentId, err.Error())
+		return
+	}
+	r.stored = saved
+	r.staleSince = time.Time{}
+	r.dirty = false
+	if err := r.publish(event{Kind: savedEvent, Stored: saved}); err != nil {
+		fmt.Printf("error while sharing the save of %s :%s\n", r.documentId, err.Error())
+	}
+	r.snapshot(false)
+}
+
+// stale handles a flush refused because the document was saved since the
+// room read it. A save through the api is followed by its reset and one by
+// another server by its saved event, so the room waits for them rather than
+// overwrite the save. Should none come, the stored document replaces the
+// room on every server.
+func (r *Room) stale(ctx context.Context, id uuid.UUID) {
+	if r.staleSince.IsZero() {
+		r.staleSince = time.Now()
+	}
+	if time.Since(r.staleSince) < flushMaxDelay {
+		return
+	}
+	doc, stored, err := r.hub.cfg.LoadRevision(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		// deleted, there is nothing left to save
+		r.dirty = false
+		return
+	}
+	if err != nil {
+		fmt.Printf("error while reloading the document %s :%s\n", r.documentId, err.Error())
+		return
+	}
+	fmt.Printf("dropping the unsaved edits of %s, it was saved elsewhere\n", r.documentId)
+	err = r.publish(event{Kind: resetEvent, Epoch: uuid.NewString(), Document: &doc, Stored: stored})
+	if err != nil {
+		fmt.Printf("error while resetting the document %s :%s\n", r.documentId, err.Error())
+	}
+}
+
+// snapshot records the flushed document as a version once snapshotInterval
+// has passed since the last one, or right away when force is set.
+func (r *Room) snapshot(force bool) {
+	if r.dirty || !r.unversioned || (!force && time.Since(r.lastSnapshot) < snapshotInterval) {
+		return
+	}
+	id, err := uuid.Parse(r.documentId)
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+	defer cancel()
+	r.lastSnapshot = time.Now()
+	_, err = r.hub.cfg.CreateVersion(ctx, id, r.lastAuthor, api.SnapshotVersion, "", r.document)
+	if err != nil {
+		fmt.Printf("error while recording a version of %s :%s\n", r.documentId, err.Error())
+		return
+	}
+	r.unversioned = false
+}
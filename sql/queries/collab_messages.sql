@@ -0,0 +1,16 @@
+-- name: CreateCollabMessage :one
+INSERT INTO collab_messages (channel, payload)
+VALUES(
+    $1,
+    $2
+)
+RETURNING id;
+
+-- name: GetCollabMessagePayload :one
+SELECT payload FROM collab_messages WHERE id = $1 ;
+
+-- name: DeleteExpiredCollabMessages :exec
+DELETE FROM collab_messages WHERE created_at < NOW() - INTERVAL '5 minutes' ;
+
+-- name: Notify :exec
+SELECT pg_notify(sqlc.arg(channel)::text, sqlc.arg(payload)::text);
@@ -0,0 +1,24 @@
+-- name: PutDocumentContent :exec
+INSERT INTO document_contents (key, content, size, updated_at)
+VALUES(
+    $1,
+    $2,
+    $3,
+    NOW()
+)
+ON CONFLICT (key) DO UPDATE
+SET content = EXCLUDED.content, size = EXCLUDED.size, updated_at = NOW();
+
+-- name: GetDocumentContent :one
+SELECT content FROM document_contents WHERE key = $1 ;
+
+-- name: GetDocumentContentInfo :one
+SELECT key, size, updated_at FROM document_contents WHERE key = $1 ;
+
+-- name: DeleteDocumentContent :exec
+DELETE FROM document_contents WHERE key = $1 ;
+
+-- name: ListDocumentContents :many
+SELECT key FROM document_contents
+WHERE key LIKE sqlc.arg(pattern)::text
+ORDER BY key ;
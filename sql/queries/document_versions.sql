@@ -0,0 +1,48 @@
+-- name: CreateDocumentVersion :one
+INSERT INTO document_versions (id, document_id, author_id, kind, label, created_at)
+VALUES(
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    NOW()
+)
+RETURNING *;
+
+-- name: GetDocumentVersions :many
+SELECT v.id, v.author_id, u.email, v.kind, v.label, v.created_at
+FROM document_versions v
+LEFT JOIN users u
+ON u.id = v.author_id
+WHERE v.document_id = $1
+ORDER BY v.created_at DESC ;
+
+-- name: GetDocumentVersion :one
+SELECT * FROM document_versions WHERE id = $1 AND document_id = $2 ;
+
+-- name: DeleteExpiredDocumentVersions :many
+DELETE FROM document_versions
+WHERE document_id = sqlc.arg(document_id) AND label IS NULL
+AND (
+    created_at < NOW() - make_interval(days => sqlc.arg(retention_days)::int)
+    OR id NOT IN (
+        SELECT id FROM document_versions
+        WHERE document_id = sqlc.arg(document_id) AND label IS NULL
+        ORDER BY created_at DESC
+        LIMIT sqlc.arg(kept)
+    )
+)
+RETURNING id;
+
+-- name: GetAllDocumentVersionIds :many
+SELECT id, document_id FROM document_versions ;
+
+-- name: GetLatestDocumentVersion :one
+SELECT * FROM document_versions
+WHERE document_id = $1
+ORDER BY created_at DESC
+LIMIT 1 ;
+
+-- name: DeleteDocumentVersion :exec
+DELETE FROM document_versions WHERE id = $1 ;
@@ -1,11 +1,12 @@
 -- name: CreateDocument :one
-INSERT INTO documents (id, created_at, updated_at, owner_id, name)
+INSERT INTO documents (id, created_at, updated_at, owner_id, name, workspace_id)
 VALUES(
     $1,
     NOW(),
     NOW(),
     $2,
-    $3
+    $3,
+    $4
 )
 RETURNING *;
 
@@ -18,15 +19,25 @@ WHERE owner_id = $1 ;
 SELECT d.id, d.name FROM documents d
 LEFT JOIN document_permissions p
 ON p.document_id = d.id 
-WHERE p.user_id = $1 OR d.owner_id = $1; 
+WHERE p.user_id = $1 OR (d.owner_id = $1 AND NOT EXISTS (
+    SELECT 1 FROM workspace_members m
+    WHERE m.workspace_id = d.workspace_id AND m.user_id = $1 AND m.role = 'guest'
+)); 
 
 
 
 
--- name: UpdateDocument :exec
+-- name: UpdateDocument :one
 UPDATE documents 
-SET updated_at = NOW()
-WHERE id = $1;
+SET updated_at = NOW(), revision = revision + 1
+WHERE id = $1
+RETURNING revision;
+
+-- name: UpdateDocumentIfRevision :one
+UPDATE documents
+SET updated_at = NOW(), revision = revision + 1
+WHERE id = $1 AND revision = $2
+RETURNING revision;
 
 -- name: UpdateDocumentName :exec
 UPDATE documents SET updated_at = NOW(), name = $1
@@ -51,4 +62,10 @@ SELECT u.email, u.id
 FROM documents d
 INNER JOIN users u 
 ON d.owner_id = u.id
-WHERE d.id = $1 ;
\ No newline at end of file
+WHERE d.id = $1 ;
+
+-- name: GetAllDocumentIds :many
+SELECT id FROM documents ;
+
+-- name: GetDocumentRevision :one
+SELECT revision FROM documents WHERE id = $1 ;
@@ -0,0 +1,96 @@
+-- name: CreateFolder :one
+INSERT INTO folders (id, name, owner_id, parent_id, created_at, updated_at)
+VALUES(
+    $1,
+    $2,
+    $3,
+    $4,
+    NOW(),
+    NOW()
+)
+RETURNING *;
+
+-- name: GetFolder :one
+SELECT * FROM folders WHERE id = $1 ;
+
+-- name: GetChildFolders :many
+SELECT * FROM folders WHERE parent_id = $1
+ORDER BY name ;
+
+-- name: GetRootFoldersByOwner :many
+SELECT * FROM folders WHERE owner_id = $1 AND parent_id IS NULL
+ORDER BY name ;
+
+-- name: GetSharedFolders :many
+SELECT f.id, f.name, f.owner_id, p.role
+FROM folder_permissions p
+INNER JOIN folders f
+ON f.id = p.folder_id
+WHERE p.user_id = $1
+ORDER BY f.name ;
+
+-- name: UpdateFolder :exec
+UPDATE folders SET name = $2, parent_id = $3, updated_at = NOW()
+WHERE id = $1 ;
+
+-- name: DeleteFolder :exec
+DELETE FROM folders WHERE id = $1 ;
+
+-- name: IsFolderWithin :one
+-- reports whether a folder is ancestor_id or one of its descendants
+WITH RECURSIVE ancestors AS (
+    SELECT id, parent_id FROM folders WHERE id = sqlc.arg(folder_id)
+    UNION
+    SELECT f.id, f.parent_id FROM folders f
+    INNER JOIN ancestors a ON f.id = a.parent_id
+)
+SELECT EXISTS (SELECT 1 FROM ancestors WHERE id = sqlc.arg(ancestor_id)) AS within;
+
+-- name: GetFolderRole :one
+-- the strongest role granted to a user on a folder or on one of its ancestors
+WITH RECURSIVE ancestors AS (
+    SELECT id, parent_id FROM folders WHERE id = sqlc.arg(folder_id)
+    UNION
+    SELECT f.id, f.parent_id FROM folders f
+    INNER JOIN ancestors a ON f.id = a.parent_id
+)
+SELECT p.role FROM folder_permissions p
+INNER JOIN ancestors a ON a.id = p.folder_id
+WHERE p.user_id = sqlc.arg(user_id)
+ORDER BY p.role = 'editor' DESC
+LIMIT 1;
+
+-- name: GetDocumentsInFolder :many
+SELECT id, name, updated_at FROM documents WHERE folder_id = $1
+ORDER BY name ;
+
+-- name: GetRootDocumentsByOwner :many
+SELECT id, name, updated_at FROM documents WHERE owner_id = $1 AND folder_id IS NULL
+AND NOT EXISTS (
+    SELECT 1 FROM workspace_members m
+    WHERE m.workspace_id = documents.workspace_id AND m.user_id = $1 AND m.role = 'guest'
+)
+ORDER BY name ;
+
+-- name: MoveDocument :exec
+UPDATE documents SET folder_id = $2, updated_at = NOW()
+WHERE id = $1 ;
+
+-- name: SetFolderPermission :exec
+INSERT INTO folder_permissions (user_id, folder_id, role)
+VALUES(
+    $1,
+    $2,
+    $3
+)
+ON CONFLICT (user_id, folder_id) DO UPDATE SET role = EXCLUDED.role, updated_at = NOW();
+
+-- name: DeleteFolderPermission :exec
+DELETE FROM folder_permissions WHERE user_id = $1 AND folder_id = $2 ;
+
+-- name: GetUsersFromFolder :many
+SELECT u.email, u.id, p.role
+FROM folder_permissions p
+INNER JOIN users u
+ON u.id = p.user_id
+WHERE p.folder_id = $1 ;
@@ -23,5 +23,23 @@ DELETE from document_permissions WHERE user_id = $1 AND document_id = $2;
 
 
 -- name: GetUserPermission :one
-SELECT role FROM document_permissions 
-WHERE user_id = $1 AND document_id = $2;
\ No newline at end of file
+-- the strongest role granted on the document itself or on the folders
+-- holding it
+WITH RECURSIVE ancestors AS (
+    SELECT f.id, f.parent_id FROM folders f
+    INNER JOIN documents d ON d.folder_id = f.id
+    WHERE d.id = $2
+    UNION
+    SELECT f.id, f.parent_id FROM folders f
+    INNER JOIN ancestors a ON f.id = a.parent_id
+)
+SELECT role FROM (
+    SELECT role FROM document_permissions 
+    WHERE user_id = $1 AND document_id = $2
+    UNION ALL
+    SELECT p.role FROM folder_permissions p
+    INNER JOIN ancestors a ON a.id = p.folder_id
+    WHERE p.user_id = $1
+) roles
+ORDER BY role = 'editor' DESC
+LIMIT 1;
\ No newline at end of file
@@ -0,0 +1,24 @@
+-- name: CreateStoreIntent :one
+INSERT INTO store_intents (action, document_id, key)
+VALUES(
+    $1,
+    $2,
+    $3
+)
+RETURNING id;
+
+-- name: DeleteStoreIntent :exec
+DELETE FROM store_intents WHERE id = $1 ;
+
+-- name: GetStaleStoreIntents :many
+SELECT * FROM store_intents
+WHERE created_at < NOW() - make_interval(secs => sqlc.arg(grace_seconds)::int)
+ORDER BY id ;
+
+-- name: IsDocumentKeyReferenced :one
+SELECT EXISTS(SELECT 1 FROM documents WHERE id = sqlc.arg(id))
+OR EXISTS(SELECT 1 FROM store_intents WHERE key = sqlc.arg(key)) AS referenced ;
+
+-- name: IsVersionKeyReferenced :one
+SELECT EXISTS(SELECT 1 FROM document_versions WHERE id = sqlc.arg(id))
+OR EXISTS(SELECT 1 FROM store_intents WHERE key = sqlc.arg(key)) AS referenced ;
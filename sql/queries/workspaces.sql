@@ -0,0 +1,112 @@
+-- name: CreateWorkspace :one
+INSERT INTO workspaces (id, name, created_at, updated_at)
+VALUES(
+    $1,
+    $2,
+    NOW(),
+    NOW()
+)
+RETURNING *;
+
+-- name: GetWorkspace :one
+SELECT * FROM workspaces WHERE id = $1 ;
+
+-- name: LockWorkspace :one
+SELECT id FROM workspaces WHERE id = $1 FOR UPDATE ;
+
+-- name: GetWorkspacesByUser :many
+SELECT w.id, w.name, m.role
+FROM workspace_members m
+INNER JOIN workspaces w
+ON w.id = m.workspace_id
+WHERE m.user_id = $1
+ORDER BY w.name ;
+
+-- name: AddWorkspaceMember :exec
+INSERT INTO workspace_members (workspace_id, user_id, role)
+VALUES(
+    $1,
+    $2,
+    $3
+)
+ON CONFLICT (workspace_id, user_id) DO NOTHING;
+
+-- name: GetWorkspaceRole :one
+SELECT role FROM workspace_members
+WHERE workspace_id = $1 AND user_id = $2 ;
+
+-- name: IsWorkspaceMemberEmail :one
+SELECT EXISTS(
+    SELECT 1 FROM workspace_members m
+    INNER JOIN users u
+    ON u.id = m.user_id
+    WHERE m.workspace_id = sqlc.arg(workspace_id) AND lower(u.email) = lower(sqlc.arg(email))
+) AS member ;
+
+-- name: GetWorkspaceMembers :many
+SELECT u.id, u.email, m.role, m.created_at
+FROM workspace_members m
+INNER JOIN users u
+ON u.id = m.user_id
+WHERE m.workspace_id = $1
+ORDER BY u.email ;
+
+-- name: UpdateWorkspaceMember :exec
+UPDATE workspace_members SET role = $3, updated_at = NOW()
+WHERE workspace_id = $1 AND user_id = $2 ;
+
+-- name: DeleteWorkspaceMember :exec
+DELETE FROM workspace_members WHERE workspace_id = $1 AND user_id = $2 ;
+
+-- name: CountWorkspaceAdmins :one
+SELECT COUNT(*) FROM workspace_members
+WHERE workspace_id = $1 AND role = 'admin' ;
+
+-- name: ReleaseWorkspaceDocuments :exec
+UPDATE documents SET owner_id = NULL, folder_id = NULL
+WHERE workspace_id = $1 AND owner_id = $2 ;
+
+-- name: GetWorkspaceDocuments :many
+SELECT id, name, owner_id, updated_at FROM documents
+WHERE workspace_id = $1
+ORDER BY name ;
+
+-- name: GetDocumentWorkspaceRole :one
+SELECT m.role FROM documents d
+INNER JOIN workspace_members m
+ON m.workspace_id = d.workspace_id
+WHERE d.id = $1 AND m.user_id = $2 ;
+
+-- name: CreateWorkspaceInvitation :one
+INSERT INTO workspace_invitations (id, workspace_id, email, role, invited_by, created_at, expires_at)
+VALUES(
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    NOW(),
+    NOW() + make_interval(days => sqlc.arg(valid_days)::int)
+)
+ON CONFLICT (workspace_id, email) DO UPDATE
+SET role = EXCLUDED.role, invited_by = EXCLUDED.invited_by, created_at = NOW(), expires_at = EXCLUDED.expires_at
+RETURNING *;
+
+-- name: GetWorkspaceInvitation :one
+SELECT * FROM workspace_invitations WHERE id = $1 ;
+
+-- name: GetWorkspaceInvitations :many
+SELECT * FROM workspace_invitations
+WHERE workspace_id = $1 AND expires_at > NOW()
+ORDER BY created_at ;
+
+-- name: GetInvitationsByEmail :many
+SELECT i.id, i.workspace_id, w.name, i.role, i.expires_at
+FROM workspace_invitations i
+INNER JOIN workspaces w
+ON w.id = i.workspace_id
+WHERE i.email = $1 AND i.expires_at > NOW()
+ORDER BY i.created_at ;
+
+-- name: DeleteWorkspaceInvitation :exec
+DELETE FROM workspace_invitations WHERE id = $1 ;
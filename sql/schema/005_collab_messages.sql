@@ -0,0 +1,12 @@
+-- +goose Up 
+CREATE TABLE collab_messages (
+    id BIGSERIAL PRIMARY KEY,
+    channel TEXT NOT NULL,
+    payload TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+
+
+-- +goose Down
+DROP TABLE collab_messages;
@@ -0,0 +1,16 @@
+-- +goose Up 
+CREATE TABLE document_versions (
+    id UUID NOT NULL PRIMARY KEY,
+    document_id UUID NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
+    author_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    kind VARCHAR NOT NULL,
+    label VARCHAR,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX document_versions_document_id_idx ON document_versions (document_id, created_at);
+
+
+
+-- +goose Down
+DROP TABLE document_versions;
@@ -0,0 +1,12 @@
+-- +goose Up
+CREATE TABLE document_contents (
+    key TEXT COLLATE "C" NOT NULL PRIMARY KEY,
+    content JSONB NOT NULL,
+    size BIGINT NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+
+
+-- +goose Down
+DROP TABLE document_contents;
@@ -0,0 +1,15 @@
+-- +goose Up
+CREATE TABLE store_intents (
+    id BIGSERIAL PRIMARY KEY,
+    action VARCHAR NOT NULL,
+    document_id UUID NOT NULL,
+    key TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX store_intents_created_at_idx ON store_intents (created_at);
+
+
+
+-- +goose Down
+DROP TABLE store_intents;
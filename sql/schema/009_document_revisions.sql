@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE documents ADD COLUMN revision BIGINT NOT NULL DEFAULT 1;
+
+-- +goose Down
+ALTER TABLE documents DROP COLUMN revision;
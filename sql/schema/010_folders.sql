@@ -0,0 +1,32 @@
+-- +goose Up 
+CREATE TABLE folders (
+    id UUID NOT NULL PRIMARY KEY,
+    name VARCHAR NOT NULL,
+    owner_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    parent_id UUID REFERENCES folders(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX folders_parent_id_idx ON folders (parent_id);
+CREATE INDEX folders_owner_id_idx ON folders (owner_id);
+
+-- deleting a folder leaves its documents at the root of their owner
+ALTER TABLE documents ADD COLUMN folder_id UUID REFERENCES folders(id) ON DELETE SET NULL;
+CREATE INDEX documents_folder_id_idx ON documents (folder_id);
+
+CREATE TABLE folder_permissions (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    folder_id UUID NOT NULL REFERENCES folders(id) ON DELETE CASCADE,
+    role VARCHAR(10) NOT NULL CHECK (role IN ('viewer','editor')),
+    PRIMARY KEY(user_id, folder_id),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+
+
+-- +goose Down
+DROP TABLE folder_permissions;
+ALTER TABLE documents DROP COLUMN folder_id;
+DROP TABLE folders;
@@ -0,0 +1,73 @@
+-- +goose Up 
+CREATE TABLE workspaces (
+    id UUID NOT NULL PRIMARY KEY,
+    name VARCHAR NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE workspace_members (
+    workspace_id UUID NOT NULL REFERENCES workspaces(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role VARCHAR(10) NOT NULL CHECK (role IN ('admin','member','guest')),
+    PRIMARY KEY(workspace_id, user_id),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX workspace_members_user_id_idx ON workspace_members (user_id);
+
+CREATE TABLE workspace_invitations (
+    id UUID NOT NULL PRIMARY KEY,
+    workspace_id UUID NOT NULL REFERENCES workspaces(id) ON DELETE CASCADE,
+    email VARCHAR NOT NULL,
+    role VARCHAR(10) NOT NULL CHECK (role IN ('admin','member','guest')),
+    invited_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMP NOT NULL,
+    UNIQUE (workspace_id, email)
+);
+
+CREATE INDEX workspace_invitations_email_idx ON workspace_invitations (email);
+
+-- documents of a workspace belong to it, their creator only keeps the owner
+-- role while an admin or member and the documents outlive their account
+ALTER TABLE documents ADD COLUMN workspace_id UUID REFERENCES workspaces(id) ON DELETE RESTRICT;
+CREATE INDEX documents_workspace_id_idx ON documents (workspace_id);
+ALTER TABLE documents ALTER COLUMN owner_id DROP NOT NULL;
+ALTER TABLE documents DROP CONSTRAINT documents_owner_id_fkey;
+ALTER TABLE documents ADD CONSTRAINT documents_owner_id_fkey
+    FOREIGN KEY (owner_id) REFERENCES users(id) ON DELETE SET NULL;
+ALTER TABLE documents ADD CONSTRAINT documents_owner_check
+    CHECK (owner_id IS NOT NULL OR workspace_id IS NOT NULL);
+
+-- personal documents still go with their owner, the reconciliation removes
+-- their content
+-- +goose StatementBegin
+CREATE FUNCTION delete_personal_documents() RETURNS trigger AS $$
+BEGIN
+    DELETE FROM documents WHERE owner_id = OLD.id AND workspace_id IS NULL;
+    RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER users_delete_personal_documents
+BEFORE DELETE ON users
+FOR EACH ROW EXECUTE FUNCTION delete_personal_documents();
+
+
+
+-- +goose Down
+DROP TRIGGER users_delete_personal_documents ON users;
+DROP FUNCTION delete_personal_documents();
+DELETE FROM documents WHERE owner_id IS NULL;
+ALTER TABLE documents DROP CONSTRAINT documents_owner_check;
+ALTER TABLE documents DROP CONSTRAINT documents_owner_id_fkey;
+ALTER TABLE documents ADD CONSTRAINT documents_owner_id_fkey
+    FOREIGN KEY (owner_id) REFERENCES users(id) ON DELETE CASCADE;
+ALTER TABLE documents ALTER COLUMN owner_id SET NOT NULL;
+ALTER TABLE documents DROP COLUMN workspace_id;
+DROP TABLE workspace_invitations;
+DROP TABLE workspace_members;
+DROP TABLE workspaces;
@@ -1,145 +1,272 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/ahmedjebari022/go-docs/internal/api"
+	"github.com/ahmedjebari022/go-docs/internal/broker"
+	"github.com/ahmedjebari022/go-docs/internal/config"
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 )
 
-
-
 var upgrader = websocket.Upgrader{
-	ReadBufferSize: 1024,
+	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
+	Subprotocols:    []string{protocolVersion},
 }
 
-type Client struct{
-	documentId  string
-	conn *websocket.Conn
-	sent	chan api.Document
-	hub *Hub
-}
-
-type Message struct{
-	Document 	api.Document `json:"document"`
-	DocumentId 	 string	 `json:"document_id"`
-}
+// sendQueueSize is how many updates can wait for a client before it is
+// considered too slow and disconnected.
+const sendQueueSize = 64
 
-type Hub struct{
-	clients map[*Client]bool
-	subscribe chan *Client
-	unsubscribe chan *Client
-	broadcast chan Message
+const maxSessionLength = 64
 
+type Client struct {
+	// session is chosen by the client and kept across reconnections
+	session string
+	// resumeEpoch and resumeRevision are where a reconnecting client left
+	// off, resumeRevision is -1 for a new client
+	resumeEpoch    string
+	resumeRevision int
+	userId         uuid.UUID
+	email          string
+	role           string
+	conn           *websocket.Conn
+	sent           chan Envelope
+	room           *Room
+	hub            *Hub
+	// closeCode and closeReason are set by the room before it closes sent
+	// when it evicts the client, and end up in the close frame.
+	closeCode   int
+	closeReason string
 }
 
+// Hub keeps one Room per open document. Each room runs on its own goroutine
+// so a busy or slow document never holds back the others.
+type Hub struct {
+	cfg    *api.ApiConfig
+	config config.Config
+	broker broker.Broker
+	// node identifies this server on the broker
+	node  string
+	mu    sync.Mutex
+	rooms map[string]*Room
+}
 
-func NewHub() Hub {
-	return Hub{
-		clients: make(map[*Client]bool),
-		subscribe: make(chan *Client),
-		unsubscribe: make(chan *Client),
-		broadcast: make(chan Message),
+func NewHub(cfg *api.ApiConfig, config config.Config, broker broker.Broker) *Hub {
+	return &Hub{
+		cfg:    cfg,
+		config: config,
+		broker: broker,
+		node:   uuid.NewString(),
+		rooms:  make(map[string]*Room),
 	}
 }
 
+// join adds the client to the room of the document, starting the room if
+// nobody has it open yet.
+func (h *Hub) join(documentId string, c *Client) {
+	h.mu.Lock()
+	r, ok := h.rooms[documentId]
+	if !ok {
+		r = newRoom(h, documentId)
+		h.rooms[documentId] = r
+		go r.Run()
+	}
+	r.refs++
+	h.mu.Unlock()
+	c.room = r
+	r.join(c)
+}
 
-func (h *Hub) Run() {
-	for {
-		select {
-		case client := <- h.subscribe:
-			fmt.Printf("subscribing client :%v\n", client)
-			h.clients[client] = true
-			fmt.Printf("clients after subscribe: %v\n", h.clients)  // Add this
-		case client := <- h.unsubscribe:
-			if _, ok := h.clients[client]; ok {
-				client.conn.Close()
-				delete(h.clients,client)
-			}
-		case msg := <- h.broadcast:
-			fmt.Printf("received brodcast :%v\n",msg)
-			for c, _ := range h.clients {
-				if c.documentId == msg.DocumentId{
-					c.sent <- msg.Document
-				}
-			}
-			}
-		}	
+// release is called by a room with no clients left. It reports whether the
+// room can stop, which is not the case when a client is on its way in.
+func (h *Hub) release(r *Room) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if r.refs > 0 {
+		return false
+	}
+	delete(h.rooms, r.documentId)
+	return true
 }
 
+// reset hands a document changed through the api to the rooms of every
+// server, so that they drop their copy instead of saving over it.
+func (h *Hub) reset(documentId uuid.UUID, revision int64, doc api.Document) {
+	payload, err := json.Marshal(event{
+		Kind:     resetEvent,
+		Node:     h.node,
+		Epoch:    uuid.NewString(),
+		Document: &doc,
+		Stored:   revision,
+	})
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+	defer cancel()
+	if err := h.broker.Publish(ctx, documentId.String(), payload); err != nil {
+		fmt.Printf("error while resetting the document %s :%s\n", documentId, err.Error())
+	}
+}
 
+func (h *Hub) forget(r *Room) {
+	h.mu.Lock()
+	r.refs--
+	h.mu.Unlock()
+}
 
-func (c *Client) Reader(){
-	defer func(){
-		c.hub.unsubscribe <- c
+func (c *Client) Reader() {
+	defer func() {
+		c.room.leave(c)
 		c.conn.Close()
 	}()
+	c.conn.SetReadLimit(api.MaxDocumentSize)
+	c.conn.SetReadDeadline(time.Now().Add(c.hub.config.PongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(c.hub.config.PongWait))
+	})
 	for {
-		fmt.Println("Reader waiting for message...")
 		_, reader, err := c.conn.NextReader()
-		fmt.Println("Reader got message!")
 		if err != nil {
-			c.hub.unsubscribe <- c
+			if errors.Is(err, websocket.ErrReadLimit) {
+				c.close(websocket.CloseMessageTooBig, "message too large")
+			}
 			break
 		}
 		decoder := json.NewDecoder(reader)
-		var doc api.Document
-		if err := decoder.Decode(&doc); err != nil {
-			fmt.Printf("error while deconding the json msg :%s\n", err.Error())
-			break
+		var env Envelope
+		var msg Message
+		if err := decoder.Decode(&env); err != nil {
+			msg.Err = &ErrorPayload{Code: InvalidMessageError, Message: err.Error()}
+		} else {
+			msg = decodeMessage(env)
 		}
-		fmt.Printf("Read :%v\n",doc)
-		
-		c.hub.broadcast <- Message{
-			DocumentId: c.documentId,
-			Document: doc,
+		if msg.Type == OpMessage && c.role == api.ViewerRole && msg.Err == nil {
+			// viewers share their selection but their operations are refused
+			msg.Err = &ErrorPayload{Code: ForbiddenError, Message: "viewers cannot edit the document"}
+		}
+		msg.client = c
+		if !c.room.submit(msg) {
+			break
 		}
 	}
 }
 
-func (c *Client) Writer(){
-	defer func(){
-		c.hub.unsubscribe <- c
+// Writer sends envelopes and keepalive pings until the room closes sent, which
+// happens when the client leaves or is evicted.
+func (c *Client) Writer() {
+	ticker := time.NewTicker(c.hub.config.PingInterval)
+	defer func() {
+		ticker.Stop()
 		c.conn.Close()
 	}()
-	for doc := range c.sent{
-		fmt.Println("client got broadcast")
-		writer, err := c.conn.NextWriter(websocket.TextMessage)
-		if err != nil {
-			c.hub.unsubscribe <- c
-		}
-		fmt.Printf("doc: %v",doc)
-		encoder := json.NewEncoder(writer)
-		if err := encoder.Encode(doc); err != nil {
-			fmt.Printf("error while encodin the doc :%s\n",err.Error())
-		}
-		if err := writer.Close(); err != nil {
-			return
+	for {
+		select {
+		case env, ok := <-c.sent:
+			if !ok {
+				if c.closeCode != 0 {
+					c.close(c.closeCode, c.closeReason)
+				}
+				return
+			}
+			c.conn.SetWriteDeadline(time.Now().Add(c.hub.config.WriteWait))
+			writer, err := c.conn.NextWriter(websocket.TextMessage)
+			if err != nil {
+				return
+			}
+			encoder := json.NewEncoder(writer)
+			if err := encoder.Encode(env); err != nil {
+				fmt.Printf("error while encodin the envelope :%s\n", err.Error())
+			}
+			if err := writer.Close(); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(c.hub.config.WriteWait)); err != nil {
+				return
+			}
 		}
 	}
 }
 
-func (h *Hub)wsHandler(w http.ResponseWriter, r *http.Request){
-	conn, err := upgrader.Upgrade(w, r, nil)
+// close sends a close frame; the connection itself is closed by whoever
+// returns first between Reader and Writer.
+func (c *Client) close(code int, reason string) {
+	msg := websocket.FormatCloseMessage(code, reason)
+	c.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(c.hub.config.WriteWait))
+}
+
+func (h *Hub) wsHandler(w http.ResponseWriter, r *http.Request) {
+	documentIdString := r.PathValue("documentId")
+	documentId, err := uuid.Parse(documentIdString)
 	if err != nil {
+		api.RespondWithError(w, 400, err.Error())
 		return
-	}		
-	documentIdString := r.PathValue("documentId")	
-	_, err = uuid.Parse(documentIdString)
+	}
+	userId, err := h.cfg.AuthenticateWebSocket(r, documentId)
 	if err != nil {
-		fmt.Println("error parsin the document id :%s",err.Error())
+		api.RespondWithError(w, 401, "authentication error")
+		return
+	}
+	if !slices.Contains(websocket.Subprotocols(r), protocolVersion) {
+		api.RespondWithError(w, 400, "unsupported protocol version, expected "+protocolVersion)
+		return
+	}
+	role, err := h.cfg.GetUserRole(r.Context(), userId, documentId)
+	if err != nil {
+		api.RespondWithError(w, api.ParseStatusFromError(err), err.Error())
+		return
+	}
+	// a reconnecting client passes its session, and the epoch and revision
+	// it last saw to only receive what it missed
+	query := r.URL.Query()
+	session := query.Get("session")
+	if session == "" {
+		session = uuid.NewString()
+	} else if len(session) > maxSessionLength {
+		api.RespondWithError(w, 400, "session too long")
+		return
+	}
+	resumeRevision := -1
+	if revision := query.Get("revision"); revision != "" {
+		resumeRevision, err = strconv.Atoi(revision)
+		if err != nil || resumeRevision < 0 {
+			api.RespondWithError(w, 400, "invalid revision")
+			return
+		}
+	}
+	user, err := h.cfg.Db.GetUserById(r.Context(), userId)
+	if err != nil {
+		api.RespondWithError(w, 401, "authentication error")
+		return
+	}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
 	}
 	c := &Client{
-		documentId: documentIdString,
-		conn: conn,
-		hub: h,
-		sent: make(chan api.Document),
+		session:        session,
+		resumeEpoch:    query.Get("epoch"),
+		resumeRevision: resumeRevision,
+		userId:         userId,
+		email:          user.Email,
+		role:           role,
+		conn:           conn,
+		sent:           make(chan Envelope, sendQueueSize),
+		hub:            h,
 	}
-	h.subscribe <- c
+	h.join(documentId.String(), c)
 	go c.Reader()
 	go c.Writer()
 }